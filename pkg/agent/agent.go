@@ -16,10 +16,16 @@ package agent
 
 import (
 	"context"
+	"maps"
+	"math"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
 	runtime "k8s.io/cri-api/pkg/apis/runtime/v1"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	stvziov1 "stvz.io/coral/pkg/apis/stvz.io/v1"
@@ -41,22 +47,44 @@ type AgentOptions struct {
 	Namespace            string
 	NodeName             string
 	PollInterval         time.Duration
+	// MaxFailures is the number of consecutive pull failures before the image is
+	// moved into the error state.
+	MaxFailures int
+	// MaxBackoff is the maximum amount of time to wait between pull attempts for
+	// an image that has failed.
+	MaxBackoff time.Duration
+	// MaxImageFsFraction is the fraction of the free space on the image filesystem
+	// that managed images are allowed to use.  A value of zero disables the check.
+	MaxImageFsFraction float64
+	// NodeLabels enables projecting the image state onto the node labels.  The labels
+	// are only needed when the injector uses node selectors.
+	NodeLabels bool
+	// Recorder is used to emit events on the node when pulls are paused or resumed.
+	Recorder record.EventRecorder
 }
 
 type Agent struct {
-	log     logr.Logger
-	options *AgentOptions
-	client  client.Client
+	log      logr.Logger
+	options  *AgentOptions
+	client   client.Client
+	recorder record.EventRecorder
+	backoff  *Backoff
+	paused   bool
 }
 
 func NewAgent(options *AgentOptions) *Agent {
 	return &Agent{
-		log:     options.Log,
-		client:  options.Client,
-		options: options,
+		log:      options.Log,
+		client:   options.Client,
+		recorder: options.Recorder,
+		options:  options,
+		backoff:  NewBackoff(options.PollInterval, options.MaxBackoff),
 	}
 }
 
+// +kubebuilder:rbac:groups=core,resources=events,verbs=create;patch
+// +kubebuilder:rbac:groups=stvz.io,resources=nodeimagestates,verbs=get;list;watch;create;update
+
 func (a *Agent) Start(ctx context.Context) {
 	wg := &sync.WaitGroup{}
 	sem := NewSemaphore()
@@ -68,7 +96,7 @@ func (a *Agent) Start(ctx context.Context) {
 		worker := NewWorker(i, a.options)
 		go func(worker *Worker) {
 			defer wg.Done()
-			worker.Start(ctx, eq, sem)
+			worker.Start(ctx, eq, sem, a.backoff)
 		}(worker)
 	}
 
@@ -120,49 +148,116 @@ func (a *Agent) process(ctx context.Context, eq EventQueue, sem *Semaphore, node
 	}
 
 	managedImages := make(map[string]string)
+	digests := make(map[string]string)
 	authMap := make(map[string][]*runtime.AuthConfig)
 
 	for _, image := range images {
-		for _, data := range image.Status.Data {
+		for _, data := range image.GetImageStatus().Data {
 			managedImages[data.Name] = data.Label
+			digests[data.Name] = data.Digest
 			authMap[data.Name] = image.RuntimeAuthLookup(data.Name)
 		}
 	}
 
-	// I think the ImageMap should replace GetNodeImages.
-	nodeImages, err := ImageMap(ctx, a.options.ImageServiceClient)
+	// Get the images on the node keyed by tag.  The runtime identifiers are used to
+	// make sure we don't remove images that are shared with managed tags.
+	nodeImages, err := ListNodeImages(ctx, a.options.ImageServiceClient)
 	if err != nil {
+		agentError.WithLabelValues("list_node_images").Inc()
 		return err
 	}
 
-	state := UpdateState(nodeImages, managedImages)
-	labels := ReplaceImageLabels(node.GetLabels(), state)
-	err = node.UpdateLabels(ctx, a.client, labels)
+	ids := make(map[string]string, len(nodeImages))
+	for tag, img := range nodeImages {
+		ids[tag] = img.Id
+	}
+
+	nis, err := GetNodeImageState(ctx, a.client, node)
 	if err != nil {
-		agentError.WithLabelValues("update_labels").Inc()
+		agentError.WithLabelValues("get_node_image_state").Inc()
 		return err
 	}
 
-	// NOTE:
-	// Originally I had deletion in here, but it may be better behavior to leave
-	// the image be and let the kubelet GC it naturally.  If the injector has been
-	// activated, the controller will keep new resources off of the node and should
-	// trigger cleanup of the image once the pod is removed.
-	for name, state := range state {
-		auth, ok := authMap[name]
-		if !ok {
-			a.log.Error(nil, "server error, auth not found for image", "name", name)
-			agentError.WithLabelValues("auth_not_found").Inc()
-			continue
+	// Forget failures for images that are no longer managed so they start fresh if
+	// they are added back.
+	a.backoff.Prune(managedImages)
+
+	// Pulls are paused while the node is not ready, is under pressure, or the managed
+	// images have used up their share of the image filesystem.  Removals are still
+	// processed since they free up space.
+	reasons := node.NotReadyReasons()
+	if a.pullBudget(ctx, nodeImages, managedImages) <= 0 {
+		reasons = append(reasons, ReasonImageFsBudget)
+	}
+	a.updatePaused(node, reasons)
+
+	// Images tracked in the node image state, or labeled on the node by earlier
+	// versions of the agent, are candidates for removal.
+	tracked := nis.StateByLabel()
+	for k, v := range node.GetLabels() {
+		if strings.HasPrefix(k, stvziov1.LabelPrefix) {
+			tracked[k] = v
 		}
+	}
+
+	state := UpdateState(ids, managedImages)
+	state = StaleState(state, nodeImages, digests)
+	state = ErrorState(state, a.backoff, a.options.MaxFailures)
+	// Any image that we have previously tracked but is no longer managed is marked
+	// for deletion.  The image remains in the node state until it has been removed
+	// from the node so the controller can hold on to the finalizer until cleanup is
+	// complete.
+	for name, s := range RemoveState(tracked, ids, managedImages) {
+		state[name] = s
+	}
 
+	err = UpdateNodeImageState(ctx, a.client, nis, NodeImages(state, nis.ImageMap(), nodeImages, a.backoff, metav1.Now()))
+	if err != nil {
+		agentError.WithLabelValues("update_node_image_state").Inc()
+		return err
+	}
+
+	// Node labels are only maintained when requested since they are required by the
+	// selector injection mode.  Otherwise any labels left behind are cleaned up.
+	labelState := state
+	if !a.options.NodeLabels {
+		labelState = map[string]string{}
+	}
+
+	labels := ReplaceImageLabels(node.GetLabels(), labelState)
+	if !maps.Equal(labels, node.GetLabels()) {
+		err = node.UpdateLabels(ctx, a.client, labels)
+		if err != nil {
+			agentError.WithLabelValues("update_labels").Inc()
+			return err
+		}
+	}
+
+	for name, state := range state {
 		if sem.Acquired(name) {
 			a.log.V(10).Info("image is already being processed, skipping", "image", name)
 			continue
 		}
 
 		switch state {
-		case string(stvziov1.ImageStatePending):
+		case string(stvziov1.ImageStatePending), string(stvziov1.ImageStateStale), string(stvziov1.ImageStateError):
+			if a.paused {
+				a.log.V(8).Info("image pulls are paused, skipping", "image", name, "reasons", reasons)
+				continue
+			}
+
+			if !a.backoff.Ready(name) {
+				a.log.V(10).Info("image is backing off after failures, skipping", "image", name, "failures", a.backoff.Failures(name))
+				continue
+			}
+
+			auth, ok := authMap[name]
+			if !ok {
+				a.log.Error(nil, "server error, auth not found for image", "name", name)
+				agentError.WithLabelValues("auth_not_found").Inc()
+				continue
+			}
+
 			a.log.V(8).Info("sending pull event", "name", name)
 			agentImagePulls.Inc()
 			eq <- &Event{
@@ -170,6 +265,13 @@ func (a *Agent) process(ctx context.Context, eq EventQueue, sem *Semaphore, node
 				Image:     name,
 				Auth:      auth,
 			}
+		case string(stvziov1.ImageStateDeleting):
+			a.log.V(8).Info("sending remove event", "name", name)
+			agentImageRemovals.Inc()
+			eq <- &Event{
+				Operation: Remove,
+				Image:     name,
+			}
 		case string(stvziov1.ImageStateAvailable):
 			a.log.V(8).Info("image is available, skipping", "name", name)
 		}
@@ -177,3 +279,59 @@ func (a *Agent) process(ctx context.Context, eq EventQueue, sem *Semaphore, node
 
 	return nil
 }
+
+// pullBudget returns the number of bytes that can still be pulled onto the node.  The
+// budget is only checked at the start of each run, so pulls queued during the run may
+// exceed it by the size of those images.
+func (a *Agent) pullBudget(ctx context.Context, nodeImages map[string]*runtime.Image, managedImages map[string]string) int64 {
+	if a.options.MaxImageFsFraction <= 0 {
+		return math.MaxInt64
+	}
+
+	var managed uint64
+	for name := range managedImages {
+		if img, ok := nodeImages[name]; ok {
+			managed += img.Size_
+		}
+	}
+
+	usage, err := GetImageFsUsage(ctx, a.options.ImageServiceClient)
+	if err != nil {
+		a.log.Error(err, "unable to get image filesystem usage, skipping image filesystem check")
+		agentError.WithLabelValues("image_fs_info").Inc()
+		return math.MaxInt64
+	}
+
+	budget := PullBudget(usage.AvailableBytes, managed, a.options.MaxImageFsFraction)
+	agentImageFsBudget.Set(float64(budget))
+	a.log.V(8).Info("image filesystem budget", "mountpoint", usage.Mountpoint, "available", usage.AvailableBytes, "managed", managed, "budget", budget)
+
+	return budget
+}
+
+// updatePaused records the reasons pulls are paused and emits an event on the node
+// when pulls transition between paused and resumed.
+func (a *Agent) updatePaused(node *Node, reasons []string) {
+	for _, r := range []string{ReasonNotReady, ReasonDiskPressure, ReasonPIDPressure, ReasonImageFsBudget} {
+		agentPullsPaused.WithLabelValues(r).Set(0)
+	}
+	for _, r := range reasons {
+		agentPullsPaused.WithLabelValues(r).Set(1)
+	}
+
+	paused := len(reasons) > 0
+	if paused == a.paused {
+		return
+	}
+	a.paused = paused
+
+	if paused {
+		a.log.Info("pausing image pulls", "reasons", reasons)
+		a.recorder.Eventf(&node.Node, corev1.EventTypeWarning, "ImagePullsPaused",
+			"Image pulls are paused on the node: %s", strings.Join(reasons, ", "))
+	} else {
+		a.log.Info("resuming image pulls")
+		a.recorder.Event(&node.Node, corev1.EventTypeNormal, "ImagePullsResumed",
+			"Image pulls have resumed on the node")
+	}
+}
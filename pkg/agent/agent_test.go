@@ -0,0 +1,58 @@
+// Copyright 2024 Coral Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package agent
+
+import (
+	"path"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/client-go/tools/record"
+	"stvz.io/coral/pkg/mock"
+)
+
+var _ = Describe("Agent", func() {
+	Context("updatePaused", func() {
+		It("should emit events only when pulls are paused or resumed", func() {
+			By("mocking a new client")
+			file := path.Join(fixtures, "nodes.yaml")
+			c := mock.NewClient().WithLogger(logger).WithFixtureOrDie(file)
+
+			node, err := GetNode(ctx, "node1", c)
+			Expect(err).ToNot(HaveOccurred())
+
+			recorder := record.NewFakeRecorder(10)
+			agent := NewAgent(&AgentOptions{
+				Log:      logger,
+				Client:   c,
+				Recorder: recorder,
+			})
+
+			By("pausing the pulls")
+			agent.updatePaused(node, []string{ReasonDiskPressure})
+			Expect(agent.paused).To(BeTrue())
+			Expect(recorder.Events).To(Receive(ContainSubstring("ImagePullsPaused")))
+
+			By("staying paused")
+			agent.updatePaused(node, []string{ReasonDiskPressure})
+			Expect(recorder.Events).ToNot(Receive())
+
+			By("resuming the pulls")
+			agent.updatePaused(node, []string{})
+			Expect(agent.paused).To(BeFalse())
+			Expect(recorder.Events).To(Receive(ContainSubstring("ImagePullsResumed")))
+		})
+	})
+})
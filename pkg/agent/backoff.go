@@ -0,0 +1,142 @@
+// Copyright 2024 Coral Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package agent
+
+import (
+	"sync"
+	"time"
+)
+
+type failure struct {
+	count int
+	next  time.Time
+	err   string
+}
+
+// Backoff tracks failed operations per image and calculates when the next attempt
+// should be made.  The delay doubles on every failure starting from the base delay
+// and is capped at the max delay.
+type Backoff struct {
+	base     time.Duration
+	max      time.Duration
+	failures map[string]*failure
+	now      func() time.Time
+	sync.Mutex
+}
+
+func NewBackoff(base time.Duration, max time.Duration) *Backoff {
+	return &Backoff{
+		base:     base,
+		max:      max,
+		failures: make(map[string]*failure),
+		now:      time.Now,
+	}
+}
+
+// Failure records a failure for the key and returns the number of consecutive
+// failures.
+func (b *Backoff) Failure(key string, err error) int {
+	b.Lock()
+	defer b.Unlock()
+
+	f, ok := b.failures[key]
+	if !ok {
+		f = &failure{}
+		b.failures[key] = f
+	}
+
+	f.count++
+	f.next = b.now().Add(b.delay(f.count))
+	if err != nil {
+		f.err = err.Error()
+	}
+
+	return f.count
+}
+
+// Reset clears the failures for the key.
+func (b *Backoff) Reset(key string) {
+	b.Lock()
+	defer b.Unlock()
+
+	delete(b.failures, key)
+}
+
+// Ready returns true if the key has no failures or the backoff delay has passed.
+func (b *Backoff) Ready(key string) bool {
+	b.Lock()
+	defer b.Unlock()
+
+	f, ok := b.failures[key]
+	if !ok {
+		return true
+	}
+
+	return !b.now().Before(f.next)
+}
+
+// Failures returns the number of consecutive failures for the key.
+func (b *Backoff) Failures(key string) int {
+	b.Lock()
+	defer b.Unlock()
+
+	f, ok := b.failures[key]
+	if !ok {
+		return 0
+	}
+
+	return f.count
+}
+
+// LastError returns the last error recorded for the key.
+func (b *Backoff) LastError(key string) string {
+	b.Lock()
+	defer b.Unlock()
+
+	f, ok := b.failures[key]
+	if !ok {
+		return ""
+	}
+
+	return f.err
+}
+
+// Prune removes the tracked failures for any key that is not in the keep map.
+func (b *Backoff) Prune(keep map[string]string) {
+	b.Lock()
+	defer b.Unlock()
+
+	for k := range b.failures {
+		if _, ok := keep[k]; !ok {
+			delete(b.failures, k)
+		}
+	}
+}
+
+func (b *Backoff) delay(count int) time.Duration {
+	d := b.base
+	for i := 1; i < count; i++ {
+		d *= 2
+		if d >= b.max {
+			return b.max
+		}
+	}
+
+	if d > b.max {
+		return b.max
+	}
+
+	return d
+}
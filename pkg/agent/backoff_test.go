@@ -0,0 +1,93 @@
+// Copyright 2024 Coral Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package agent
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Backoff", func() {
+	var (
+		now     time.Time
+		backoff *Backoff
+	)
+
+	BeforeEach(func() {
+		now = time.Now()
+		backoff = NewBackoff(10*time.Second, time.Minute)
+		backoff.now = func() time.Time { return now }
+	})
+
+	Context("Failure", func() {
+		It("should count consecutive failures", func() {
+			Expect(backoff.Failure("key", nil)).To(Equal(1))
+			Expect(backoff.Failure("key", nil)).To(Equal(2))
+			Expect(backoff.Failures("key")).To(Equal(2))
+			Expect(backoff.Failures("other")).To(Equal(0))
+		})
+
+		It("should double the delay on each failure", func() {
+			backoff.Failure("key", nil)
+			Expect(backoff.failures["key"].next).To(Equal(now.Add(10 * time.Second)))
+
+			backoff.Failure("key", nil)
+			Expect(backoff.failures["key"].next).To(Equal(now.Add(20 * time.Second)))
+
+			backoff.Failure("key", nil)
+			Expect(backoff.failures["key"].next).To(Equal(now.Add(40 * time.Second)))
+		})
+
+		It("should cap the delay at the max", func() {
+			for i := 0; i < 10; i++ {
+				backoff.Failure("key", nil)
+			}
+			Expect(backoff.failures["key"].next).To(Equal(now.Add(time.Minute)))
+		})
+	})
+
+	Context("Ready", func() {
+		It("should be ready if there are no failures", func() {
+			Expect(backoff.Ready("key")).To(BeTrue())
+		})
+
+		It("should not be ready until the delay has passed", func() {
+			backoff.Failure("key", nil)
+			Expect(backoff.Ready("key")).To(BeFalse())
+
+			now = now.Add(10 * time.Second)
+			Expect(backoff.Ready("key")).To(BeTrue())
+		})
+
+		It("should be ready after a reset", func() {
+			backoff.Failure("key", nil)
+			backoff.Reset("key")
+			Expect(backoff.Ready("key")).To(BeTrue())
+			Expect(backoff.Failures("key")).To(Equal(0))
+		})
+	})
+
+	Context("Prune", func() {
+		It("should remove failures that are not kept", func() {
+			backoff.Failure("key1", nil)
+			backoff.Failure("key2", nil)
+			backoff.Prune(map[string]string{"key1": ""})
+			Expect(backoff.Failures("key1")).To(Equal(1))
+			Expect(backoff.Failures("key2")).To(Equal(0))
+		})
+	})
+})
@@ -0,0 +1,67 @@
+// Copyright 2024 Coral Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package agent
+
+import (
+	"context"
+	"syscall"
+
+	runtime "k8s.io/cri-api/pkg/apis/runtime/v1"
+)
+
+// ImageFsUsage is the usage of the filesystem that the container runtime stores
+// images on.
+type ImageFsUsage struct {
+	Mountpoint     string
+	UsedBytes      uint64
+	AvailableBytes uint64
+}
+
+// GetImageFsUsage uses the runtime to look up the image filesystem and then checks
+// the available space on the mountpoint.  The runtime only reports the bytes used
+// so the mountpoint must be accessible from the agent container.
+func GetImageFsUsage(ctx context.Context, ims runtime.ImageServiceClient) (*ImageFsUsage, error) {
+	resp, err := ims.ImageFsInfo(ctx, &runtime.ImageFsInfoRequest{})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(resp.ImageFilesystems) == 0 {
+		return nil, ErrImageFsNotFound
+	}
+
+	fs := resp.ImageFilesystems[0]
+	usage := &ImageFsUsage{
+		Mountpoint: fs.GetFsId().GetMountpoint(),
+		UsedBytes:  fs.GetUsedBytes().GetValue(),
+	}
+
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(usage.Mountpoint, &stat); err != nil {
+		return nil, err
+	}
+	usage.AvailableBytes = stat.Bavail * uint64(stat.Bsize) // #nosec G115
+
+	return usage, nil
+}
+
+// PullBudget returns the number of bytes that the agent may still pull.  Managed
+// images are allowed to use up to the fraction of the space that is available to
+// them, which is the free space on the filesystem plus the space they are already
+// using.  A negative value means the budget has been exceeded.
+func PullBudget(available uint64, managed uint64, fraction float64) int64 {
+	limit := fraction * float64(available+managed)
+	return int64(limit) - int64(managed) // #nosec G115
+}
@@ -0,0 +1,33 @@
+// Copyright 2024 Coral Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package agent
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("FsInfo", func() {
+	Context("PullBudget", func() {
+		It("should allow pulls up to the fraction of the space available to managed images", func() {
+			Expect(PullBudget(1000, 0, 0.5)).To(Equal(int64(500)))
+			Expect(PullBudget(800, 200, 0.5)).To(Equal(int64(300)))
+		})
+
+		It("should return a negative budget once managed images exceed the fraction", func() {
+			Expect(PullBudget(400, 600, 0.5)).To(Equal(int64(-100)))
+		})
+	})
+})
@@ -29,11 +29,13 @@ import (
 // TODO: Secrets need to be per image rather than a global list.
 type Image struct {
 	keyring credentialprovider.DockerKeyring
-	stvziov1.Image
+	stvziov1.ImageObject
 }
 
+// ListImages returns the images and cluster images that match the node labels.  The
+// namespace only limits the namespaced images, cluster images are always included.
 func ListImages(ctx context.Context, c client.Client, ns string, nodeLabels map[string]string) ([]Image, error) {
-	images := []Image{}
+	objects := []stvziov1.ImageObject{}
 
 	imageList := stvziov1.ImageList{}
 	err := c.List(ctx, &imageList, &client.ListOptions{
@@ -43,20 +45,35 @@ func ListImages(ctx context.Context, c client.Client, ns string, nodeLabels map[
 		return nil, err
 	}
 
-	for _, image := range imageList.Items {
+	for i := range imageList.Items {
+		objects = append(objects, &imageList.Items[i])
+	}
+
+	clusterImageList := stvziov1.ClusterImageList{}
+	err = c.List(ctx, &clusterImageList)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range clusterImageList.Items {
+		objects = append(objects, &clusterImageList.Items[i])
+	}
+
+	images := []Image{}
+	for _, image := range objects {
 		// Skip deleted images.
 		if image.GetDeletionTimestamp() != nil {
 			continue
 		}
 
-		matched, err := matched(image.Spec.Selector, nodeLabels)
+		matched, err := matched(image.GetSelector(), nodeLabels)
 		if err != nil {
 			return nil, err
 		}
 
 		if matched {
-			img := image.DeepCopy()
-			wrapped := Image{Image: *img}
+			img := image.DeepCopyObject().(stvziov1.ImageObject)
+			wrapped := Image{ImageObject: img}
 
 			secrets, err := getPullSecrets(ctx, c, img)
 			if err != nil {
@@ -116,16 +133,12 @@ func matched(selectors []stvziov1.NodeSelector, nodeLabels map[string]string) (b
 	return s.Matches(labels.Set(nodeLabels)), nil
 }
 
-func getPullSecrets(ctx context.Context, c client.Client, img *stvziov1.Image) ([]corev1.Secret, error) {
+func getPullSecrets(ctx context.Context, c client.Client, img stvziov1.ImageObject) ([]corev1.Secret, error) {
 	secrets := []corev1.Secret{}
 
-	if img.Spec.ImagePullSecrets == nil {
-		return []corev1.Secret{}, nil
-	}
-
-	for _, s := range img.Spec.ImagePullSecrets {
+	for _, key := range img.GetPullSecrets() {
 		secret := &corev1.Secret{}
-		err := c.Get(ctx, client.ObjectKey{Name: s.Name, Namespace: img.Namespace}, secret)
+		err := c.Get(ctx, key, secret)
 		if err != nil {
 			return []corev1.Secret{}, err
 		}
@@ -50,10 +50,10 @@ var _ = Describe("Images", func() {
 			Expect(err).ToNot(HaveOccurred())
 			Expect(images).To(HaveLen(2))
 			Expect(images).To(MatchElements(func(element interface{}) string {
-				return element.(Image).Name
+				return element.(Image).GetName()
 			}, IgnoreMissing, Elements{
-				"base":      HaveField("ObjectMeta.Name", "base"),
-				"strataviz": HaveField("ObjectMeta.Name", "strataviz"),
+				"base":      HaveField("GetName()", "base"),
+				"strataviz": HaveField("GetName()", "strataviz"),
 			}))
 		})
 
@@ -69,9 +69,9 @@ var _ = Describe("Images", func() {
 			Expect(err).ToNot(HaveOccurred())
 			Expect(images).To(HaveLen(1))
 			Expect(images).To(MatchElements(func(element interface{}) string {
-				return element.(Image).Name
+				return element.(Image).GetName()
 			}, IgnoreMissing, Elements{
-				"strataviz": HaveField("ObjectMeta.Name", "strataviz"),
+				"strataviz": HaveField("GetName()", "strataviz"),
 			}))
 		})
 
@@ -85,9 +85,30 @@ var _ = Describe("Images", func() {
 			Expect(err).ToNot(HaveOccurred())
 			Expect(images).To(HaveLen(1))
 			Expect(images).To(MatchElements(func(element interface{}) string {
-				return element.(Image).Name
+				return element.(Image).GetName()
 			}, IgnoreMissing, Elements{
-				"base": HaveField("ObjectMeta.Name", "base"),
+				"base": HaveField("GetName()", "base"),
+			}))
+		})
+
+		It("should return cluster images regardless of the namespace", func() {
+			By("mocking a new client")
+			c := mock.NewClient().WithLogger(logger).
+				WithFixtureOrDie(
+					path.Join(fixtures, "images.yaml"),
+					path.Join(fixtures, "cluster_images.yaml"),
+					path.Join(fixtures, "secrets_fake.yaml"),
+				)
+
+			By("getting the images")
+			images, err := ListImages(ctx, c, "default", map[string]string{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(images).To(HaveLen(2))
+			Expect(images).To(MatchElements(func(element interface{}) string {
+				return element.(Image).GetName()
+			}, IgnoreMissing, Elements{
+				"base":     HaveField("GetName()", "base"),
+				"sidecars": HaveField("GetNamespace()", ""),
 			}))
 		})
 
@@ -124,6 +145,26 @@ var _ = Describe("Images", func() {
 			Expect(secrets[0].Name).To(Equal("regcred"))
 		})
 
+		It("should get the pull secrets for a cluster image from the referenced namespace", func() {
+			By("mocking a new client")
+			c := mock.NewClient().WithLogger(logger).
+				WithFixtureOrDie(
+					path.Join(fixtures, "cluster_images.yaml"),
+					path.Join(fixtures, "secrets_fake.yaml"),
+				)
+
+			By("getting the image")
+			image := stvziov1.ClusterImage{}
+			err := c.Get(ctx, types.NamespacedName{Name: "sidecars"}, &image)
+			Expect(err).ToNot(HaveOccurred())
+
+			By("getting the secrets")
+			secrets, err := getPullSecrets(ctx, c, &image)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(secrets).To(HaveLen(1))
+			Expect(secrets[0].Namespace).To(Equal("analytics"))
+		})
+
 		It("should return an error if the pull secret is outside of the namespace", func() {
 			By("mocking a new client")
 			c := mock.NewClient().WithLogger(logger).
@@ -51,6 +51,28 @@ var (
 			Help: "The number of image pulls.",
 		},
 	)
+
+	agentPullsPaused = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "coral_agent_pulls_paused",
+			Help: "Set to 1 when image pulls are paused on the node for the given reason.",
+		},
+		[]string{"reason"},
+	)
+
+	agentImageFsBudget = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "coral_agent_image_fs_budget_bytes",
+			Help: "The number of bytes remaining that the agent may pull onto the image filesystem.",
+		},
+	)
+
+	agentImageRemovals = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "coral_agent_image_removals",
+			Help: "The number of image removals.",
+		},
+	)
 )
 
 func init() {
@@ -58,4 +80,7 @@ func init() {
 	metrics.Registry.MustRegister(agentImageError)
 	metrics.Registry.MustRegister(agentRunDuration)
 	metrics.Registry.MustRegister(agentImagePulls)
+	metrics.Registry.MustRegister(agentImageRemovals)
+	metrics.Registry.MustRegister(agentPullsPaused)
+	metrics.Registry.MustRegister(agentImageFsBudget)
 }
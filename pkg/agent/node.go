@@ -22,6 +22,13 @@ import (
 	stvziov1 "stvz.io/coral/pkg/apis/stvz.io/v1"
 )
 
+const (
+	ReasonNotReady      = "NotReady"
+	ReasonDiskPressure  = "DiskPressure"
+	ReasonPIDPressure   = "PIDPressure"
+	ReasonImageFsBudget = "ImageFsBudget"
+)
+
 // Node represents a kubernetes node with helpers for interacting with coral
 // specific data.
 type Node struct {
@@ -55,6 +62,23 @@ func (n *Node) IsReady() bool {
 	return n.conditionReady && n.conditionDiskPressure && n.conditionPIDPressure
 }
 
+// NotReadyReasons returns the reasons that the node should not be receiving new
+// images.  An empty list means the node is ready.
+func (n *Node) NotReadyReasons() []string {
+	reasons := make([]string, 0)
+	if !n.conditionReady {
+		reasons = append(reasons, ReasonNotReady)
+	}
+	if !n.conditionDiskPressure {
+		reasons = append(reasons, ReasonDiskPressure)
+	}
+	if !n.conditionPIDPressure {
+		reasons = append(reasons, ReasonPIDPressure)
+	}
+
+	return reasons
+}
+
 // Refresh retrieves the latest node information from the cache.
 func (n *Node) Refresh(ctx context.Context, c client.Client) error {
 	node := corev1.Node{}
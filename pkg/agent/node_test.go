@@ -122,6 +122,34 @@ var _ = Describe("Node", func() {
 		})
 	})
 
+	Context("NotReadyReasons", func() {
+		It("should return no reasons if the node is ready", func() {
+			By("mocking a new client")
+			file := path.Join(fixtures, "nodes.yaml")
+			c := mock.NewClient().WithLogger(logger).WithFixtureOrDie(file)
+
+			By("getting the node")
+			node, err := GetNode(ctx, "node1", c)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(node.NotReadyReasons()).To(BeEmpty())
+		})
+
+		It("should return the pressure conditions", func() {
+			By("mocking a new client")
+			file := path.Join(fixtures, "not-ready-nodes.yaml")
+			c := mock.NewClient().WithLogger(logger).WithFixtureOrDie(file)
+
+			By("getting the nodes")
+			node, err := GetNode(ctx, "diskpressure", c)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(node.NotReadyReasons()).To(ConsistOf(ReasonDiskPressure))
+
+			node, err = GetNode(ctx, "pidpressure", c)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(node.NotReadyReasons()).To(ConsistOf(ReasonPIDPressure))
+		})
+	})
+
 	Context("Refresh", func() {
 		It("should refresh the node", func() {
 			By("mocking a new client")
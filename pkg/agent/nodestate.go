@@ -0,0 +1,119 @@
+// Copyright 2024 Coral Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package agent
+
+import (
+	"context"
+	"sort"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	runtime "k8s.io/cri-api/pkg/apis/runtime/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	stvziov1 "stvz.io/coral/pkg/apis/stvz.io/v1"
+)
+
+// GetNodeImageState retrieves the image state for the node.  If the state has not
+// been created yet, a new object owned by the node is returned so it will be garbage
+// collected when the node is removed.
+func GetNodeImageState(ctx context.Context, c client.Client, node *Node) (*stvziov1.NodeImageState, error) {
+	state := &stvziov1.NodeImageState{}
+	err := c.Get(ctx, client.ObjectKey{Name: node.Name}, state)
+	if apierrors.IsNotFound(err) {
+		return &stvziov1.NodeImageState{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: node.Name,
+				OwnerReferences: []metav1.OwnerReference{
+					{
+						APIVersion: "v1",
+						Kind:       "Node",
+						Name:       node.Name,
+						UID:        node.UID,
+					},
+				},
+			},
+		}, nil
+	}
+
+	return state, err
+}
+
+// UpdateNodeImageState creates the image state if it doesn't exist yet, otherwise it
+// is only updated when the images have changed to avoid unnecessary writes on every
+// interval.
+func UpdateNodeImageState(ctx context.Context, c client.Client, state *stvziov1.NodeImageState, images []stvziov1.NodeImage) error {
+	status := stvziov1.NodeImageStateStatus{
+		TotalImages: len(images),
+		Images:      images,
+	}
+
+	if state.ResourceVersion == "" {
+		state.Status = status
+		return c.Create(ctx, state)
+	}
+
+	if equality.Semantic.DeepEqual(state.Status, status) {
+		return nil
+	}
+
+	state.Status = status
+	return c.Update(ctx, state)
+}
+
+// NodeImages builds the list of node images from the current state.  The last pull
+// time is carried over from the previous state and is set when an image is first
+// observed as available.
+func NodeImages(
+	state map[string]string,
+	previous map[string]stvziov1.NodeImage,
+	nodeImages map[string]*runtime.Image,
+	backoff *Backoff,
+	now metav1.Time,
+) []stvziov1.NodeImage {
+	images := make([]stvziov1.NodeImage, 0, len(state))
+
+	for name, s := range state {
+		image := stvziov1.NodeImage{
+			Name:      name,
+			Label:     stvziov1.HashedImageLabelKey(name),
+			State:     stvziov1.ImageState(s),
+			LastError: backoff.LastError(name),
+		}
+
+		if img, ok := nodeImages[name]; ok {
+			if len(img.RepoDigests) > 0 {
+				image.Digest = img.RepoDigests[0]
+			}
+			image.Size = int64(img.Size_) // #nosec G115
+		}
+
+		prev, ok := previous[name]
+		switch {
+		case ok && prev.LastPullTime != nil:
+			image.LastPullTime = prev.LastPullTime
+		case image.State == stvziov1.ImageStateAvailable:
+			image.LastPullTime = &now
+		}
+
+		images = append(images, image)
+	}
+
+	sort.Slice(images, func(i, j int) bool {
+		return images[i].Name < images[j].Name
+	})
+
+	return images
+}
@@ -0,0 +1,69 @@
+// Copyright 2024 Coral Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package agent
+
+import (
+	"errors"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	runtime "k8s.io/cri-api/pkg/apis/runtime/v1"
+	stvziov1 "stvz.io/coral/pkg/apis/stvz.io/v1"
+)
+
+var _ = Describe("Agent", func() {
+	Describe("NodeImages", func() {
+		It("should build the node images from the state", func() {
+			backoff := NewBackoff(time.Second, time.Minute)
+			backoff.Failure("image2", errors.New("not found"))
+
+			state := map[string]string{
+				"image2": "pending",
+				"image1": "available",
+			}
+			nodeImages := map[string]*runtime.Image{
+				"image1": {Id: "sha256:1", RepoDigests: []string{"image1@sha256:1"}, Size_: 1024},
+			}
+			now := metav1.Now()
+
+			images := NodeImages(state, map[string]stvziov1.NodeImage{}, nodeImages, backoff, now)
+			Expect(images).To(HaveLen(2))
+			Expect(images[0].Name).To(Equal("image1"))
+			Expect(images[0].Label).To(Equal(stvziov1.HashedImageLabelKey("image1")))
+			Expect(images[0].State).To(Equal(stvziov1.ImageStateAvailable))
+			Expect(images[0].Digest).To(Equal("image1@sha256:1"))
+			Expect(images[0].Size).To(Equal(int64(1024)))
+			Expect(images[0].LastPullTime).To(Equal(&now))
+			Expect(images[1].Name).To(Equal("image2"))
+			Expect(images[1].State).To(Equal(stvziov1.ImageStatePending))
+			Expect(images[1].LastPullTime).To(BeNil())
+			Expect(images[1].LastError).To(Equal("not found"))
+		})
+
+		It("should keep the last pull time from the previous state", func() {
+			backoff := NewBackoff(time.Second, time.Minute)
+			then := metav1.NewTime(time.Now().Add(-time.Hour))
+			previous := map[string]stvziov1.NodeImage{
+				"image1": {Name: "image1", LastPullTime: &then},
+			}
+
+			images := NodeImages(map[string]string{"image1": "available"}, previous, nil, backoff, metav1.Now())
+			Expect(images).To(HaveLen(1))
+			Expect(images[0].LastPullTime).To(Equal(&then))
+		})
+	})
+})
@@ -17,6 +17,7 @@ package agent
 import (
 	"strings"
 
+	runtime "k8s.io/cri-api/pkg/apis/runtime/v1"
 	stvziov1 "stvz.io/coral/pkg/apis/stvz.io/v1"
 	"stvz.io/coral/pkg/util"
 )
@@ -38,6 +39,93 @@ func UpdateState(nodeImages map[string]string, managedImages map[string]string)
 	return state
 }
 
+// ErrorState moves any pending image that has failed at least maxFailures times into
+// the error state.  A maxFailures value of zero or less disables the error state.
+func ErrorState(state map[string]string, backoff *Backoff, maxFailures int) map[string]string {
+	if maxFailures <= 0 {
+		return state
+	}
+
+	for k, v := range state {
+		if v != string(stvziov1.ImageStatePending) {
+			continue
+		}
+
+		if backoff.Failures(k) >= maxFailures {
+			state[k] = string(stvziov1.ImageStateError)
+		}
+	}
+
+	return state
+}
+
+// StaleState moves any available image into the stale state when the digest resolved
+// upstream is not one of the repository digests of the image on the node.  Images
+// without a resolved digest are left alone.
+func StaleState(state map[string]string, nodeImages map[string]*runtime.Image, digests map[string]string) map[string]string {
+	for k, v := range state {
+		if v != string(stvziov1.ImageStateAvailable) {
+			continue
+		}
+
+		digest := digests[k]
+		img, ok := nodeImages[k]
+		if digest == "" || !ok {
+			continue
+		}
+
+		if !hasDigest(img, digest) {
+			state[k] = string(stvziov1.ImageStateStale)
+		}
+	}
+
+	return state
+}
+
+func hasDigest(img *runtime.Image, digest string) bool {
+	for _, rd := range img.RepoDigests {
+		if strings.HasSuffix(rd, "@"+digest) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// RemoveState returns the images that are present on the node and still carry a
+// managed label, but are no longer managed by any image resource.  These are the
+// images that the agent previously pulled and should now remove.  Images that share
+// an identifier with a managed image are skipped since removing them through the
+// runtime would also remove the managed image.
+func RemoveState(nodeLabels map[string]string, nodeImages map[string]string, managedImages map[string]string) map[string]string {
+	state := make(map[string]string)
+
+	managedIDs := make(map[string]bool)
+	for k := range managedImages {
+		if id, ok := nodeImages[k]; ok {
+			managedIDs[id] = true
+		}
+	}
+
+	for k, id := range nodeImages {
+		if _, managed := managedImages[k]; managed {
+			continue
+		}
+
+		if _, labeled := nodeLabels[stvziov1.HashedImageLabelKey(k)]; !labeled {
+			continue
+		}
+
+		if managedIDs[id] {
+			continue
+		}
+
+		state[k] = string(stvziov1.ImageStateDeleting)
+	}
+
+	return state
+}
+
 func ReplaceImageLabels(nodeLabels map[string]string, state map[string]string) map[string]string {
 	// Copy in the non-image labels
 	labels := util.FilterMapFunc(nodeLabels, func(k string, v string) bool {
@@ -15,8 +15,11 @@
 package agent
 
 import (
+	"time"
+
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	runtime "k8s.io/cri-api/pkg/apis/runtime/v1"
 	stvziov1 "stvz.io/coral/pkg/apis/stvz.io/v1"
 )
 
@@ -48,6 +51,109 @@ var _ = Describe("Agent", func() {
 			})
 		})
 
+		Context("ErrorState", func() {
+			It("should move pending images into error after the max failures", func() {
+				backoff := NewBackoff(time.Second, time.Minute)
+				backoff.Failure("image1", nil)
+				backoff.Failure("image1", nil)
+				backoff.Failure("image2", nil)
+
+				state := map[string]string{
+					"image1": "pending",
+					"image2": "pending",
+					"image3": "available",
+				}
+
+				state = ErrorState(state, backoff, 2)
+				Expect(state).To(HaveKeyWithValue("image1", "error"))
+				Expect(state).To(HaveKeyWithValue("image2", "pending"))
+				Expect(state).To(HaveKeyWithValue("image3", "available"))
+			})
+
+			It("should not set the error state if max failures is disabled", func() {
+				backoff := NewBackoff(time.Second, time.Minute)
+				backoff.Failure("image1", nil)
+
+				state := ErrorState(map[string]string{"image1": "pending"}, backoff, 0)
+				Expect(state).To(HaveKeyWithValue("image1", "pending"))
+			})
+		})
+
+		Context("StaleState", func() {
+			It("should mark available images with a different digest as stale", func() {
+				state := map[string]string{
+					"image1": "available",
+					"image2": "available",
+					"image3": "available",
+					"image4": "pending",
+				}
+				nodeImages := map[string]*runtime.Image{
+					"image1": {Id: "sha256:1", RepoDigests: []string{"image1@sha256:aaa"}},
+					"image2": {Id: "sha256:2", RepoDigests: []string{"image2@sha256:bbb"}},
+					"image3": {Id: "sha256:3", RepoDigests: []string{"image3@sha256:ccc"}},
+				}
+				digests := map[string]string{
+					"image1": "sha256:aaa",
+					"image2": "sha256:new",
+					"image4": "sha256:ddd",
+				}
+
+				state = StaleState(state, nodeImages, digests)
+				Expect(state).To(HaveKeyWithValue("image1", "available"))
+				Expect(state).To(HaveKeyWithValue("image2", "stale"))
+				Expect(state).To(HaveKeyWithValue("image3", "available"))
+				Expect(state).To(HaveKeyWithValue("image4", "pending"))
+			})
+		})
+
+		Context("RemoveState", func() {
+			It("should mark labeled images that are no longer managed for deletion", func() {
+				nodeLabels := map[string]string{
+					stvziov1.HashedImageLabelKey("image1"): "available",
+					stvziov1.HashedImageLabelKey("image2"): "available",
+				}
+				nodeImages := map[string]string{
+					"image1": "sha256:1",
+					"image2": "sha256:2",
+				}
+				managedImages := map[string]string{
+					"image1": stvziov1.HashedImageLabelKey("image1"),
+				}
+
+				state := RemoveState(nodeLabels, nodeImages, managedImages)
+				Expect(state).To(HaveLen(1))
+				Expect(state).To(HaveKeyWithValue("image2", "deleting"))
+			})
+
+			It("should not remove images that were never labeled", func() {
+				nodeLabels := map[string]string{}
+				nodeImages := map[string]string{
+					"image1": "sha256:1",
+				}
+				managedImages := map[string]string{}
+
+				state := RemoveState(nodeLabels, nodeImages, managedImages)
+				Expect(state).To(BeEmpty())
+			})
+
+			It("should not remove images that share an identifier with a managed image", func() {
+				nodeLabels := map[string]string{
+					stvziov1.HashedImageLabelKey("image1"): "available",
+					stvziov1.HashedImageLabelKey("image2"): "available",
+				}
+				nodeImages := map[string]string{
+					"image1": "sha256:1",
+					"image2": "sha256:1",
+				}
+				managedImages := map[string]string{
+					"image1": stvziov1.HashedImageLabelKey("image1"),
+				}
+
+				state := RemoveState(nodeLabels, nodeImages, managedImages)
+				Expect(state).To(BeEmpty())
+			})
+		})
+
 		Context("ReplaceImageLabels", func() {
 			It("should replace all of the image labels with the new labels", func() {
 				nodeLabels := map[string]string{
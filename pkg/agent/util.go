@@ -37,6 +37,23 @@ func GetImageIdentifiers(ctx context.Context, ims runtime.ImageServiceClient) (m
 	return ids, nil
 }
 
+// ListNodeImages returns the images on the node keyed by tag.
+func ListNodeImages(ctx context.Context, ims runtime.ImageServiceClient) (map[string]*runtime.Image, error) {
+	resp, err := ims.ListImages(ctx, &runtime.ListImagesRequest{})
+	if err != nil {
+		return nil, err
+	}
+
+	images := make(map[string]*runtime.Image)
+	for _, img := range resp.Images {
+		for _, tag := range img.RepoTags {
+			images[tag] = img
+		}
+	}
+
+	return images, nil
+}
+
 func ImageMap(ctx context.Context, ims runtime.ImageServiceClient) (map[string]string, error) {
 	resp, err := ims.ListImages(ctx, &runtime.ListImagesRequest{})
 	if err != nil {
@@ -52,3 +69,31 @@ func ImageMap(ctx context.Context, ims runtime.ImageServiceClient) (map[string]s
 
 	return tags, nil
 }
+
+// GetContainerImages returns the set of images referenced by the running containers
+// on the node.  Both the image reference and the resolved image identifier are
+// included so callers can match against either.
+func GetContainerImages(ctx context.Context, rts runtime.RuntimeServiceClient) (map[string]bool, error) {
+	resp, err := rts.ListContainers(ctx, &runtime.ListContainersRequest{
+		Filter: &runtime.ContainerFilter{
+			State: &runtime.ContainerStateValue{
+				State: runtime.ContainerState_CONTAINER_RUNNING,
+			},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	images := make(map[string]bool)
+	for _, c := range resp.Containers {
+		if c.ImageRef != "" {
+			images[c.ImageRef] = true
+		}
+		if c.Image != nil && c.Image.Image != "" {
+			images[c.Image.Image] = true
+		}
+	}
+
+	return images, nil
+}
@@ -16,6 +16,7 @@ package agent
 
 import (
 	"context"
+	"errors"
 	"time"
 
 	"github.com/go-logr/logr"
@@ -27,9 +28,11 @@ type WorkerError string
 func (e WorkerError) Error() string { return string(e) }
 
 const (
-	ErrImageNotFound WorkerError = "image not found"
-	ErrTimeout       WorkerError = "timeout"
-	WaitTimeout      WorkerError = "image wait timeout"
+	ErrImageNotFound   WorkerError = "image not found"
+	ErrImageInUse      WorkerError = "image in use"
+	ErrImageFsNotFound WorkerError = "image filesystem not found"
+	ErrTimeout         WorkerError = "timeout"
+	WaitTimeout        WorkerError = "image wait timeout"
 
 	DefaultWaitPollInterval = 2 * time.Second
 	DefaultWaitTimeout      = 5 * time.Minute
@@ -52,13 +55,13 @@ func NewWorker(id int, options *AgentOptions) *Worker {
 	}
 }
 
-func (w *Worker) Start(ctx context.Context, eq <-chan *Event, sem *Semaphore) {
+func (w *Worker) Start(ctx context.Context, eq <-chan *Event, sem *Semaphore, backoff *Backoff) {
 	for event := range eq {
-		w.process(ctx, event, sem)
+		w.process(ctx, event, sem, backoff)
 	}
 }
 
-func (w *Worker) process(ctx context.Context, event *Event, sem *Semaphore) {
+func (w *Worker) process(ctx context.Context, event *Event, sem *Semaphore, backoff *Backoff) {
 	// Make sure we only have one worker operating on an image at a time.
 	do := sem.Acquire(event.Image)
 	defer sem.Release(event.Image)
@@ -68,15 +71,30 @@ func (w *Worker) process(ctx context.Context, event *Event, sem *Semaphore) {
 		return
 	}
 
-	// nolint: gocritic
 	switch event.Operation {
 	case Pull:
 		w.log.V(10).Info("pulling image", "image", event.Image)
 		err := w.pull(ctx, event)
 		if err != nil {
-			w.log.Error(err, "failed to pull image", "image", event.Image)
+			failures := backoff.Failure(event.Image, err)
+			w.log.Error(err, "failed to pull image", "image", event.Image, "failures", failures)
+			agentImageError.WithLabelValues(event.Image, "pull").Inc()
+			return
 		}
+		backoff.Reset(event.Image)
 		w.log.V(8).Info("image pulled", "image", event.Image)
+	case Remove:
+		w.log.V(10).Info("removing image", "image", event.Image)
+		err := w.remove(ctx, event)
+		switch {
+		case errors.Is(err, ErrImageInUse):
+			w.log.V(6).Info("image is in use by a running container, skipping", "image", event.Image)
+		case err != nil:
+			w.log.Error(err, "failed to remove image", "image", event.Image)
+			agentImageError.WithLabelValues(event.Image, "remove").Inc()
+		default:
+			w.log.V(8).Info("image removed", "image", event.Image)
+		}
 	}
 }
 
@@ -94,24 +112,26 @@ func (w *Worker) pull(ctx context.Context, event *Event) error {
 	if auth, ok := w.authCache[event.Image]; ok {
 		err := w.pullImage(ctx, event.Image, auth)
 		// TODO: differentiate between auth errors and other errors.
-		if err != nil {
-			w.log.V(8).Error(err, "failed to pull image with cached credentials", "image", event.Image)
-			delete(w.authCache, event.Image)
+		if err == nil {
+			return nil
 		}
+		w.log.V(8).Error(err, "failed to pull image with cached credentials", "image", event.Image)
+		delete(w.authCache, event.Image)
 	}
 
+	var err error
 	for _, auth := range event.Auth {
 		w.log.V(4).Info("attempting to pull image with provided credentials", "image", event.Image, "username", auth.Username)
-		err := w.pullImage(ctx, event.Image, auth)
+		err = w.pullImage(ctx, event.Image, auth)
 		if err != nil {
 			continue
-		} else {
-			w.authCache[event.Image] = auth
-			return nil
 		}
+
+		w.authCache[event.Image] = auth
+		return nil
 	}
 
-	return nil
+	return err
 }
 
 func (w *Worker) pullImage(ctx context.Context, image string, auth *runtime.AuthConfig) error {
@@ -128,6 +148,54 @@ func (w *Worker) pullImage(ctx context.Context, image string, auth *runtime.Auth
 	return w.waitImage(ctx, image, true)
 }
 
+// remove will delete the image from the node.  If a running container is still using
+// the image it will be skipped and picked up again on the next interval once the
+// container has stopped.  The node label is cleared by the agent on the next run
+// after the runtime no longer reports the image.
+func (w *Worker) remove(ctx context.Context, event *Event) error {
+	inUse, err := w.inUse(ctx, event.Image)
+	if err != nil {
+		return err
+	}
+
+	if inUse {
+		return ErrImageInUse
+	}
+
+	_, err = w.ims.RemoveImage(ctx, &runtime.RemoveImageRequest{
+		Image: &runtime.ImageSpec{
+			Image: event.Image,
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	return w.waitImage(ctx, event.Image, false)
+}
+
+// inUse returns true if any running container references the image either by
+// name or by the image identifier.
+func (w *Worker) inUse(ctx context.Context, image string) (bool, error) {
+	ids, err := GetImageIdentifiers(ctx, w.ims)
+	if err != nil {
+		return false, err
+	}
+
+	id, ok := ids[image]
+	if !ok {
+		// The image is already gone.
+		return false, nil
+	}
+
+	images, err := GetContainerImages(ctx, w.rts)
+	if err != nil {
+		return false, err
+	}
+
+	return images[image] || images[id], nil
+}
+
 func (w *Worker) waitImage(ctx context.Context, image string, has bool) error {
 	timer := time.NewTicker(DefaultWaitPollInterval)
 	defer timer.Stop()
@@ -16,6 +16,7 @@ package v1
 // +kubebuilder:docs-gen:collapse=Apache License
 
 import (
+	"k8s.io/utils/ptr"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
@@ -23,15 +24,30 @@ import (
 
 func defaultedImage(obj *Image) {}
 
+func defaultedClusterImage(obj *ClusterImage) {}
+
+const (
+	DefaultRegistryHost = "localhost"
+	DefaultRegistryPort = 5000
+)
+
 func defaultedMirror(obj *Mirror) {
-	spec := obj.Spec
-	if spec.Registry == nil {
-		spec.Registry = &RegistrySpec{
-			Host:      "localhost",
-			Port:      5000,
-			TLSVerify: false,
+	// The default registry runs alongside the mirror without a certificate.
+	if obj.Spec.Registry == nil {
+		obj.Spec.Registry = &RegistrySpec{
+			Host:      DefaultRegistryHost,
+			Port:      DefaultRegistryPort,
+			TLSVerify: ptr.To(false),
 		}
 	}
+
+	if obj.Spec.Registry.Port == 0 {
+		obj.Spec.Registry.Port = DefaultRegistryPort
+	}
+
+	if obj.Spec.Registry.TLSVerify == nil {
+		obj.Spec.Registry.TLSVerify = ptr.To(true)
+	}
 }
 
 // Defaulted sets the resource defaults.
@@ -39,6 +55,8 @@ func Defaulted(obj client.Object) {
 	switch obj := obj.(type) { //nolint:gocritic
 	case *Image:
 		defaultedImage(obj)
+	case *ClusterImage:
+		defaultedClusterImage(obj)
 	case *Mirror:
 		defaultedMirror(obj)
 	}
@@ -17,6 +17,8 @@ package v1
 import (
 	"crypto/md5" // #nosec
 	"fmt"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
 const (
@@ -45,16 +47,90 @@ func (i *Image) GetImages() []string {
 	return images
 }
 
-func (i *Image) GetStatusData() []ImageData {
+// ImageObject is implemented by both the namespaced Image and the cluster scoped
+// ClusterImage resources so they can share the controller, monitor and agent logic.
+type ImageObject interface {
+	client.Object
+	// GetSelector returns the node selectors for the image.
+	GetSelector() []NodeSelector
+	// GetRepositories returns the repositories and tags managed by the image.
+	GetRepositories() Repositories
+	// GetPullSecrets returns the keys of the secrets used when pulling the image.
+	GetPullSecrets() []client.ObjectKey
+	// GetImageStatus returns a pointer to the status so it can be updated in place.
+	GetImageStatus() *ImageStatus
+	// GetStatusData returns the image data generated from the repositories.
+	GetStatusData() []ImageData
+}
+
+// NewImageData returns the image data for each of the repository tags.
+func NewImageData(repos []RepositoryStatus) []ImageData {
 	data := make([]ImageData, 0)
-	for _, image := range i.Spec.Repositories {
-		for _, tag := range image.Tags {
+	for _, repo := range repos {
+		for _, tag := range repo.Tags {
+			name := fmt.Sprintf("%s:%s", repo.Name, tag)
 			data = append(data, ImageData{
-				Name:  image.GetRepoTag(tag),
-				Label: image.GetLabel(tag),
+				Name:  name,
+				Label: HashedImageLabelKey(name),
 			})
 		}
 	}
 
 	return data
 }
+
+func (i *Image) GetSelector() []NodeSelector {
+	return i.Spec.Selector
+}
+
+func (i *Image) GetRepositories() Repositories {
+	return i.Spec.Repositories
+}
+
+// GetPullSecrets returns the pull secrets which are always in the namespace of the
+// image.
+func (i *Image) GetPullSecrets() []client.ObjectKey {
+	keys := make([]client.ObjectKey, len(i.Spec.ImagePullSecrets))
+	for n, s := range i.Spec.ImagePullSecrets {
+		keys[n] = client.ObjectKey{Name: s.Name, Namespace: i.Namespace}
+	}
+
+	return keys
+}
+
+func (i *Image) GetImageStatus() *ImageStatus {
+	return &i.Status
+}
+
+func (i *Image) GetStatusData() []ImageData {
+	return NewImageData(i.Spec.Repositories.Explicit())
+}
+
+func (i *ClusterImage) GetSelector() []NodeSelector {
+	return i.Spec.Selector
+}
+
+func (i *ClusterImage) GetRepositories() Repositories {
+	return i.Spec.Repositories
+}
+
+// GetPullSecrets returns the pull secrets referenced by namespace and name.
+func (i *ClusterImage) GetPullSecrets() []client.ObjectKey {
+	keys := make([]client.ObjectKey, len(i.Spec.ImagePullSecrets))
+	for n, s := range i.Spec.ImagePullSecrets {
+		keys[n] = client.ObjectKey{Name: s.Name, Namespace: s.Namespace}
+	}
+
+	return keys
+}
+
+func (i *ClusterImage) GetImageStatus() *ImageStatus {
+	return &i.Status
+}
+
+func (i *ClusterImage) GetStatusData() []ImageData {
+	return NewImageData(i.Spec.Repositories.Explicit())
+}
+
+var _ ImageObject = &Image{}
+var _ ImageObject = &ClusterImage{}
@@ -0,0 +1,51 @@
+// Copyright 2024 Coral Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// Matches returns true if the workload labels match the object selector.
+func (p *InjectionPolicySpec) Matches(objLabels map[string]string) (bool, error) {
+	return selectorMatches(p.ObjectSelector, objLabels)
+}
+
+// Matches returns true if the namespace and workload labels match the namespace and
+// object selectors.
+func (p *ClusterInjectionPolicySpec) Matches(nsLabels, objLabels map[string]string) (bool, error) {
+	ok, err := selectorMatches(p.NamespaceSelector, nsLabels)
+	if err != nil || !ok {
+		return false, err
+	}
+
+	return p.InjectionPolicySpec.Matches(objLabels)
+}
+
+// selectorMatches returns true if the labels match the selector.  A nil selector
+// matches everything.
+func selectorMatches(selector *metav1.LabelSelector, l map[string]string) (bool, error) {
+	if selector == nil {
+		return true, nil
+	}
+
+	s, err := metav1.LabelSelectorAsSelector(selector)
+	if err != nil {
+		return false, err
+	}
+
+	return s.Matches(labels.Set(l)), nil
+}
@@ -0,0 +1,81 @@
+// Copyright 2024 Coral Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("InjectionPolicy", func() {
+	Context("Matches", func() {
+		It("should match every workload without an object selector", func() {
+			p := &InjectionPolicySpec{}
+			ok, err := p.Matches(map[string]string{"app": "web"})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ok).To(BeTrue())
+		})
+
+		It("should match the workload labels against the object selector", func() {
+			p := &InjectionPolicySpec{
+				ObjectSelector: &metav1.LabelSelector{
+					MatchLabels: map[string]string{"app": "web"},
+				},
+			}
+			ok, err := p.Matches(map[string]string{"app": "web"})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ok).To(BeTrue())
+
+			ok, err = p.Matches(map[string]string{"app": "db"})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ok).To(BeFalse())
+		})
+
+		It("should require both the namespace and object selectors to match", func() {
+			p := &ClusterInjectionPolicySpec{
+				NamespaceSelector: &metav1.LabelSelector{
+					MatchExpressions: []metav1.LabelSelectorRequirement{
+						{Key: "env", Operator: metav1.LabelSelectorOpIn, Values: []string{"production"}},
+					},
+				},
+				InjectionPolicySpec: InjectionPolicySpec{
+					ObjectSelector: &metav1.LabelSelector{
+						MatchLabels: map[string]string{"app": "web"},
+					},
+				},
+			}
+			ok, err := p.Matches(map[string]string{"env": "production"}, map[string]string{"app": "web"})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ok).To(BeTrue())
+
+			ok, err = p.Matches(map[string]string{"env": "staging"}, map[string]string{"app": "web"})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ok).To(BeFalse())
+		})
+
+		It("should return an error for an invalid selector", func() {
+			p := &InjectionPolicySpec{
+				ObjectSelector: &metav1.LabelSelector{
+					MatchExpressions: []metav1.LabelSelectorRequirement{
+						{Key: "app", Operator: "Near"},
+					},
+				},
+			}
+			_, err := p.Matches(map[string]string{"app": "web"})
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
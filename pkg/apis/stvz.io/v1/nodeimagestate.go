@@ -0,0 +1,46 @@
+// Copyright 2024 Coral Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1
+
+// ImageMap returns the node images keyed by the image name.
+func (n *NodeImageState) ImageMap() map[string]NodeImage {
+	images := make(map[string]NodeImage)
+	for _, image := range n.Status.Images {
+		images[image.Name] = image
+	}
+
+	return images
+}
+
+// StateByLabel returns the state of each node image keyed by the image label.
+func (n *NodeImageState) StateByLabel() map[string]string {
+	states := make(map[string]string)
+	for _, image := range n.Status.Images {
+		states[image.Label] = string(image.State)
+	}
+
+	return states
+}
+
+// HasLabel returns true if any of the node images are tracked by the label.
+func (n *NodeImageState) HasLabel(label string) bool {
+	for _, image := range n.Status.Images {
+		if image.Label == label {
+			return true
+		}
+	}
+
+	return false
+}
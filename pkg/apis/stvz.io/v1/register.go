@@ -51,10 +51,18 @@ var (
 // addKnownTypes adds a list of known types to the scheme.
 func addKnownTypes(scheme *runtime.Scheme) error {
 	scheme.AddKnownTypes(SchemeGroupVersion,
+		&ClusterImage{},
+		&ClusterImageList{},
+		&ClusterInjectionPolicy{},
+		&ClusterInjectionPolicyList{},
 		&Image{},
 		&ImageList{},
+		&InjectionPolicy{},
+		&InjectionPolicyList{},
 		&Mirror{},
 		&MirrorList{},
+		&NodeImageState{},
+		&NodeImageStateList{},
 	)
 	metav1.AddToGroupVersion(scheme, SchemeGroupVersion)
 	return nil
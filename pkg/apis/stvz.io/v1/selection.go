@@ -0,0 +1,196 @@
+// Copyright 2024 Coral Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/blang/semver/v4"
+)
+
+// Validate checks that the expressions and constraint in the selection can be
+// parsed.
+func (s *TagSelection) Validate() error {
+	if _, err := s.matcher(); err != nil {
+		return err
+	}
+
+	if s.Latest < 0 {
+		return fmt.Errorf("latest must not be negative")
+	}
+
+	switch s.SortBy {
+	case "", TagSortSemver, TagSortCreated:
+	default:
+		return fmt.Errorf("unsupported sort: %s", s.SortBy)
+	}
+
+	return nil
+}
+
+// Filter returns the tags that match the include and exclude expressions and the
+// semantic version constraint.  The order of the tags is preserved.
+func (s *TagSelection) Filter(tags []string) ([]string, error) {
+	match, err := s.matcher()
+	if err != nil {
+		return nil, err
+	}
+
+	selected := make([]string, 0)
+	for _, tag := range tags {
+		if match(tag) {
+			selected = append(selected, tag)
+		}
+	}
+
+	return selected, nil
+}
+
+// Newest returns the newest N tags when Latest is set, otherwise the tags are returned
+// unchanged.  When sorting by creation time, the created function is used to look up
+// the time the image was created.
+func (s *TagSelection) Newest(tags []string, created func(string) (time.Time, error)) ([]string, error) {
+	if s.Latest == 0 || len(tags) <= s.Latest {
+		return tags, nil
+	}
+
+	sorted := make([]string, len(tags))
+	copy(sorted, tags)
+
+	switch s.SortBy {
+	case TagSortCreated:
+		times := make(map[string]time.Time, len(tags))
+		for _, tag := range tags {
+			t, err := created(tag)
+			if err != nil {
+				return nil, err
+			}
+			times[tag] = t
+		}
+
+		sort.SliceStable(sorted, func(i, j int) bool {
+			return times[sorted[i]].After(times[sorted[j]])
+		})
+	default:
+		SortNewest(sorted)
+	}
+
+	return sorted[:s.Latest], nil
+}
+
+// SortNewest sorts the tags in place from the newest to the oldest semantic version.
+// Tags that are not valid versions sort after all of the versioned tags.
+func SortNewest(tags []string) {
+	sort.SliceStable(tags, func(i, j int) bool {
+		vi, erri := semver.ParseTolerant(tags[i])
+		vj, errj := semver.ParseTolerant(tags[j])
+		switch {
+		case erri != nil && errj != nil:
+			return tags[i] > tags[j]
+		case erri != nil:
+			return false
+		case errj != nil:
+			return true
+		}
+		return vi.GT(vj)
+	})
+}
+
+func (s *TagSelection) matcher() (func(string) bool, error) {
+	var include, exclude *regexp.Regexp
+	var constraint semver.Range
+	var err error
+
+	if s.Include != "" {
+		if include, err = regexp.Compile(s.Include); err != nil {
+			return nil, err
+		}
+	}
+
+	if s.Exclude != "" {
+		if exclude, err = regexp.Compile(s.Exclude); err != nil {
+			return nil, err
+		}
+	}
+
+	if s.SemVer != "" {
+		if constraint, err = semver.ParseRange(tolerantRange(s.SemVer)); err != nil {
+			return nil, err
+		}
+	}
+
+	return func(tag string) bool {
+		if include != nil && !include.MatchString(tag) {
+			return false
+		}
+
+		if exclude != nil && exclude.MatchString(tag) {
+			return false
+		}
+
+		if constraint != nil {
+			v, err := semver.ParseTolerant(tag)
+			if err != nil || len(v.Pre) > 0 || !constraint(v) {
+				return false
+			}
+		}
+
+		return true
+	}, nil
+}
+
+// tolerantRange fills in short versions in a range so constraints like ">=1.24 <2"
+// can be used, and joins operators separated from their version by whitespace such
+// as ">= 1.24".  The semver package requires full versions in ranges.
+func tolerantRange(r string) string {
+	var parts []string
+	pending := ""
+	for _, part := range strings.Fields(r) {
+		if part != "||" && strings.Trim(part, "<>=!") == "" {
+			pending += part
+			continue
+		}
+		parts = append(parts, pending+part)
+		pending = ""
+	}
+	if pending != "" {
+		parts = append(parts, pending)
+	}
+
+	for i, part := range parts {
+		if part == "||" || strings.Contains(part, "x") {
+			continue
+		}
+
+		version := strings.TrimLeft(part, "<>=!")
+		op := part[:len(part)-len(version)]
+		version = strings.TrimPrefix(version, "v")
+		if version == "" {
+			continue
+		}
+
+		if n := strings.Count(version, "."); n < 2 && !strings.ContainsAny(version, "+-") {
+			version += strings.Repeat(".0", 2-n)
+		}
+
+		parts[i] = op + version
+	}
+
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,116 @@
+// Copyright 2024 Coral Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("TagSelection", func() {
+	tags := []string{"1.23.4", "1.24.0", "v1.25.1", "1.26.0-rc.1", "2.0.0", "latest", "1.25-alpine"}
+
+	Context("Filter", func() {
+		It("should filter the tags with the include and exclude expressions", func() {
+			s := &TagSelection{
+				Include: `^v?1\.`,
+				Exclude: `-(rc|alpine)`,
+			}
+			selected, err := s.Filter(tags)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(selected).To(Equal([]string{"1.23.4", "1.24.0", "v1.25.1"}))
+		})
+
+		It("should filter the tags with a short semver constraint", func() {
+			s := &TagSelection{
+				SemVer: ">=1.24 <2",
+			}
+			selected, err := s.Filter(tags)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(selected).To(Equal([]string{"1.24.0", "v1.25.1"}))
+		})
+
+		It("should allow whitespace between the operators and versions", func() {
+			s := &TagSelection{
+				SemVer: ">= 1.24 < 2",
+			}
+			selected, err := s.Filter(tags)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(selected).To(Equal([]string{"1.24.0", "v1.25.1"}))
+		})
+
+		It("should return an error for an invalid expression", func() {
+			s := &TagSelection{
+				Include: `(`,
+			}
+			_, err := s.Filter(tags)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("Newest", func() {
+		It("should return the newest tags by semver", func() {
+			s := &TagSelection{
+				Latest: 2,
+			}
+			selected, err := s.Newest([]string{"1.23.4", "latest", "2.0.0", "v1.25.1"}, nil)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(selected).To(Equal([]string{"2.0.0", "v1.25.1"}))
+		})
+
+		It("should return the newest tags by creation time", func() {
+			now := time.Now()
+			created := map[string]time.Time{
+				"a": now.Add(-2 * time.Hour),
+				"b": now,
+				"c": now.Add(-1 * time.Hour),
+			}
+			s := &TagSelection{
+				Latest: 2,
+				SortBy: TagSortCreated,
+			}
+			selected, err := s.Newest([]string{"a", "b", "c"}, func(tag string) (time.Time, error) {
+				return created[tag], nil
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(selected).To(Equal([]string{"b", "c"}))
+		})
+
+		It("should return all of the tags when latest is not set", func() {
+			s := &TagSelection{}
+			selected, err := s.Newest([]string{"a", "b"}, nil)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(selected).To(Equal([]string{"a", "b"}))
+		})
+	})
+
+	Context("Validate", func() {
+		It("should fail with an unsupported sort", func() {
+			s := &TagSelection{
+				SortBy: "name",
+			}
+			Expect(s.Validate()).To(HaveOccurred())
+		})
+
+		It("should fail with an invalid constraint", func() {
+			s := &TagSelection{
+				SemVer: ">=abc",
+			}
+			Expect(s.Validate()).To(HaveOccurred())
+		})
+	})
+})
@@ -19,6 +19,7 @@ import (
 	"fmt"
 
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/selection"
 )
@@ -27,6 +28,8 @@ import (
 
 const (
 	Finalizer = "image.stvz.io/finalizer"
+	// MirrorFinalizer is the finalizer added to mirrors by the mirror controller.
+	MirrorFinalizer = "mirror.stvz.io/finalizer"
 )
 
 type NodeSelector struct {
@@ -41,27 +44,145 @@ const (
 	ListSelectorAll ListSelector = "all"
 )
 
+type PlatformMode string
+
+const (
+	// PlatformModeAll copies every instance in a manifest list and preserves the list
+	// digest.
+	PlatformModeAll PlatformMode = "all"
+	// PlatformModeSystem copies only the instance matching the platform of the mirror.
+	PlatformModeSystem PlatformMode = "system"
+	// PlatformModeList copies the instances matching the listed platforms.
+	PlatformModeList PlatformMode = "list"
+)
+
+// Platform is an os, architecture and optional variant such as linux/arm64/v8.
+type Platform struct {
+	// +required
+	// OS is the operating system, for example linux.
+	OS string `json:"os"`
+	// +required
+	// Architecture is the cpu architecture, for example amd64 or arm64.
+	Architecture string `json:"architecture"`
+	// +optional
+	// Variant is the cpu variant, for example v7 or v8.  When it's not set, any
+	// variant matches.
+	Variant string `json:"variant,omitempty"`
+}
+
+func (p Platform) String() string {
+	if p.Variant == "" {
+		return p.OS + "/" + p.Architecture
+	}
+	return p.OS + "/" + p.Architecture + "/" + p.Variant
+}
+
+// Matches returns true if the platform matches the os, architecture and variant.
+func (p Platform) Matches(os, arch, variant string) bool {
+	return p.OS == os && p.Architecture == arch && (p.Variant == "" || p.Variant == variant)
+}
+
+// PlatformSelection selects the instances copied from a multi-arch image.
+type PlatformSelection struct {
+	// +required
+	// +kubebuilder:validation:Enum=all;system;list
+	// Mode is how the platforms are selected.  It's default is all.
+	Mode PlatformMode `json:"mode"`
+	// +optional
+	// List is the platforms to copy when the mode is list.
+	List []Platform `json:"list,omitempty"`
+}
+
+type TagSort string
+
+const (
+	TagSortSemver  TagSort = "semver"
+	TagSortCreated TagSort = "created"
+)
+
+// TagSelection selects tags from the list of tags available in the upstream
+// repository.  All of the configured filters must match for a tag to be selected.
+type TagSelection struct {
+	// +optional
+	// Include is a regular expression that the tags must match.
+	Include string `json:"include,omitempty"`
+	// +optional
+	// Exclude is a regular expression for tags that will be skipped.
+	Exclude string `json:"exclude,omitempty"`
+	// +optional
+	// SemVer is a semantic version constraint such as ">=1.24 <2".  When set, tags
+	// that are not valid semantic versions and pre-releases are skipped.
+	SemVer string `json:"semver,omitempty"`
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	// Latest limits the selection to the newest N tags.  Zero selects all of the
+	// matching tags.
+	Latest int `json:"latest,omitempty"`
+	// +optional
+	// +kubebuilder:validation:Enum=semver;created
+	// SortBy is how the newest tags are determined.  It's default is semver.
+	SortBy TagSort `json:"sortBy,omitempty"`
+}
+
 // RepositorySpec is the spec for a Repository resource.
 type RepositorySpec struct {
 	// +required
 	// Name is the repository name that will be used.
 	Name *string `json:"name"`
-	// +required
-	// +kubebuilder:validation:MinItems=1
+	// +optional
 	// +kubebuilder:validation:MaxItems=100
 	// Tags are the repository tags that will be acted on.
 	Tags []string `json:"tags"`
 	// +optional
+	// Selection selects additional tags from the upstream repository.  The selected
+	// tags are resolved by the controller and written to the status.
+	Selection *TagSelection `json:"selection,omitempty"`
+	// +optional
+	// +kubebuilder:validation:Enum="";all
 	// ListSelection is the type of selection used when syncing a repository.  It
-	// is currently unused, however, in the future it will be used by the mirror
-	// as a shortcut to sync all tags in a repository.  When 'all' is specified,
-	// any tags defined are ignored. Most likely it will be excluded from pulls on
-	// the node agent due to potential space constraints.
+	// is only used by the mirror as a shortcut to sync all tags in a repository.
+	// When 'all' is specified, any tags defined are ignored.  It is rejected on
+	// images since the node agent never pulls every tag due to space constraints.
 	ListSelection ListSelector `json:"listSelection"`
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	// MaxTags limits the number of tags mirrored when all tags are selected.  The
+	// newest tags are preferred.  Zero is unlimited.
+	MaxTags int `json:"maxTags,omitempty"`
+	// +optional
+	// MaxSize limits the total compressed size of the tags mirrored when all tags
+	// are selected.  Tags are added newest first until the limit is reached.
+	MaxSize *resource.Quantity `json:"maxSize,omitempty"`
+	// +optional
+	// Platforms overrides the mirror platform selection for the repository.
+	Platforms *PlatformSelection `json:"platforms,omitempty"`
 }
 
 type Repositories []RepositorySpec
 
+// RepositoryStatus is the concrete list of tags for a repository after any tag
+// selection has been resolved.
+type RepositoryStatus struct {
+	// +required
+	// Name is the repository name.
+	Name string `json:"name"`
+	// +optional
+	// Tags are the resolved tags.
+	Tags []string `json:"tags"`
+}
+
+// Explicit returns the repositories using only the explicitly defined tags.
+func (r Repositories) Explicit() []RepositoryStatus {
+	repos := make([]RepositoryStatus, len(r))
+	for i, repo := range r {
+		repos[i] = RepositoryStatus{
+			Name: *repo.Name,
+			Tags: repo.Tags,
+		}
+	}
+	return repos
+}
+
 func (r Repositories) NormalizedList() ([]string, error) {
 	var list []string
 	for _, repo := range r {
@@ -99,6 +220,8 @@ type ImageSpec struct {
 // +kubebuilder:printcolumn:name="Images",type="integer",JSONPath=".status.totalImages",description="The number of total images managed by the object"
 // +kubebuilder:printcolumn:name="Available",type="integer",JSONPath=".status.condition.available",description="The number of images that are currently available on the nodes"
 // +kubebuilder:printcolumn:name="Pending",type="integer",JSONPath=".status.condition.pending",description="The number of images that are currently pending on the nodes"
+// +kubebuilder:printcolumn:name="Error",type="integer",JSONPath=".status.condition.error",description="The number of images that have failed to be pulled on the nodes"
+// +kubebuilder:printcolumn:name="Stale",type="integer",JSONPath=".status.condition.stale",description="The number of images on the nodes that no longer match the upstream digest",priority=1
 // +kubebuilder:printcolumn:name="Unknown",type="integer",JSONPath=".status.condition.unknown",description="The number of images that are in an unknown state on the nodes",priority=1
 // +kubebuilder:printcolumn:name="Nodes",type="integer",JSONPath=".status.totalNodes",description="The number of nodes matching the selector (if any)",priority=1
 // +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
@@ -120,11 +243,64 @@ type ImageList struct {
 	Items           []Image `json:"items"`
 }
 
+// ClusterImageSpec is the spec for a ClusterImage resource.  It mirrors the ImageSpec,
+// but since the resource is not namespaced the pull secrets must reference both the
+// namespace and the name of the secret.
+type ClusterImageSpec struct {
+	// +optional
+	// +nullable
+	// Selector defines which nodes the image should be synced to.
+	Selector []NodeSelector `json:"selector"`
+	// +required
+	Repositories Repositories `json:"repositories"`
+	// +optional
+	// +nullable
+	// ImagePullSecrets is a list of secrets to use when pulling the image.
+	ImagePullSecrets []corev1.SecretReference `json:"imagePullSecrets"`
+}
+
+// +genclient
+// +genclient:nonNamespaced
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+// +k8s:defaulter-gen=true
+// +kubebuilder:validation:Required
+// +kubebuilder:subresource:status
+// +kubebuilder:resource:scope=Cluster,shortName=cimg,singular=clusterimage
+// +kubebuilder:printcolumn:name="Images",type="integer",JSONPath=".status.totalImages",description="The number of total images managed by the object"
+// +kubebuilder:printcolumn:name="Available",type="integer",JSONPath=".status.condition.available",description="The number of images that are currently available on the nodes"
+// +kubebuilder:printcolumn:name="Pending",type="integer",JSONPath=".status.condition.pending",description="The number of images that are currently pending on the nodes"
+// +kubebuilder:printcolumn:name="Error",type="integer",JSONPath=".status.condition.error",description="The number of images that have failed to be pulled on the nodes"
+// +kubebuilder:printcolumn:name="Stale",type="integer",JSONPath=".status.condition.stale",description="The number of images on the nodes that no longer match the upstream digest",priority=1
+// +kubebuilder:printcolumn:name="Unknown",type="integer",JSONPath=".status.condition.unknown",description="The number of images that are in an unknown state on the nodes",priority=1
+// +kubebuilder:printcolumn:name="Nodes",type="integer",JSONPath=".status.totalNodes",description="The number of nodes matching the selector (if any)",priority=1
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+
+// ClusterImage is an external image that will be mirrored to each configured node
+// across the cluster without being tied to a namespace.
+type ClusterImage struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Spec              ClusterImageSpec `json:"spec"`
+	// +optional
+	Status ImageStatus `json:"status"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+type ClusterImageList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ClusterImage `json:"items"`
+}
+
 type ImageState string
 
 const (
 	ImageStatePending   ImageState = "pending"
 	ImageStateAvailable ImageState = "available"
+	ImageStateDeleting  ImageState = "deleting"
+	ImageStateError     ImageState = "error"
+	ImageStateStale     ImageState = "stale"
 	ImageStateUnknown   ImageState = "unknown"
 )
 
@@ -139,6 +315,10 @@ type ImageData struct {
 	// +required
 	// Label is the label that is used to track the image on the node.
 	Label string `json:"label"`
+	// +optional
+	// Digest is the manifest digest that the tag resolved to in the upstream
+	// registry.  Nodes with the tag pointing at a different digest are stale.
+	Digest string `json:"digest,omitempty"`
 }
 
 type ImageCondition struct {
@@ -151,6 +331,14 @@ type ImageCondition struct {
 	// +required
 	// Unknown is the number of images that are in an unknown state on the nodes.
 	Unknown int `json:"unknown"`
+	// +optional
+	// Error is the number of images that have repeatedly failed to be pulled on the
+	// nodes.
+	Error int `json:"error"`
+	// +optional
+	// Stale is the number of images on the nodes that no longer match the digest
+	// resolved from the upstream registry.
+	Stale int `json:"stale"`
 }
 
 // WatchStatus is the status for a WatchSet resource.
@@ -167,6 +355,68 @@ type ImageStatus struct {
 	// +optional
 	// Data is a list of image data that will be used to track the images on the nodes.
 	Data []ImageData `json:"data"`
+	// +optional
+	// Repositories are the repositories with any tag selections resolved.
+	Repositories []RepositoryStatus `json:"repositories,omitempty"`
+}
+
+// NodeImage is the state of a single managed image on a node.
+type NodeImage struct {
+	// +required
+	// Name is the name of the image in NAME:TAG format.
+	Name string `json:"name"`
+	// +required
+	// Label is the hashed label that is used to track the image.
+	Label string `json:"label"`
+	// +required
+	// State is the current state of the image on the node.
+	State ImageState `json:"state"`
+	// +optional
+	// Digest is the repository digest of the image reported by the runtime.
+	Digest string `json:"digest,omitempty"`
+	// +optional
+	// Size is the size of the image in bytes reported by the runtime.
+	Size int64 `json:"size,omitempty"`
+	// +optional
+	// LastPullTime is the time the agent first observed the image on the node after
+	// it was pulled.
+	LastPullTime *metav1.Time `json:"lastPullTime,omitempty"`
+	// +optional
+	// LastError is the last error that occurred while pulling the image.
+	LastError string `json:"lastError,omitempty"`
+}
+
+type NodeImageStateStatus struct {
+	// +optional
+	// TotalImages is the number of images managed on the node.
+	TotalImages int `json:"totalImages"`
+	// +optional
+	// Images is the list of managed images and their states on the node.
+	Images []NodeImage `json:"images"`
+}
+
+// +genclient
+// +genclient:nonNamespaced
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+// +kubebuilder:resource:scope=Cluster,shortName=nis,singular=nodeimagestate
+// +kubebuilder:printcolumn:name="Images",type="integer",JSONPath=".status.totalImages",description="The number of images managed on the node"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+
+// NodeImageState tracks the state of every managed image on a single node.  It is
+// owned by the agent running on the node and shares the name of the node.
+type NodeImageState struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	// +optional
+	Status NodeImageStateStatus `json:"status"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+type NodeImageStateList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []NodeImageState `json:"items"`
 }
 
 type RegistrySpec struct {
@@ -178,12 +428,43 @@ type RegistrySpec struct {
 	Port int `json:"port"`
 	// +optional
 	// TLSVerify is a flag to enable or disable tls verification.  Default is true.
-	TLSVerify bool `json:"tlsVerify"`
-	// Maybe we should add the creds here.
+	TLSVerify *bool `json:"tlsVerify,omitempty"`
+	// +optional
+	// CredentialsSecret is a secret in the mirror namespace with the credentials for
+	// the registry.  Both docker config and basic auth secrets are supported.
+	CredentialsSecret *corev1.LocalObjectReference `json:"credentialsSecret,omitempty"`
+	// +optional
+	// CA is the CA bundle used to verify the registry certificate.
+	CA *CABundleSource `json:"ca,omitempty"`
+	// +optional
+	// ClientCertSecret is a kubernetes.io/tls secret in the mirror namespace with the
+	// client certificate and key used for mutual TLS.
+	ClientCertSecret *corev1.LocalObjectReference `json:"clientCertSecret,omitempty"`
+}
+
+// CABundleSource references a CA bundle in either a ConfigMap or a Secret.  Only one
+// of the sources may be set.
+type CABundleSource struct {
+	// +optional
+	// ConfigMapKeyRef selects the key in a ConfigMap containing the CA bundle.
+	ConfigMapKeyRef *corev1.ConfigMapKeySelector `json:"configMapKeyRef,omitempty"`
+	// +optional
+	// SecretKeyRef selects the key in a Secret containing the CA bundle.
+	SecretKeyRef *corev1.SecretKeySelector `json:"secretKeyRef,omitempty"`
+}
+
+// VerifyTLS returns true unless tls verification has been explicitly disabled.
+func (r *RegistrySpec) VerifyTLS() bool {
+	return r.TLSVerify == nil || *r.TLSVerify
 }
 
 func (r *RegistrySpec) URL() string {
-	return fmt.Sprintf("docker://%s:%d", r.Host, r.Port)
+	return "docker://" + r.Address()
+}
+
+// Address returns the host and port of the registry.
+func (r *RegistrySpec) Address() string {
+	return fmt.Sprintf("%s:%d", r.Host, r.Port)
 }
 
 type MirrorSpec struct {
@@ -197,6 +478,23 @@ type MirrorSpec struct {
 	// +nullable
 	// ImagePullSecrets is a list of secrets to use when pulling the image.
 	ImagePullSecrets []corev1.LocalObjectReference `json:"imagePullSecrets"`
+	// +optional
+	// Platforms selects the instances copied from multi-arch images.  Every instance
+	// is copied when it's not set.
+	Platforms *PlatformSelection `json:"platforms,omitempty"`
+}
+
+// PlatformsFor returns the platform selection for the repository.  The repository
+// selection takes precedence over the mirror selection.
+func (m *MirrorSpec) PlatformsFor(repo RepositorySpec) PlatformSelection {
+	switch {
+	case repo.Platforms != nil:
+		return *repo.Platforms
+	case m.Platforms != nil:
+		return *m.Platforms
+	}
+
+	return PlatformSelection{Mode: PlatformModeAll}
 }
 
 // +genclient
@@ -205,12 +503,16 @@ type MirrorSpec struct {
 // +kubebuilder:validation:Required
 // +kubebuilder:subresource:status
 // +kubebuilder:resource:scope=Namespaced,shortName=mi,singular=mirror
+// +kubebuilder:printcolumn:name="Ready",type="string",JSONPath=".status.conditions[?(@.type==\"Ready\")].status",description="Whether all of the images have been mirrored"
 // +kubebuilder:printcolumn:name="Images",type="integer",JSONPath=".status.totalImages",description="The number of total images managed by the object"
+// +kubebuilder:printcolumn:name="Synced",type="integer",JSONPath=".status.syncedImages",description="The number of images that have been mirrored"
+// +kubebuilder:printcolumn:name="Failed",type="integer",JSONPath=".status.failedImages",description="The number of images that have failed to be mirrored"
+// +kubebuilder:printcolumn:name="Reason",type="string",JSONPath=".status.conditions[?(@.type==\"Ready\")].reason",description="The reason the mirror is not ready",priority=1
 // +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
 
-// Mirror is a resource defining images that will be mirrored to the local registry.  Currently
-// the mirror requires that all images be defined.  In future iterations we'll support mirroring
-// all images from an external registry.
+// Mirror is a resource defining images that will be mirrored to the local registry.  Tags can
+// be listed explicitly, selected from the upstream tags, or all tags in the repository can be
+// mirrored.
 type Mirror struct {
 	metav1.TypeMeta   `json:",inline"`
 	metav1.ObjectMeta `json:"metadata,omitempty"`
@@ -219,10 +521,77 @@ type Mirror struct {
 	Status MirrorStatus `json:"status"`
 }
 
+// MirrorImageState is the sync state of a mirrored image.
+type MirrorImageState string
+
+const (
+	MirrorImageStatePending MirrorImageState = "pending"
+	MirrorImageStateSynced  MirrorImageState = "synced"
+	MirrorImageStateFailed  MirrorImageState = "failed"
+)
+
+// Mirror condition types.
+const (
+	// MirrorConditionReady is true when the registry is reachable and all of the
+	// images have been mirrored.
+	MirrorConditionReady = "Ready"
+	// MirrorConditionSyncing is true while there are images waiting to be mirrored.
+	MirrorConditionSyncing = "Syncing"
+	// MirrorConditionDegraded is true when the registry can't be reached or images
+	// have failed to be mirrored.
+	MirrorConditionDegraded = "Degraded"
+)
+
+// MirrorImageStatus is the sync status of a single mirrored image.
+type MirrorImageStatus struct {
+	// +required
+	// Name is the normalized name of the source image including the tag.
+	Name string `json:"name"`
+	// +optional
+	// SourceDigest is the digest of the image in the upstream registry.
+	SourceDigest string `json:"sourceDigest,omitempty"`
+	// +optional
+	// DestinationDigest is the digest of the image in the local registry.
+	DestinationDigest string `json:"destinationDigest,omitempty"`
+	// +optional
+	// LastSyncTime is the last time the image was mirrored.
+	LastSyncTime *metav1.Time `json:"lastSyncTime,omitempty"`
+	// +optional
+	// LastError is the last error that occurred while mirroring the image.
+	LastError string `json:"lastError,omitempty"`
+	// +optional
+	// Platforms are the platforms of the image in the local registry.
+	Platforms []string `json:"platforms,omitempty"`
+	// +required
+	// +kubebuilder:validation:Enum=pending;synced;failed
+	// State is the current state of the image.
+	State MirrorImageState `json:"state"`
+}
+
 type MirrorStatus struct {
+	// +optional
+	// ObservedGeneration is the generation of the mirror that was last reconciled.
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
 	// +optional
 	// TotalImages is the number of images that are being mirrored.
 	TotalImages int `json:"totalImages"`
+	// +optional
+	// SyncedImages is the number of images that have been mirrored.
+	SyncedImages int `json:"syncedImages"`
+	// +optional
+	// FailedImages is the number of images that have failed to be mirrored.
+	FailedImages int `json:"failedImages"`
+	// +optional
+	// Repositories are the repositories with any tag selections resolved.
+	Repositories []RepositoryStatus `json:"repositories,omitempty"`
+	// +optional
+	// Images is the sync status of each of the mirrored images.
+	Images []MirrorImageStatus `json:"images,omitempty"`
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	// Conditions are the Ready, Syncing and Degraded conditions of the mirror.
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
 }
 
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
@@ -232,3 +601,100 @@ type MirrorList struct {
 	metav1.ListMeta `json:"metadata,omitempty"`
 	Items           []Mirror `json:"items"`
 }
+
+// InjectionMode is a mutation applied to workloads by the injector.
+// +kubebuilder:validation:Enum=pull-policy;selectors;soft-selectors;rewrite
+type InjectionMode string
+
+const (
+	InjectionModePullPolicy    InjectionMode = "pull-policy"
+	InjectionModeSelectors     InjectionMode = "selectors"
+	InjectionModeSoftSelectors InjectionMode = "soft-selectors"
+	InjectionModeRewrite       InjectionMode = "rewrite"
+)
+
+// InjectionPolicySpec defines the injection modes applied to the matching workloads.
+type InjectionPolicySpec struct {
+	// +optional
+	// +nullable
+	// ObjectSelector limits the policy to workloads with matching labels.  All
+	// workloads match when it is not set.
+	ObjectSelector *metav1.LabelSelector `json:"objectSelector,omitempty"`
+	// +required
+	// +kubebuilder:validation:MinItems=1
+	// Modes are the injection modes applied to the workloads.
+	Modes []InjectionMode `json:"modes"`
+	// +optional
+	// +nullable
+	// Include limits the injection to the listed containers.  Names can be prefixed
+	// with the container kind, for example init:migrate.
+	Include []string `json:"include,omitempty"`
+	// +optional
+	// +nullable
+	// Exclude skips the listed containers.  It is ignored when include is set.
+	Exclude []string `json:"exclude,omitempty"`
+	// +optional
+	// AllowOverride allows the injection annotations on the workloads to override
+	// the policy.
+	AllowOverride bool `json:"allowOverride,omitempty"`
+}
+
+// +genclient
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+// +kubebuilder:validation:Required
+// +kubebuilder:resource:scope=Namespaced,shortName=injp,singular=injectionpolicy
+// +kubebuilder:printcolumn:name="Modes",type="string",JSONPath=".spec.modes",description="The injection modes applied by the policy"
+// +kubebuilder:printcolumn:name="Override",type="boolean",JSONPath=".spec.allowOverride",description="Whether annotations can override the policy"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+
+// InjectionPolicy sets the injection defaults for the workloads in a namespace.
+type InjectionPolicy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Spec              InjectionPolicySpec `json:"spec"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+type InjectionPolicyList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []InjectionPolicy `json:"items"`
+}
+
+// ClusterInjectionPolicySpec is the spec for a ClusterInjectionPolicy resource.  It
+// extends the InjectionPolicySpec with a namespace selector.
+type ClusterInjectionPolicySpec struct {
+	// +optional
+	// +nullable
+	// NamespaceSelector limits the policy to workloads in namespaces with matching
+	// labels.  All namespaces match when it is not set.
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+
+	InjectionPolicySpec `json:",inline"`
+}
+
+// +genclient
+// +genclient:nonNamespaced
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+// +kubebuilder:validation:Required
+// +kubebuilder:resource:scope=Cluster,shortName=cinjp,singular=clusterinjectionpolicy
+// +kubebuilder:printcolumn:name="Modes",type="string",JSONPath=".spec.modes",description="The injection modes applied by the policy"
+// +kubebuilder:printcolumn:name="Override",type="boolean",JSONPath=".spec.allowOverride",description="Whether annotations can override the policy"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+
+// ClusterInjectionPolicy sets the injection defaults for the workloads across the
+// cluster.
+type ClusterInjectionPolicy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Spec              ClusterInjectionPolicySpec `json:"spec"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+type ClusterInjectionPolicyList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ClusterInjectionPolicy `json:"items"`
+}
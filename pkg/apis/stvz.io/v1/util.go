@@ -20,6 +20,7 @@ import (
 	"hash"
 	"math/rand" // #nosec
 
+	"github.com/containers/image/v5/docker/reference"
 	"github.com/containers/image/v5/transports/alltransports"
 	"k8s.io/apimachinery/pkg/util/dump"
 )
@@ -39,6 +40,18 @@ func NormalizeRepoTag(r, t string) (string, error) {
 	return src.DockerReference().String(), nil
 }
 
+// NormalizeRepo converts a repository name into it's fully explicit form without a
+// tag.  NormalizeRepoTag can't be used with an empty tag since the reference is
+// defaulted to the latest tag.
+func NormalizeRepo(r string) (string, error) {
+	named, err := reference.ParseNormalizedNamed(r)
+	if err != nil {
+		return "", err
+	}
+
+	return reference.TrimNamed(named).String(), nil
+}
+
 func DeepCopyObject(hasher hash.Hash, obj interface{}) {
 	hasher.Reset()
 	fmt.Fprintf(hasher, "%v", dump.ForHash(obj))
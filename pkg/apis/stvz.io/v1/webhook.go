@@ -17,8 +17,12 @@ package v1
 
 import (
 	"fmt"
+	"net"
 
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
 	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
@@ -28,6 +32,10 @@ import (
 
 // +kubebuilder:webhook:verbs=create;update,path=/mutate-stvz-io-v1-image,mutating=true,failurePolicy=fail,groups=stvz.io,resources=images,versions=v1,name=mimage.stvz.io,admissionReviewVersions=v1,sideEffects=none
 // +kubebuilder:webhook:verbs=create;update,path=/validate-stvz-io-v1-image,mutating=false,failurePolicy=fail,groups=stvz.io,resources=images,versions=v1,name=vimage.stvz.io,admissionReviewVersions=v1,sideEffects=none
+// +kubebuilder:webhook:verbs=create;update,path=/mutate-stvz-io-v1-clusterimage,mutating=true,failurePolicy=fail,groups=stvz.io,resources=clusterimages,versions=v1,name=mclusterimage.stvz.io,admissionReviewVersions=v1,sideEffects=none
+// +kubebuilder:webhook:verbs=create;update,path=/validate-stvz-io-v1-clusterimage,mutating=false,failurePolicy=fail,groups=stvz.io,resources=clusterimages,versions=v1,name=vclusterimage.stvz.io,admissionReviewVersions=v1,sideEffects=none
+// +kubebuilder:webhook:verbs=create;update,path=/mutate-stvz-io-v1-mirror,mutating=true,failurePolicy=fail,groups=stvz.io,resources=mirrors,versions=v1,name=mmirror.stvz.io,admissionReviewVersions=v1,sideEffects=none
+// +kubebuilder:webhook:verbs=create;update,path=/validate-stvz-io-v1-mirror,mutating=false,failurePolicy=fail,groups=stvz.io,resources=mirrors,versions=v1,name=vmirror.stvz.io,admissionReviewVersions=v1,sideEffects=none
 
 // SetupWebhookWithManager adds webhook for BuildSet.
 func (i *Image) SetupWebhookWithManager(mgr ctrl.Manager) error {
@@ -48,8 +56,32 @@ func validateSpecRepositories(images []RepositorySpec) (admission.Warnings, erro
 			return warnings, fmt.Errorf("name must be specified")
 		}
 
-		if len(image.Tags) < 1 {
-			return warnings, fmt.Errorf("at least one tag must be specified")
+		// Listing every tag is only implemented by the mirror.  The agent would never
+		// pull anything for an image using it, so a tag selection must be used instead.
+		switch image.ListSelection {
+		case "":
+		case ListSelectorAll:
+			return warnings, fmt.Errorf("list selection %s is only supported for mirrors, use a tag selection instead", ListSelectorAll)
+		default:
+			return warnings, fmt.Errorf("unsupported list selection: %s", image.ListSelection)
+		}
+
+		if len(image.Tags) < 1 && image.Selection == nil {
+			return warnings, fmt.Errorf("at least one tag or a tag selection must be specified")
+		}
+
+		if image.MaxTags < 0 {
+			return warnings, fmt.Errorf("max tags must not be negative")
+		}
+
+		if image.MaxSize != nil && image.MaxSize.Sign() < 0 {
+			return warnings, fmt.Errorf("max size must not be negative")
+		}
+
+		if image.Selection != nil {
+			if err := image.Selection.Validate(); err != nil {
+				return warnings, fmt.Errorf("invalid tag selection: %w", err)
+			}
 		}
 
 		tags := make(map[string]bool)
@@ -112,3 +144,320 @@ func (i *Image) ValidateDelete() (admission.Warnings, error) {
 
 var _ webhook.Defaulter = &Image{}
 var _ webhook.Validator = &Image{}
+
+// SetupWebhookWithManager adds webhook for ClusterImage.
+func (i *ClusterImage) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(i).
+		Complete()
+}
+
+func (i *ClusterImage) Default() {
+	Defaulted(i)
+}
+
+func validateClusterSpec(spec ClusterImageSpec) (admission.Warnings, error) {
+	// Without a namespace there is no way to find the secret.
+	for _, secret := range spec.ImagePullSecrets {
+		if secret.Name == "" || secret.Namespace == "" {
+			return admission.Warnings{}, fmt.Errorf("image pull secrets must specify both a name and namespace")
+		}
+	}
+
+	return validateSpecRepositories(spec.Repositories)
+}
+
+// ValidateCreate implements webhook Validator.
+func (i *ClusterImage) ValidateCreate() (admission.Warnings, error) {
+	warnings := make(admission.Warnings, 0)
+
+	specWarnings, err := validateClusterSpec(i.Spec)
+	if err != nil {
+		return warnings, err
+	}
+
+	warnings = append(warnings, specWarnings...)
+	return warnings, nil
+}
+
+// ValidateUpdate implements webhook Validator.
+func (i *ClusterImage) ValidateUpdate(old runtime.Object) (admission.Warnings, error) {
+	warnings := make(admission.Warnings, 0)
+
+	specWarnings, err := validateClusterSpec(i.Spec)
+	if err != nil {
+		return warnings, err
+	}
+
+	warnings = append(warnings, specWarnings...)
+	return warnings, nil
+}
+
+// ValidateDelete implements webhook Validator.
+func (i *ClusterImage) ValidateDelete() (admission.Warnings, error) {
+	return nil, nil
+}
+
+var _ webhook.Defaulter = &ClusterImage{}
+var _ webhook.Validator = &ClusterImage{}
+
+// SetupWebhookWithManager adds webhook for Mirror.
+func (m *Mirror) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(m).
+		Complete()
+}
+
+func (m *Mirror) Default() {
+	Defaulted(m)
+}
+
+func validateRegistry(path *field.Path, registry *RegistrySpec) (admission.Warnings, field.ErrorList) {
+	warnings := make(admission.Warnings, 0)
+	errs := field.ErrorList{}
+
+	// The defaulter always sets the registry, but the validator may see objects that
+	// were created before the webhook was installed.
+	if registry == nil {
+		return warnings, errs
+	}
+
+	host := registry.Host
+	if host == "" {
+		errs = append(errs, field.Required(path.Child("host"), "host must be specified"))
+	} else if net.ParseIP(host) == nil {
+		for _, msg := range validation.IsDNS1123Subdomain(host) {
+			errs = append(errs, field.Invalid(path.Child("host"), host, msg))
+		}
+	}
+
+	for _, msg := range validation.IsValidPortNum(registry.Port) {
+		errs = append(errs, field.Invalid(path.Child("port"), registry.Port, msg))
+	}
+
+	if !registry.VerifyTLS() && !isLoopback(host) {
+		warnings = append(warnings, fmt.Sprintf("tls verification is disabled for registry %s", host))
+	}
+
+	if registry.CredentialsSecret != nil && registry.CredentialsSecret.Name == "" {
+		errs = append(errs, field.Required(path.Child("credentialsSecret", "name"), "secret name must be specified"))
+	}
+
+	if registry.ClientCertSecret != nil && registry.ClientCertSecret.Name == "" {
+		errs = append(errs, field.Required(path.Child("clientCertSecret", "name"), "secret name must be specified"))
+	}
+
+	if registry.CA != nil {
+		if !registry.VerifyTLS() {
+			warnings = append(warnings, fmt.Sprintf("%s: the CA bundle is ignored when tls verification is disabled", path.Child("ca")))
+		}
+		errs = append(errs, validateCABundle(path.Child("ca"), registry.CA)...)
+	}
+
+	return warnings, errs
+}
+
+func validateCABundle(path *field.Path, ca *CABundleSource) field.ErrorList {
+	errs := field.ErrorList{}
+
+	switch {
+	case ca.ConfigMapKeyRef != nil && ca.SecretKeyRef != nil:
+		errs = append(errs, field.Forbidden(path, "only one of configMapKeyRef or secretKeyRef may be specified"))
+	case ca.ConfigMapKeyRef != nil:
+		ref := ca.ConfigMapKeyRef
+		if ref.Name == "" {
+			errs = append(errs, field.Required(path.Child("configMapKeyRef", "name"), "config map name must be specified"))
+		}
+		if ref.Key == "" {
+			errs = append(errs, field.Required(path.Child("configMapKeyRef", "key"), "key must be specified"))
+		}
+	case ca.SecretKeyRef != nil:
+		ref := ca.SecretKeyRef
+		if ref.Name == "" {
+			errs = append(errs, field.Required(path.Child("secretKeyRef", "name"), "secret name must be specified"))
+		}
+		if ref.Key == "" {
+			errs = append(errs, field.Required(path.Child("secretKeyRef", "key"), "key must be specified"))
+		}
+	default:
+		errs = append(errs, field.Required(path, "one of configMapKeyRef or secretKeyRef must be specified"))
+	}
+
+	return errs
+}
+
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// validateMirrorRepositories checks every repository and tag can be normalized and
+// that no image is listed more than once, even when written in different forms.
+func validateMirrorRepositories(path *field.Path, repos Repositories) (admission.Warnings, field.ErrorList) { //nolint:gocognit
+	warnings := make(admission.Warnings, 0)
+	errs := field.ErrorList{}
+
+	if len(repos) == 0 {
+		errs = append(errs, field.Required(path, "at least one repository must be specified"))
+	}
+
+	names := make(map[string]bool)
+	images := make(map[string]bool)
+	for i, repo := range repos {
+		rp := path.Index(i)
+
+		if repo.Name == nil || *repo.Name == "" {
+			errs = append(errs, field.Required(rp.Child("name"), "name must be specified"))
+			continue
+		}
+
+		name, err := NormalizeRepo(*repo.Name)
+		if err != nil {
+			errs = append(errs, field.Invalid(rp.Child("name"), *repo.Name, err.Error()))
+			continue
+		}
+
+		if names[name] {
+			errs = append(errs, field.Duplicate(rp.Child("name"), *repo.Name))
+		}
+		names[name] = true
+
+		switch repo.ListSelection {
+		case "":
+			if len(repo.Tags) < 1 && repo.Selection == nil {
+				errs = append(errs, field.Required(rp.Child("tags"), "at least one tag or a tag selection must be specified"))
+			}
+		case ListSelectorAll:
+			if len(repo.Tags) > 0 {
+				warnings = append(warnings, fmt.Sprintf("%s: tags are ignored when all tags are selected", rp.Child("tags")))
+			}
+		default:
+			errs = append(errs, field.NotSupported(rp.Child("listSelection"), repo.ListSelection, []string{string(ListSelectorAll)}))
+		}
+
+		if repo.MaxTags < 0 {
+			errs = append(errs, field.Invalid(rp.Child("maxTags"), repo.MaxTags, "must not be negative"))
+		}
+
+		if repo.MaxSize != nil && repo.MaxSize.Sign() < 0 {
+			errs = append(errs, field.Invalid(rp.Child("maxSize"), repo.MaxSize.String(), "must not be negative"))
+		}
+
+		if repo.Selection != nil {
+			if err := repo.Selection.Validate(); err != nil {
+				errs = append(errs, field.Invalid(rp.Child("selection"), repo.Selection, err.Error()))
+			}
+		}
+
+		errs = append(errs, validatePlatforms(rp.Child("platforms"), repo.Platforms)...)
+
+		for j, tag := range repo.Tags {
+			tp := rp.Child("tags").Index(j)
+
+			if tag == "latest" {
+				warnings = append(warnings, fmt.Sprintf("%s: tag 'latest' is not supported and will be ignored", tp))
+				continue
+			}
+
+			image, err := NormalizeRepoTag(*repo.Name, tag)
+			if err != nil {
+				errs = append(errs, field.Invalid(tp, tag, err.Error()))
+				continue
+			}
+
+			if images[image] {
+				errs = append(errs, field.Duplicate(tp, tag))
+			}
+			images[image] = true
+		}
+	}
+
+	return warnings, errs
+}
+
+func validatePlatforms(path *field.Path, platforms *PlatformSelection) field.ErrorList {
+	errs := field.ErrorList{}
+	if platforms == nil {
+		return errs
+	}
+
+	switch platforms.Mode {
+	case PlatformModeAll, PlatformModeSystem:
+		if len(platforms.List) > 0 {
+			errs = append(errs, field.Forbidden(path.Child("list"), "platforms may only be listed when the mode is list"))
+		}
+	case PlatformModeList:
+		if len(platforms.List) == 0 {
+			errs = append(errs, field.Required(path.Child("list"), "at least one platform must be specified"))
+		}
+	default:
+		errs = append(errs, field.NotSupported(path.Child("mode"), platforms.Mode, []string{
+			string(PlatformModeAll), string(PlatformModeSystem), string(PlatformModeList),
+		}))
+	}
+
+	seen := make(map[string]bool)
+	for i, p := range platforms.List {
+		pp := path.Child("list").Index(i)
+		if p.OS == "" {
+			errs = append(errs, field.Required(pp.Child("os"), "os must be specified"))
+		}
+		if p.Architecture == "" {
+			errs = append(errs, field.Required(pp.Child("architecture"), "architecture must be specified"))
+		}
+		if seen[p.String()] {
+			errs = append(errs, field.Duplicate(pp, p.String()))
+		}
+		seen[p.String()] = true
+	}
+
+	return errs
+}
+
+func validateMirrorSpec(spec MirrorSpec) (admission.Warnings, field.ErrorList) {
+	path := field.NewPath("spec")
+
+	warnings, errs := validateRegistry(path.Child("registry"), spec.Registry)
+	repoWarnings, repoErrs := validateMirrorRepositories(path.Child("repositories"), spec.Repositories)
+
+	for i, secret := range spec.ImagePullSecrets {
+		if secret.Name == "" {
+			errs = append(errs, field.Required(path.Child("imagePullSecrets").Index(i).Child("name"), "secret name must be specified"))
+		}
+	}
+
+	errs = append(errs, validatePlatforms(path.Child("platforms"), spec.Platforms)...)
+
+	return append(warnings, repoWarnings...), append(errs, repoErrs...)
+}
+
+func (m *Mirror) validate() (admission.Warnings, error) {
+	warnings, errs := validateMirrorSpec(m.Spec)
+	if len(errs) > 0 {
+		return warnings, apierrors.NewInvalid(Kind("Mirror"), m.Name, errs)
+	}
+
+	return warnings, nil
+}
+
+// ValidateCreate implements webhook Validator.
+func (m *Mirror) ValidateCreate() (admission.Warnings, error) {
+	return m.validate()
+}
+
+// ValidateUpdate implements webhook Validator.
+func (m *Mirror) ValidateUpdate(old runtime.Object) (admission.Warnings, error) {
+	return m.validate()
+}
+
+// ValidateDelete implements webhook Validator.
+func (m *Mirror) ValidateDelete() (admission.Warnings, error) {
+	return nil, nil
+}
+
+var _ webhook.Defaulter = &Mirror{}
+var _ webhook.Validator = &Mirror{}
@@ -17,6 +17,8 @@ package v1
 import (
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/utils/ptr"
 )
 
 // +kubebuilder:docs-gen:collapse=Imports
@@ -45,7 +47,7 @@ var _ = Describe("In the admission webhook", func() {
 				warnings, err := validateSpec(spec)
 				Expect(len(warnings)).To(Equal(0))
 				Expect(err).To(HaveOccurred())
-				Expect(err.Error()).To(ContainSubstring("at least one tag must be specified"))
+				Expect(err.Error()).To(ContainSubstring("at least one tag or a tag selection must be specified"))
 			})
 
 			It("should error if there are duplicate tags", func() {
@@ -76,6 +78,35 @@ var _ = Describe("In the admission webhook", func() {
 				Expect(len(warnings)).To(Equal(1))
 				Expect(err).NotTo(HaveOccurred())
 			})
+
+			It("should error if the list selection is not supported", func() {
+				spec := ImageSpec{
+					Repositories: []RepositorySpec{
+						{
+							Name:          &[]string{"test"}[0],
+							ListSelection: "some",
+						},
+					},
+				}
+				_, err := validateSpec(spec)
+				Expect(err).To(HaveOccurred())
+				Expect(err.Error()).To(ContainSubstring("unsupported list selection"))
+			})
+
+			It("should error if all tags are selected", func() {
+				spec := ImageSpec{
+					Repositories: []RepositorySpec{
+						{
+							Name:          &[]string{"test"}[0],
+							ListSelection: ListSelectorAll,
+							MaxTags:       10,
+						},
+					},
+				}
+				_, err := validateSpec(spec)
+				Expect(err).To(HaveOccurred())
+				Expect(err.Error()).To(ContainSubstring("only supported for mirrors"))
+			})
 		})
 
 		Context("and there are no errors with the spec", func() {
@@ -94,4 +125,176 @@ var _ = Describe("In the admission webhook", func() {
 			})
 		})
 	})
+
+	When("validateClusterSpec is called", func() {
+		It("should error if a pull secret is missing the namespace", func() {
+			spec := ClusterImageSpec{
+				Repositories: []RepositorySpec{
+					{
+						Name: &[]string{"test"}[0],
+						Tags: []string{"tag1"},
+					},
+				},
+				ImagePullSecrets: []corev1.SecretReference{
+					{Name: "creds"},
+				},
+			}
+			_, err := validateClusterSpec(spec)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("must specify both a name and namespace"))
+		})
+
+		It("should validate the repositories", func() {
+			spec := ClusterImageSpec{
+				Repositories: []RepositorySpec{
+					{Tags: []string{"tag1"}},
+				},
+				ImagePullSecrets: []corev1.SecretReference{
+					{Name: "creds", Namespace: "default"},
+				},
+			}
+			_, err := validateClusterSpec(spec)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("name must be specified"))
+		})
+	})
+
+	When("validateMirrorSpec is called", func() {
+		registry := &RegistrySpec{
+			Host: "registry.local",
+			Port: 5000,
+		}
+
+		It("should not return errors for a valid spec", func() {
+			spec := MirrorSpec{
+				Registry: registry,
+				Repositories: Repositories{
+					{
+						Name: &[]string{"alpine"}[0],
+						Tags: []string{"3.18", "3.19"},
+					},
+				},
+			}
+			_, errs := validateMirrorSpec(spec)
+			Expect(errs).To(BeEmpty())
+		})
+
+		It("should reject an invalid registry with the field path", func() {
+			spec := MirrorSpec{
+				Registry: &RegistrySpec{
+					Host: "https://registry.local",
+					Port: 70000,
+				},
+				Repositories: Repositories{
+					{
+						Name: &[]string{"alpine"}[0],
+						Tags: []string{"3.19"},
+					},
+				},
+			}
+			_, errs := validateMirrorSpec(spec)
+			Expect(errs).To(HaveLen(2))
+			Expect(errs[0].Field).To(Equal("spec.registry.host"))
+			Expect(errs[1].Field).To(Equal("spec.registry.port"))
+		})
+
+		It("should warn when tls verification is disabled for a remote registry", func() {
+			spec := MirrorSpec{
+				Registry: &RegistrySpec{
+					Host:      "registry.local",
+					Port:      5000,
+					TLSVerify: ptr.To(false),
+				},
+				Repositories: Repositories{
+					{
+						Name: &[]string{"alpine"}[0],
+						Tags: []string{"3.19"},
+					},
+				},
+			}
+			warnings, _ := validateMirrorSpec(spec)
+			Expect(warnings).To(HaveLen(1))
+		})
+
+		It("should reject duplicate images after normalization", func() {
+			spec := MirrorSpec{
+				Registry: registry,
+				Repositories: Repositories{
+					{
+						Name: &[]string{"alpine"}[0],
+						Tags: []string{"3.19"},
+					},
+					{
+						Name: &[]string{"docker.io/library/alpine"}[0],
+						Tags: []string{"3.18", "3.19"},
+					},
+				},
+			}
+			_, errs := validateMirrorSpec(spec)
+			Expect(errs).To(HaveLen(2))
+			Expect(errs[0].Field).To(Equal("spec.repositories[1].name"))
+			Expect(errs[1].Field).To(Equal("spec.repositories[1].tags[1]"))
+		})
+
+		It("should reject references that can't be parsed", func() {
+			spec := MirrorSpec{
+				Registry: registry,
+				Repositories: Repositories{
+					{
+						Name: &[]string{"Alpine"}[0],
+						Tags: []string{"3.19"},
+					},
+					{
+						Name: &[]string{"busybox"}[0],
+						Tags: []string{"1.36", "bad tag"},
+					},
+				},
+			}
+			_, errs := validateMirrorSpec(spec)
+			Expect(errs).To(HaveLen(2))
+			Expect(errs[0].Field).To(Equal("spec.repositories[0].name"))
+			Expect(errs[1].Field).To(Equal("spec.repositories[1].tags[1]"))
+		})
+
+		It("should require a platform list when the mode is list", func() {
+			spec := MirrorSpec{
+				Registry:  registry,
+				Platforms: &PlatformSelection{Mode: PlatformModeList},
+				Repositories: Repositories{
+					{
+						Name: &[]string{"alpine"}[0],
+						Tags: []string{"3.19"},
+						Platforms: &PlatformSelection{
+							Mode: PlatformModeList,
+							List: []Platform{{OS: "linux"}},
+						},
+					},
+				},
+			}
+			_, errs := validateMirrorSpec(spec)
+			Expect(errs).To(HaveLen(2))
+			Expect(errs[0].Field).To(Equal("spec.platforms.list"))
+			Expect(errs[1].Field).To(Equal("spec.repositories[0].platforms.list[0].architecture"))
+		})
+	})
+
+	When("a mirror is defaulted", func() {
+		It("should store the default registry", func() {
+			mirror := &Mirror{}
+			mirror.Default()
+			Expect(mirror.Spec.Registry).ToNot(BeNil())
+			Expect(mirror.Spec.Registry.Host).To(Equal(DefaultRegistryHost))
+			Expect(mirror.Spec.Registry.Port).To(Equal(DefaultRegistryPort))
+		})
+
+		It("should set the default port on an existing registry", func() {
+			mirror := &Mirror{
+				Spec: MirrorSpec{
+					Registry: &RegistrySpec{Host: "registry.local"},
+				},
+			}
+			mirror.Default()
+			Expect(mirror.Spec.Registry.Port).To(Equal(DefaultRegistryPort))
+		})
+	})
 })
@@ -0,0 +1,175 @@
+// Copyright 2024 Coral Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bundle
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/yaml"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	stvziov1 "stvz.io/coral/pkg/apis/stvz.io/v1"
+)
+
+// IndexFile is the name of the bundle index in the root of the OCI layout.
+const IndexFile = "coral-bundle.json"
+
+var ErrDigestMismatch = errors.New("digest does not match the bundle")
+
+// Image is an image in the bundle.
+type Image struct {
+	// Name is the normalized image reference.  It's also the reference name of the
+	// image in the OCI layout.
+	Name string `json:"name"`
+	// Digest is the digest of the image manifest or manifest list.
+	Digest string `json:"digest"`
+}
+
+// Index lists the images in the bundle along with the mirrors they were exported
+// from.
+type Index struct {
+	Created time.Time         `json:"created"`
+	Images  []Image           `json:"images"`
+	Mirrors []stvziov1.Mirror `json:"mirrors,omitempty"`
+}
+
+// WriteIndex writes the index to the root of the layout directory.
+func WriteIndex(dir string, index *Index) error {
+	data, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(filepath.Join(dir, IndexFile), data, 0o644) // #nosec
+}
+
+// ReadIndex reads the index from the root of the layout directory.
+func ReadIndex(dir string) (*Index, error) {
+	data, err := os.ReadFile(filepath.Join(dir, IndexFile))
+	if err != nil {
+		return nil, err
+	}
+
+	index := &Index{}
+	if err := json.Unmarshal(data, index); err != nil {
+		return nil, fmt.Errorf("invalid bundle index: %w", err)
+	}
+
+	return index, nil
+}
+
+// ReadManifests reads the Mirror, Image and ClusterImage objects from the yaml or json
+// files.  Any other kinds are ignored.
+func ReadManifests(paths ...string) ([]client.Object, error) {
+	objs := make([]client.Object, 0)
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+
+		read, err := decode(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		objs = append(objs, read...)
+	}
+
+	return objs, nil
+}
+
+func decode(r io.Reader) ([]client.Object, error) {
+	objs := make([]client.Object, 0)
+	decoder := yaml.NewYAMLOrJSONDecoder(bufio.NewReader(r), 4096)
+	for {
+		u := &unstructured.Unstructured{}
+		if err := decoder.Decode(&u.Object); err != nil {
+			if errors.Is(err, io.EOF) {
+				return objs, nil
+			}
+			return nil, err
+		}
+
+		if u.Object == nil || u.GroupVersionKind().GroupVersion() != stvziov1.SchemeGroupVersion {
+			continue
+		}
+
+		var obj client.Object
+		switch u.GetKind() {
+		case "Mirror":
+			obj = &stvziov1.Mirror{}
+		case "Image":
+			obj = &stvziov1.Image{}
+		case "ClusterImage":
+			obj = &stvziov1.ClusterImage{}
+		default:
+			continue
+		}
+
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(u.Object, obj); err != nil {
+			return nil, err
+		}
+		objs = append(objs, obj)
+	}
+}
+
+// Repositories returns the repositories referenced by the objects.
+func Repositories(objs []client.Object) stvziov1.Repositories {
+	repos := make(stvziov1.Repositories, 0)
+	for _, obj := range objs {
+		switch o := obj.(type) {
+		case *stvziov1.Mirror:
+			repos = append(repos, o.Spec.Repositories...)
+		case *stvziov1.Image:
+			repos = append(repos, o.Spec.Repositories...)
+		case *stvziov1.ClusterImage:
+			repos = append(repos, o.Spec.Repositories...)
+		}
+	}
+
+	return repos
+}
+
+// Mirrors returns copies of the mirrors in the objects with only the fields needed
+// to recreate them.
+func Mirrors(objs []client.Object) []stvziov1.Mirror {
+	mirrors := make([]stvziov1.Mirror, 0)
+	for _, obj := range objs {
+		m, ok := obj.(*stvziov1.Mirror)
+		if !ok {
+			continue
+		}
+
+		mirror := stvziov1.Mirror{
+			TypeMeta: m.TypeMeta,
+		}
+		mirror.Name = m.Name
+		mirror.Namespace = m.Namespace
+		mirror.Labels = m.Labels
+		m.Spec.DeepCopyInto(&mirror.Spec)
+		mirrors = append(mirrors, mirror)
+	}
+
+	return mirrors
+}
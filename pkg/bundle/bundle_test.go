@@ -0,0 +1,247 @@
+// Copyright 2024 Coral Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bundle
+
+import (
+	"archive/tar"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/containers/image/v5/oci/layout"
+	"github.com/containers/image/v5/types"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/opencontainers/go-digest"
+	imgspecs "github.com/opencontainers/image-spec/specs-go"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	stvziov1 "stvz.io/coral/pkg/apis/stvz.io/v1"
+)
+
+// writeLayout writes a single image to a new OCI layout and returns the digest of
+// it's manifest.
+func writeLayout(dir, name string) string {
+	blobs := filepath.Join(dir, "blobs", "sha256")
+	Expect(os.MkdirAll(blobs, 0o755)).To(Succeed())
+
+	write := func(mediaType string, data []byte) imgspecv1.Descriptor {
+		d := digest.FromBytes(data)
+		Expect(os.WriteFile(filepath.Join(blobs, d.Encoded()), data, 0o600)).To(Succeed())
+		return imgspecv1.Descriptor{MediaType: mediaType, Digest: d, Size: int64(len(data))}
+	}
+
+	marshal := func(v any) []byte {
+		data, err := json.Marshal(v)
+		Expect(err).ToNot(HaveOccurred())
+		return data
+	}
+
+	layer := write(imgspecv1.MediaTypeImageLayer, []byte("layer"))
+	cfg := write(imgspecv1.MediaTypeImageConfig, marshal(imgspecv1.Image{
+		Platform: imgspecv1.Platform{Architecture: "amd64", OS: "linux"},
+		RootFS:   imgspecv1.RootFS{Type: "layers", DiffIDs: []digest.Digest{layer.Digest}},
+	}))
+	manifest := write(imgspecv1.MediaTypeImageManifest, marshal(imgspecv1.Manifest{
+		Versioned: imgspecs.Versioned{SchemaVersion: 2},
+		MediaType: imgspecv1.MediaTypeImageManifest,
+		Config:    cfg,
+		Layers:    []imgspecv1.Descriptor{layer},
+	}))
+
+	manifest.Annotations = map[string]string{imgspecv1.AnnotationRefName: name}
+	Expect(os.WriteFile(filepath.Join(dir, imgspecv1.ImageLayoutFile), marshal(imgspecv1.ImageLayout{
+		Version: imgspecv1.ImageLayoutVersion,
+	}), 0o600)).To(Succeed())
+	Expect(os.WriteFile(filepath.Join(dir, "index.json"), marshal(imgspecv1.Index{
+		Versioned: imgspecs.Versioned{SchemaVersion: 2},
+		MediaType: imgspecv1.MediaTypeImageIndex,
+		Manifests: []imgspecv1.Descriptor{manifest},
+	}), 0o600)).To(Succeed())
+
+	return manifest.Digest.String()
+}
+
+var _ = Describe("Bundle", func() {
+	manifests := `---
+apiVersion: stvz.io/v1
+kind: Mirror
+metadata:
+  name: base
+  namespace: coral
+  resourceVersion: "12"
+spec:
+  registry:
+    host: localhost
+    port: 5000
+  repositories:
+    - name: docker.io/library/alpine
+      tags: ["3.19"]
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: ignored
+---
+apiVersion: stvz.io/v1
+kind: Image
+metadata:
+  name: busybox
+spec:
+  repositories:
+    - name: busybox
+      tags: ["1.36"]
+`
+
+	It("should read the coral resources from the manifests", func() {
+		path := filepath.Join(GinkgoT().TempDir(), "resources.yaml")
+		Expect(os.WriteFile(path, []byte(manifests), 0o600)).To(Succeed())
+
+		objs, err := ReadManifests(path)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(objs).To(HaveLen(2))
+
+		repos := Repositories(objs)
+		Expect(repos).To(HaveLen(2))
+		Expect(*repos[1].Name).To(Equal("busybox"))
+
+		mirrors := Mirrors(objs)
+		Expect(mirrors).To(HaveLen(1))
+		Expect(mirrors[0].Namespace).To(Equal("coral"))
+		Expect(mirrors[0].ResourceVersion).To(BeEmpty())
+		Expect(mirrors[0].Spec.Repositories).To(HaveLen(1))
+	})
+
+	It("should write and read the index", func() {
+		dir := GinkgoT().TempDir()
+		index := &Index{
+			Created: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+			Images: []Image{
+				{Name: "docker.io/library/alpine:3.19", Digest: "sha256:abc"},
+			},
+			Mirrors: []stvziov1.Mirror{{}},
+		}
+
+		Expect(WriteIndex(dir, index)).To(Succeed())
+
+		read, err := ReadIndex(dir)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(read.Images).To(Equal(index.Images))
+		Expect(read.Created).To(Equal(index.Created))
+	})
+
+	It("should pin the mirror selections to the exported tags", func() {
+		repo := stvziov1.RepositorySpec{
+			Name:          &[]string{"docker.io/library/alpine"}[0],
+			Selection:     &stvziov1.TagSelection{},
+			ListSelection: stvziov1.ListSelectorAll,
+			MaxTags:       10,
+		}
+
+		pinned := PinTags(repo, []string{"3.19", "3.20"})
+		Expect(pinned.Tags).To(Equal([]string{"3.19", "3.20"}))
+		Expect(pinned.Selection).To(BeNil())
+		Expect(pinned.ListSelection).To(BeEmpty())
+		Expect(pinned.MaxTags).To(BeZero())
+		Expect(repo.Selection).ToNot(BeNil())
+	})
+
+	It("should load the source credentials from the auth file", func() {
+		path := filepath.Join(GinkgoT().TempDir(), "auth.json")
+		auth := base64.StdEncoding.EncodeToString([]byte("user:pass"))
+		Expect(os.WriteFile(path, []byte(`{"auths":{"docker.io":{"auth":"`+auth+`"}}}`), 0o600)).To(Succeed())
+
+		creds, err := SourceAuth(&types.SystemContext{AuthFilePath: path}, "alpine")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(creds.Username).To(Equal("user"))
+		Expect(creds.Password).To(Equal("pass"))
+
+		creds, err = SourceAuth(&types.SystemContext{AuthFilePath: path}, "ghcr.io/stvz/coral")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(creds.Username).To(BeEmpty())
+	})
+
+	It("should round trip an image through the bundle layout", func() {
+		ctx := context.Background()
+		name := "docker.io/library/alpine:3.20"
+
+		source := GinkgoT().TempDir()
+		expected := writeLayout(source, name)
+
+		pctx, err := policyContext()
+		Expect(err).ToNot(HaveOccurred())
+		DeferCleanup(pctx.Destroy)
+
+		By("exporting the image to the bundle")
+		sref, err := layout.NewReference(source, name)
+		Expect(err).ToNot(HaveOccurred())
+		dir := GinkgoT().TempDir()
+		exported, err := exportReference(ctx, pctx, sref, nil, dir, name)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(exported).To(Equal(expected))
+
+		By("importing the image from the bundle")
+		dref, err := layout.NewReference(GinkgoT().TempDir(), name)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(importImage(ctx, pctx, dir, Image{Name: name, Digest: exported}, dref, nil)).To(Succeed())
+
+		By("rejecting an image that doesn't match the index")
+		err = importImage(ctx, pctx, dir, Image{Name: name, Digest: "sha256:0000"}, dref, nil)
+		Expect(err).To(MatchError(ErrDigestMismatch))
+	})
+
+	It("should round trip the layout through a tarball", func() {
+		dir := GinkgoT().TempDir()
+		Expect(os.MkdirAll(filepath.Join(dir, "blobs", "sha256"), 0o755)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(dir, "index.json"), []byte(`{}`), 0o600)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(dir, "blobs", "sha256", "abc"), []byte("blob"), 0o600)).To(Succeed())
+
+		out := filepath.Join(GinkgoT().TempDir(), "bundle.tar")
+		Expect(writeTar(dir, out)).To(Succeed())
+
+		extracted := GinkgoT().TempDir()
+		Expect(extractTar(out, extracted)).To(Succeed())
+
+		data, err := os.ReadFile(filepath.Join(extracted, "blobs", "sha256", "abc"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(data)).To(Equal("blob"))
+	})
+
+	It("should reject archives that write outside of the directory", func() {
+		out := filepath.Join(GinkgoT().TempDir(), "bad.tar")
+		f, err := os.Create(out)
+		Expect(err).ToNot(HaveOccurred())
+
+		tw := tar.NewWriter(f)
+		content := "evil"
+		Expect(tw.WriteHeader(&tar.Header{
+			Name:     "../evil",
+			Mode:     0o600,
+			Size:     int64(len(content)),
+			Typeflag: tar.TypeReg,
+		})).To(Succeed())
+		_, err = tw.Write([]byte(content))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(tw.Close()).To(Succeed())
+		Expect(f.Close()).To(Succeed())
+
+		err = extractTar(out, GinkgoT().TempDir())
+		Expect(err).To(MatchError(ErrInvalidArchive))
+		Expect(strings.Contains(err.Error(), "../evil")).To(BeTrue())
+	})
+})
@@ -0,0 +1,303 @@
+// Copyright 2024 Coral Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bundle
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/containers/image/v5/copy"
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/oci/layout"
+	"github.com/containers/image/v5/pkg/docker/config"
+	"github.com/containers/image/v5/signature"
+	"github.com/containers/image/v5/transports/alltransports"
+	"github.com/containers/image/v5/types"
+	crun "k8s.io/cri-api/pkg/apis/runtime/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	stvziov1 "stvz.io/coral/pkg/apis/stvz.io/v1"
+	"stvz.io/coral/pkg/mirror"
+)
+
+// ExportOptions configures a bundle export.
+type ExportOptions struct {
+	// Output is the OCI layout directory, or a tarball when it ends in .tar.
+	Output string
+	// SourceContext is used to pull the images from the upstream registries.
+	SourceContext *types.SystemContext
+}
+
+// Export copies every image referenced by the objects into an OCI layout and writes
+// the bundle index alongside it.  Tag selections are expanded against the upstream
+// registries.  Every platform of multi-arch images is exported so the digests match
+// the upstream digests.  The bundled mirrors list the exported tags in place of their
+// selections since the upstream registries can't be reached after the import.
+func Export(ctx context.Context, opts ExportOptions, objs []client.Object) (*Index, error) {
+	logger := log.FromContext(ctx)
+
+	dir := opts.Output
+	tarball := isTarball(opts.Output)
+	if tarball {
+		tmp, err := os.MkdirTemp("", "coral-bundle-")
+		if err != nil {
+			return nil, err
+		}
+		defer os.RemoveAll(tmp)
+		dir = tmp
+	}
+
+	pctx, err := policyContext()
+	if err != nil {
+		return nil, err
+	}
+	defer pctx.Destroy() //nolint:errcheck
+
+	index := &Index{
+		Created: time.Now().UTC(),
+		Images:  make([]Image, 0),
+		Mirrors: make([]stvziov1.Mirror, 0),
+	}
+
+	seen := make(map[string]bool)
+	for _, obj := range objs {
+		repos := append(stvziov1.Repositories{}, Repositories([]client.Object{obj})...)
+		for i, repo := range repos {
+			auth, err := SourceAuth(opts.SourceContext, *repo.Name)
+			if err != nil {
+				return nil, fmt.Errorf("unable to load credentials for %s: %w", *repo.Name, err)
+			}
+
+			tags, err := mirror.SelectTags(ctx, auth, repo)
+			if err != nil {
+				return nil, fmt.Errorf("unable to select tags for %s: %w", *repo.Name, err)
+			}
+			repos[i] = PinTags(repo, tags)
+
+			for _, tag := range tags {
+				name, err := stvziov1.NormalizeRepoTag(*repo.Name, tag)
+				if err != nil {
+					return nil, err
+				}
+				if seen[name] {
+					continue
+				}
+				seen[name] = true
+
+				logger.Info("exporting image", "image", name)
+				digest, err := exportImage(ctx, pctx, opts.SourceContext, dir, name)
+				if err != nil {
+					return nil, fmt.Errorf("unable to export %s: %w", name, err)
+				}
+
+				index.Images = append(index.Images, Image{Name: name, Digest: digest})
+			}
+		}
+
+		for _, m := range Mirrors([]client.Object{obj}) {
+			m.Spec.Repositories = repos
+			index.Mirrors = append(index.Mirrors, m)
+		}
+	}
+
+	if err := WriteIndex(dir, index); err != nil {
+		return nil, err
+	}
+
+	if tarball {
+		if err := writeTar(dir, opts.Output); err != nil {
+			return nil, err
+		}
+	}
+
+	return index, nil
+}
+
+// SourceAuth returns the credentials for the repository from the source context, so
+// the tags are listed with the same credentials the images are pulled with.
+func SourceAuth(sys *types.SystemContext, repo string) (*crun.AuthConfig, error) {
+	name, err := stvziov1.NormalizeRepo(repo)
+	if err != nil {
+		return nil, err
+	}
+
+	creds, err := config.GetCredentials(sys, name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &crun.AuthConfig{
+		Username:      creds.Username,
+		Password:      creds.Password,
+		IdentityToken: creds.IdentityToken,
+	}, nil
+}
+
+// PinTags returns a copy of the repository with any tag selections replaced by the
+// selected tags.
+func PinTags(repo stvziov1.RepositorySpec, tags []string) stvziov1.RepositorySpec {
+	pinned := repo.DeepCopy()
+	pinned.Tags = tags
+	pinned.Selection = nil
+	pinned.ListSelection = ""
+	pinned.MaxTags = 0
+	pinned.MaxSize = nil
+	return *pinned
+}
+
+func exportImage(ctx context.Context, pctx *signature.PolicyContext, sys *types.SystemContext, dir, name string) (string, error) {
+	sref, err := alltransports.ParseImageName("docker://" + name)
+	if err != nil {
+		return "", err
+	}
+
+	return exportReference(ctx, pctx, sref, sys, dir, name)
+}
+
+// exportReference copies the image into the layout directory under the name and
+// returns the digest of the exported manifest.
+func exportReference(ctx context.Context, pctx *signature.PolicyContext, sref types.ImageReference, sys *types.SystemContext, dir, name string) (string, error) { //nolint:lll
+	dref, err := layout.NewReference(dir, name)
+	if err != nil {
+		return "", err
+	}
+
+	return copyImage(ctx, pctx, sref, dref, sys, nil)
+}
+
+// ImportOptions configures a bundle import.
+type ImportOptions struct {
+	// Input is the OCI layout directory or tarball created by Export.
+	Input string
+	// Destination is the registry the images are pushed to.
+	Destination *mirror.Destination
+}
+
+// Import pushes every image in the bundle to the destination registry and verifies
+// the digest of each image in the registry matches the bundle index.
+func Import(ctx context.Context, opts ImportOptions) (*Index, error) {
+	logger := log.FromContext(ctx)
+
+	dir := opts.Input
+	if isTarball(opts.Input) {
+		tmp, err := os.MkdirTemp("", "coral-bundle-")
+		if err != nil {
+			return nil, err
+		}
+		defer os.RemoveAll(tmp)
+
+		if err := extractTar(opts.Input, tmp); err != nil {
+			return nil, err
+		}
+		dir = tmp
+	}
+
+	index, err := ReadIndex(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	pctx, err := policyContext()
+	if err != nil {
+		return nil, err
+	}
+	defer pctx.Destroy() //nolint:errcheck
+
+	for _, img := range index.Images {
+		logger.Info("importing image", "image", img.Name, "digest", img.Digest)
+
+		dref, err := alltransports.ParseImageName(opts.Destination.Reference(img.Name))
+		if err != nil {
+			return nil, err
+		}
+
+		if err := importImage(ctx, pctx, dir, img, dref, opts.Destination.SystemContext()); err != nil {
+			return nil, err
+		}
+
+		// The registry may convert the manifest on push, so the digest it serves is
+		// checked as well.
+		pushed, err := mirror.InspectDestination(ctx, opts.Destination, img.Name)
+		if err != nil {
+			return nil, fmt.Errorf("unable to verify %s: %w", img.Name, err)
+		}
+
+		if pushed.Digest != img.Digest {
+			return nil, fmt.Errorf("%s: %w: expected %s, got %s", img.Name, ErrDigestMismatch, img.Digest, pushed.Digest)
+		}
+	}
+
+	return index, nil
+}
+
+// importImage copies the image from the layout directory to the destination and
+// verifies the digest of the copied manifest matches the bundle index.
+func importImage(ctx context.Context, pctx *signature.PolicyContext, dir string, img Image, dref types.ImageReference, dctx *types.SystemContext) error { //nolint:lll
+	sref, err := layout.NewReference(dir, img.Name)
+	if err != nil {
+		return err
+	}
+
+	digest, err := copyImage(ctx, pctx, sref, dref, nil, dctx)
+	if err != nil {
+		return fmt.Errorf("unable to import %s: %w", img.Name, err)
+	}
+
+	if digest != img.Digest {
+		return fmt.Errorf("%s: %w: expected %s, got %s", img.Name, ErrDigestMismatch, img.Digest, digest)
+	}
+
+	return nil
+}
+
+// copyImage copies every instance of the image and returns the digest of the copied
+// manifest.
+func copyImage(ctx context.Context, pctx *signature.PolicyContext, sref, dref types.ImageReference, sctx, dctx *types.SystemContext) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Minute)
+	defer cancel()
+
+	raw, err := copy.Image(ctx, pctx, dref, sref, &copy.Options{
+		RemoveSignatures:   true,
+		ReportWriter:       io.Discard,
+		ImageListSelection: copy.CopyAllImages,
+		SourceCtx:          sctx,
+		DestinationCtx:     dctx,
+		PreserveDigests:    true,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	d, err := manifest.Digest(raw)
+	if err != nil {
+		return "", err
+	}
+
+	return d.String(), nil
+}
+
+func policyContext() (*signature.PolicyContext, error) {
+	return signature.NewPolicyContext(&signature.Policy{
+		Default: []signature.PolicyRequirement{signature.NewPRInsecureAcceptAnything()},
+	})
+}
+
+func isTarball(path string) bool {
+	return strings.HasSuffix(path, ".tar")
+}
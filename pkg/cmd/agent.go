@@ -26,6 +26,9 @@ import (
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
 	crun "k8s.io/cri-api/pkg/apis/runtime/v1"
 	"k8s.io/klog/v2"
 	"k8s.io/kubernetes/pkg/kubelet/util"
@@ -53,6 +56,10 @@ type Agent struct {
 	containerdAddr string
 	pollInterval   time.Duration
 	namespace      string
+	maxFailures    int
+	maxBackoff     time.Duration
+	maxImageFs     float64
+	nodeLabels     bool
 }
 
 func NewAgent() *Agent {
@@ -87,6 +94,12 @@ func (a *Agent) RunE(cmd *cobra.Command, args []string) error {
 		os.Exit(1)
 	}
 
+	recorder, err := a.eventRecorder(ctx, c.Scheme(), nodeName)
+	if err != nil {
+		log.Error(err, "failed to create event recorder")
+		os.Exit(1)
+	}
+
 	metrics, err := metricsserver.NewServer(
 		metricsserver.Options{
 			BindAddress: ":8080",
@@ -119,6 +132,11 @@ func (a *Agent) RunE(cmd *cobra.Command, args []string) error {
 		RuntimeServiceClient: rts,
 		Client:               c,
 		NodeName:             nodeName,
+		MaxFailures:          a.maxFailures,
+		MaxBackoff:           a.maxBackoff,
+		MaxImageFsFraction:   a.maxImageFs,
+		NodeLabels:           a.nodeLabels,
+		Recorder:             recorder,
 	}
 
 	agent := agent.NewAgent(options)
@@ -140,6 +158,10 @@ func (w *Agent) Command() *cobra.Command {
 	cmd.PersistentFlags().StringVarP(&w.containerdAddr, "containerd-addr", "A", DefaultContainerdAddr, "set the containerd address")
 	cmd.PersistentFlags().StringVarP(&w.namespace, "namespace", "n", DefaultNamespace, "limit the coral agent to images in a specific namespace")
 	cmd.PersistentFlags().IntVarP(&w.parallel, "parallel", "p", DefaultParallel, "set the number of parallel workers")
+	cmd.PersistentFlags().IntVarP(&w.maxFailures, "max-failures", "", DefaultMaxFailures, "set the number of failed pulls before an image is marked as an error")
+	cmd.PersistentFlags().DurationVarP(&w.maxBackoff, "max-backoff", "", DefaultMaxBackoff, "set the maximum delay between retries for failed pulls")
+	cmd.PersistentFlags().BoolVarP(&w.nodeLabels, "node-labels", "", DefaultNodeLabels, "project the image state onto node labels (required for selector injection)")
+	cmd.PersistentFlags().Float64VarP(&w.maxImageFs, "max-image-fs-fraction", "", DefaultMaxImageFsFraction, "set the fraction of free image filesystem space that managed images may use (0 disables the check)")
 	return cmd
 }
 
@@ -170,6 +192,23 @@ func (a *Agent) connectContainerRuntime(ctx context.Context, addr string) (crun.
 	return ims, rts, nil
 }
 
+func (a *Agent) eventRecorder(ctx context.Context, scheme *runtime.Scheme, nodeName string) (record.EventRecorder, error) {
+	clientset, err := kubernetes.NewForConfig(config.GetConfigOrDie())
+	if err != nil {
+		return nil, err
+	}
+
+	broadcaster := record.NewBroadcaster(record.WithContext(ctx))
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{
+		Interface: clientset.CoreV1().Events(""),
+	})
+
+	return broadcaster.NewRecorder(scheme, corev1.EventSource{
+		Component: "coral-agent",
+		Host:      nodeName,
+	}), nil
+}
+
 func (a *Agent) connectKubeClient() (client.Client, error) {
 	scheme := runtime.NewScheme()
 	_ = v1.AddToScheme(scheme)
@@ -0,0 +1,225 @@
+// Copyright 2024 Coral Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/containers/image/v5/types"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap/zapcore"
+	"k8s.io/apimachinery/pkg/runtime"
+	crun "k8s.io/cri-api/pkg/apis/runtime/v1"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/config"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	stvziov1 "stvz.io/coral/pkg/apis/stvz.io/v1"
+	"stvz.io/coral/pkg/bundle"
+	"stvz.io/coral/pkg/mirror"
+)
+
+const (
+	BundleUsage     = "bundle [COMMAND]"
+	BundleShortDesc = "Move mirrored images into air-gapped clusters"
+	BundleLongDesc  = `Exports the images referenced by Mirror and Image resources into an OCI layout and imports them into a registry that has no access to the upstream registries.`
+
+	BundleExportUsage     = "export -f FILE [-f FILE...] -o OUTPUT"
+	BundleExportShortDesc = "Export the referenced images into an OCI layout directory or tarball"
+
+	BundleImportUsage     = "import INPUT --registry HOST:PORT"
+	BundleImportShortDesc = "Import the images in a bundle into a registry"
+)
+
+type Bundle struct {
+	logLevel int8
+
+	// export
+	files    []string
+	output   string
+	authFile string
+
+	// import
+	registry      string
+	tlsVerify     bool
+	username      string
+	password      string
+	certDir       string
+	createMirrors bool
+	namespace     string
+}
+
+func NewBundle() *Bundle {
+	return &Bundle{}
+}
+
+func (b *Bundle) setup() {
+	ctrl.SetLogger(zap.New(
+		zap.Level(zapcore.Level(b.logLevel) * -1),
+	).WithName("bundle"))
+}
+
+func (b *Bundle) ExportE(cmd *cobra.Command, args []string) error {
+	b.setup()
+
+	objs, err := bundle.ReadManifests(b.files...)
+	if err != nil {
+		return err
+	}
+
+	index, err := bundle.Export(cmd.Context(), bundle.ExportOptions{
+		Output: b.output,
+		SourceContext: &types.SystemContext{
+			AuthFilePath: b.authFile,
+		},
+	}, objs)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(cmd.OutOrStdout(), "exported %d images to %s\n", len(index.Images), b.output)
+	return nil
+}
+
+func (b *Bundle) ImportE(cmd *cobra.Command, args []string) error {
+	b.setup()
+	ctx := cmd.Context()
+
+	host, p, err := net.SplitHostPort(b.registry)
+	if err != nil {
+		return fmt.Errorf("invalid registry %q: %w", b.registry, err)
+	}
+
+	port, err := strconv.Atoi(p)
+	if err != nil {
+		return fmt.Errorf("invalid registry port %q: %w", p, err)
+	}
+
+	registry := stvziov1.RegistrySpec{
+		Host:      host,
+		Port:      port,
+		TLSVerify: ptr.To(b.tlsVerify),
+	}
+
+	dest := mirror.NewDestination(registry)
+	dest.CertPath = b.certDir
+	if b.username != "" {
+		dest.Auth = &crun.AuthConfig{
+			Username: b.username,
+			Password: b.password,
+		}
+	}
+
+	index, err := bundle.Import(ctx, bundle.ImportOptions{
+		Input:       args[0],
+		Destination: dest,
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(cmd.OutOrStdout(), "imported %d images to %s\n", len(index.Images), registry.Address())
+
+	if !b.createMirrors {
+		return nil
+	}
+
+	scheme := runtime.NewScheme()
+	_ = stvziov1.AddToScheme(scheme)
+
+	c, err := client.New(config.GetConfigOrDie(), client.Options{
+		Scheme: scheme,
+	})
+	if err != nil {
+		return err
+	}
+
+	for i := range index.Mirrors {
+		bundled := &index.Mirrors[i]
+
+		obj := &stvziov1.Mirror{}
+		obj.Name = bundled.Name
+		obj.Namespace = bundled.Namespace
+		if b.namespace != "" {
+			obj.Namespace = b.namespace
+		}
+		if obj.Namespace == "" {
+			obj.Namespace = "default"
+		}
+
+		// The images are already in the target registry, so the mirror only needs to
+		// point at it.
+		result, err := controllerutil.CreateOrUpdate(ctx, c, obj, func() error {
+			obj.Labels = bundled.Labels
+			bundled.Spec.DeepCopyInto(&obj.Spec)
+			obj.Spec.Registry = registry.DeepCopy()
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("unable to create mirror %s/%s: %w", obj.Namespace, obj.Name, err)
+		}
+
+		fmt.Fprintf(cmd.OutOrStdout(), "mirror %s/%s %s\n", obj.Namespace, obj.Name, result)
+	}
+
+	return nil
+}
+
+func (b *Bundle) Command() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   BundleUsage,
+		Short: BundleShortDesc,
+		Long:  BundleLongDesc,
+		Run: func(cmd *cobra.Command, args []string) {
+			_ = cmd.Help()
+		},
+	}
+
+	cmd.PersistentFlags().Int8VarP(&b.logLevel, "log-level", "v", DefaultLogLevel, "set the log level (integer value)")
+
+	export := &cobra.Command{
+		Use:   BundleExportUsage,
+		Short: BundleExportShortDesc,
+		Args:  cobra.NoArgs,
+		RunE:  b.ExportE,
+	}
+	export.Flags().StringArrayVarP(&b.files, "filename", "f", nil, "a file containing Mirror, Image or ClusterImage resources")
+	export.Flags().StringVarP(&b.output, "output", "o", "", "the OCI layout directory, or a tarball if it ends in .tar")
+	export.Flags().StringVarP(&b.authFile, "authfile", "", "", "the path to a containers auth file used to pull the images")
+	_ = export.MarkFlagRequired("filename")
+	_ = export.MarkFlagRequired("output")
+
+	imp := &cobra.Command{
+		Use:   BundleImportUsage,
+		Short: BundleImportShortDesc,
+		Args:  cobra.ExactArgs(1),
+		RunE:  b.ImportE,
+	}
+	imp.Flags().StringVarP(&b.registry, "registry", "", "", "the host and port of the target registry")
+	imp.Flags().BoolVarP(&b.tlsVerify, "tls-verify", "", true, "verify the certificate of the target registry")
+	imp.Flags().StringVarP(&b.username, "username", "", "", "the username for the target registry")
+	imp.Flags().StringVarP(&b.password, "password", "", "", "the password for the target registry")
+	imp.Flags().StringVarP(&b.certDir, "cert-dir", "", "", "a directory containing ca.crt, client.cert and client.key for the target registry")
+	imp.Flags().BoolVarP(&b.createMirrors, "create-mirrors", "", false, "create the bundled Mirror resources pointing at the target registry")
+	imp.Flags().StringVarP(&b.namespace, "namespace", "", "", "the namespace for the created mirrors, defaults to the bundled namespace")
+	_ = imp.MarkFlagRequired("registry")
+
+	cmd.AddCommand(export, imp)
+	return cmd
+}
@@ -21,6 +21,7 @@ import (
 	"github.com/spf13/cobra"
 	"go.uber.org/zap/zapcore"
 	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	ctrl "sigs.k8s.io/controller-runtime"
@@ -28,7 +29,9 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
 	stvziov1 "stvz.io/coral/pkg/apis/stvz.io/v1"
 	"stvz.io/coral/pkg/controller"
+	"stvz.io/coral/pkg/controller/rollout"
 	"stvz.io/coral/pkg/injector"
+	"stvz.io/coral/pkg/injector/image"
 	"stvz.io/coral/pkg/monitor"
 )
 
@@ -44,6 +47,8 @@ type Controller struct {
 	leaderElection     bool
 	skipInsecureVerify bool
 	namespace          string
+	podTemplates       []string
+	podTemplatesFile   string
 
 	scheme *runtime.Scheme
 
@@ -61,6 +66,7 @@ func (c *Controller) RunE(cmd *cobra.Command, args []string) error {
 	_ = stvziov1.AddToScheme(c.scheme)
 	_ = corev1.AddToScheme(c.scheme)
 	_ = appsv1.AddToScheme(c.scheme)
+	_ = batchv1.AddToScheme(c.scheme)
 
 	// TODO: more configurations to mirror bind flags.
 	log := zap.New(
@@ -99,11 +105,41 @@ func (c *Controller) RunE(cmd *cobra.Command, args []string) error {
 		os.Exit(1)
 	}
 
-	if err = injector.SetupWebhookWithManager(mgr); err != nil {
+	if err = (&stvziov1.ClusterImage{}).SetupWebhookWithManager(mgr); err != nil {
+		log.Error(err, "unable to create webhook", "webhook", "ClusterImage")
+		os.Exit(1)
+	}
+
+	if err = (&stvziov1.Mirror{}).SetupWebhookWithManager(mgr); err != nil {
+		log.Error(err, "unable to create webhook", "webhook", "Mirror")
+		os.Exit(1)
+	}
+
+	templates := image.TemplatePaths{}
+	if c.podTemplatesFile != "" {
+		if err = templates.Load(c.podTemplatesFile); err != nil {
+			log.Error(err, "unable to load pod template paths", "file", c.podTemplatesFile)
+			os.Exit(1)
+		}
+	}
+
+	for _, entry := range c.podTemplates {
+		if err = templates.Set(entry); err != nil {
+			log.Error(err, "unable to parse pod template path")
+			os.Exit(1)
+		}
+	}
+
+	if err = injector.SetupWebhookWithManager(mgr, templates); err != nil {
 		log.Error(err, "unable to create webhook", "webhook", "Pod")
 		os.Exit(1)
 	}
 
+	if err = rollout.SetupWebhookWithManager(mgr); err != nil {
+		log.Error(err, "unable to create webhook", "webhook", "Rollout")
+		os.Exit(1)
+	}
+
 	if err = controller.SetupWithManager(mgr); err != nil {
 		log.Error(err, "unable to setup controllers")
 		os.Exit(1)
@@ -130,5 +166,7 @@ func (c *Controller) Command() *cobra.Command {
 	cmd.PersistentFlags().BoolVarP(&c.skipInsecureVerify, "skip-insecure-verify", "", DefaultSkipInsecureVerify, "skip certificate verification for the webhooks")
 	cmd.PersistentFlags().Int8VarP(&c.logLevel, "log-level", "", DefaultLogLevel, "set the log level (integer value)")
 	cmd.PersistentFlags().StringVarP(&c.namespace, "namespace", "n", DefaultNamespace, "limit the coral scope to a specific namespace")
+	cmd.PersistentFlags().StringSliceVarP(&c.podTemplates, "pod-template", "", []string{}, "pod template path of an additional workload kind in the form apiVersion/Kind=path")
+	cmd.PersistentFlags().StringVarP(&c.podTemplatesFile, "pod-templates-file", "", "", "file containing a list of pod template paths for additional workload kinds")
 	return cmd
 }
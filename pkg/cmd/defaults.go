@@ -27,6 +27,12 @@ const (
 	DefaultScope                string        = ""
 	DefaultLabels               string        = "app=coral,component=mirror"
 	DefaultParallel             int           = 1
+	DefaultMaxFailures          int           = 5
+	DefaultMaxBackoff           time.Duration = 10 * time.Minute
+	DefaultRegistryParallel     int           = 2
+	DefaultMaxImageFsFraction   float64       = 0
+	DefaultNodeLabels           bool          = false
+	DefaultExtenderAddr         string        = ":8888"
 
 	ConnectionTimeout  time.Duration = 30 * time.Second
 	MaxCallRecvMsgSize int           = 1024 * 1024 * 32
@@ -15,6 +15,7 @@
 package cmd
 
 import (
+	"bytes"
 	"os"
 	"time"
 
@@ -41,11 +42,16 @@ const (
 )
 
 type Mirror struct {
-	logLevel  int8
-	namespace string
-	scope     string
-	labels    string
-	name      string
+	logLevel                int8
+	namespace               string
+	scope                   string
+	labels                  string
+	name                    string
+	parallel                int
+	registryParallel        int
+	maxBackoff              time.Duration
+	notificationsAddr       string
+	notificationsSecretFile string
 }
 
 func NewMirror() *Mirror {
@@ -81,6 +87,21 @@ func (m *Mirror) RunE(cmd *cobra.Command, args []string) error {
 		os.Exit(1)
 	}
 
+	var secret []byte
+	if m.notificationsAddr != "" {
+		if m.notificationsSecretFile == "" {
+			log.Error(nil, "a notification secret file is required when notifications are enabled")
+			os.Exit(1)
+		}
+
+		secret, err = os.ReadFile(m.notificationsSecretFile)
+		if err != nil {
+			log.Error(err, "failed to read the notification secret")
+			os.Exit(1)
+		}
+		secret = bytes.TrimSpace(secret)
+	}
+
 	log.Info("initializing manager")
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
 		Scheme: scheme,
@@ -102,11 +123,16 @@ func (m *Mirror) RunE(cmd *cobra.Command, args []string) error {
 
 	// Think about moving all the command stuff into directories here in cmd...
 	mirror := command.New(&command.Options{
-		Scope:     m.scope,
-		Namespace: m.namespace,
-		Name:      m.name,
-		Labels:    l,
-		Informer:  informer,
+		Scope:               m.scope,
+		Namespace:           m.namespace,
+		Name:                m.name,
+		Labels:              l,
+		Informer:            informer,
+		Workers:             m.parallel,
+		RegistryParallel:    m.registryParallel,
+		MaxBackoff:          m.maxBackoff,
+		NotificationsAddr:   m.notificationsAddr,
+		NotificationsSecret: secret,
 	})
 
 	log.Info("starting mirror watcher")
@@ -126,5 +152,10 @@ func (m *Mirror) Command() *cobra.Command {
 	cmd.PersistentFlags().StringVarP(&m.namespace, "namespace", "", DefaultNamespace, "the namespace of the deployment to watch for pod changes")
 	cmd.PersistentFlags().StringVarP(&m.labels, "labels", "", DefaultLabels, "the match labels used to identify pods used by the mirror")
 	cmd.PersistentFlags().StringVarP(&m.name, "name", "", "", "the pod name")
+	cmd.PersistentFlags().IntVarP(&m.parallel, "parallel", "p", DefaultParallel, "set the number of parallel copy workers")
+	cmd.PersistentFlags().IntVarP(&m.registryParallel, "registry-parallel", "", DefaultRegistryParallel, "set the number of parallel copies from a single upstream registry, 0 for no limit")
+	cmd.PersistentFlags().DurationVarP(&m.maxBackoff, "max-backoff", "", DefaultMaxBackoff, "set the maximum delay between retries for failed copies")
+	cmd.PersistentFlags().StringVarP(&m.notificationsAddr, "notifications-addr", "", "", "the address of the registry notification endpoint, disabled when empty")
+	cmd.PersistentFlags().StringVarP(&m.notificationsSecretFile, "notifications-secret-file", "", "", "the file containing the shared secret used to sign registry notifications")
 	return cmd
 }
@@ -57,5 +57,7 @@ func (r *Root) Command() *cobra.Command {
 	rootCmd.AddCommand(NewController().Command())
 	rootCmd.AddCommand(NewAgent().Command())
 	rootCmd.AddCommand(NewMirror().Command())
+	rootCmd.AddCommand(NewBundle().Command())
+	rootCmd.AddCommand(NewSchedulerExtender().Command())
 	return rootCmd
 }
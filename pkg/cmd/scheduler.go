@@ -0,0 +1,90 @@
+// Copyright 2024 Coral Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"os"
+
+	"github.com/spf13/cobra"
+	"go.uber.org/zap/zapcore"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	"stvz.io/coral/pkg/scheduler"
+)
+
+const (
+	SchedulerExtenderUsage     = "scheduler-extender [ARG...]"
+	SchedulerExtenderShortDesc = "Start the coral scheduler extender"
+	SchedulerExtenderLongDesc  = `Starts a kube-scheduler extender which filters out the nodes that will never have the images of a pod prefetched and scores the remaining nodes by the share of the image bytes that are already available.`
+)
+
+type SchedulerExtender struct {
+	logLevel int8
+	addr     string
+}
+
+func NewSchedulerExtender() *SchedulerExtender {
+	return &SchedulerExtender{}
+}
+
+func (s *SchedulerExtender) RunE(cmd *cobra.Command, args []string) error {
+	log := zap.New(
+		zap.Level(zapcore.Level(s.logLevel) * -1),
+	).WithName("scheduler-extender")
+
+	scheme := runtime.NewScheme()
+	_ = corev1.AddToScheme(scheme)
+
+	ctx := ctrl.SetupSignalHandler()
+	ctrl.SetLogger(log)
+
+	log.Info("initializing manager")
+	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
+		Scheme: scheme,
+	})
+	if err != nil {
+		log.Error(err, "unable to initialize manager")
+		os.Exit(1)
+	}
+
+	// The client is only used when the scheduler is configured with nodeCacheCapable
+	// and sends the node names instead of the nodes.
+	err = mgr.Add(&scheduler.Extender{
+		Addr:   s.addr,
+		Client: mgr.GetClient(),
+	})
+	if err != nil {
+		log.Error(err, "unable to add the scheduler extender")
+		os.Exit(1)
+	}
+
+	log.Info("starting manager")
+	return mgr.Start(ctx)
+}
+
+func (s *SchedulerExtender) Command() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   SchedulerExtenderUsage,
+		Short: SchedulerExtenderShortDesc,
+		Long:  SchedulerExtenderLongDesc,
+		RunE:  s.RunE,
+	}
+
+	cmd.PersistentFlags().Int8VarP(&s.logLevel, "log-level", "v", DefaultLogLevel, "set the log level (integer value)")
+	cmd.PersistentFlags().StringVarP(&s.addr, "addr", "", DefaultExtenderAddr, "the address the scheduler extender listens on")
+	return cmd
+}
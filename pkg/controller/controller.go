@@ -17,6 +17,9 @@ package controller
 import (
 	ctrl "sigs.k8s.io/controller-runtime"
 	"stvz.io/coral/pkg/controller/image"
+	"stvz.io/coral/pkg/controller/mirror"
+	"stvz.io/coral/pkg/controller/rollout"
+	"stvz.io/coral/pkg/controller/workload"
 )
 
 type ControllerOpts struct{}
@@ -28,5 +31,17 @@ func SetupWithManager(mgr ctrl.Manager) (err error) {
 		return
 	}
 
+	if err = mirror.SetupWithManager(mgr); err != nil {
+		return
+	}
+
+	if err = workload.SetupWithManager(mgr); err != nil {
+		return
+	}
+
+	if err = rollout.SetupWithManager(mgr); err != nil {
+		return
+	}
+
 	return
 }
@@ -19,10 +19,7 @@ import (
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
-	corev1 "k8s.io/api/core/v1"
-	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
-	"k8s.io/apimachinery/pkg/selection"
 	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -30,31 +27,70 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
 	stvziov1 "stvz.io/coral/pkg/apis/stvz.io/v1"
+	"stvz.io/coral/pkg/mirror"
 )
 
 type Controller struct {
 	client.Client
 	Scheme   *runtime.Scheme
 	Recorder record.EventRecorder
+	// NewObject returns an empty object of the kind that is being reconciled.  When
+	// it's not set, the controller reconciles namespaced images.
+	NewObject func() stvziov1.ImageObject
+	// Resolver resolves the image tags to their upstream digests.  Digest resolution
+	// is disabled when it's not set.
+	Resolver DigestResolver
+	// TagSelector expands repository tag selections.  Only the explicit tags are used
+	// when it's not set.
+	TagSelector TagSelector
+	// ResolveInterval is how often the digests and tag selections are resolved to
+	// catch changes upstream.
+	ResolveInterval time.Duration
 }
 
 func SetupWithManager(mgr ctrl.Manager) error {
 	c := &Controller{
+		Client:          mgr.GetClient(),
+		Scheme:          mgr.GetScheme(),
+		Recorder:        mgr.GetEventRecorderFor("image-controller"),
+		Resolver:        mirror.GetDigest,
+		TagSelector:     mirror.SelectTags,
+		ResolveInterval: DefaultResolveInterval,
+	}
+	err := ctrl.NewControllerManagedBy(mgr).
+		For(&stvziov1.Image{}).
+		WithEventFilter(predicate.GenerationChangedPredicate{}).
+		Complete(c)
+	if err != nil {
+		return err
+	}
+
+	cc := &Controller{
 		Client:   mgr.GetClient(),
 		Scheme:   mgr.GetScheme(),
-		Recorder: mgr.GetEventRecorderFor("image-controller"),
+		Recorder: mgr.GetEventRecorderFor("clusterimage-controller"),
+		NewObject: func() stvziov1.ImageObject {
+			return &stvziov1.ClusterImage{}
+		},
+		Resolver:        mirror.GetDigest,
+		TagSelector:     mirror.SelectTags,
+		ResolveInterval: DefaultResolveInterval,
 	}
 	return ctrl.NewControllerManagedBy(mgr).
-		For(&stvziov1.Image{}).
+		For(&stvziov1.ClusterImage{}).
 		WithEventFilter(predicate.GenerationChangedPredicate{}).
-		Complete(c)
+		Complete(cc)
 }
 
 // +kubebuilder:rbac:groups=stvz.io,resources=images,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=stvz.io,resources=images/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=stvz.io,resources=images/finalizers,verbs=update
+// +kubebuilder:rbac:groups=stvz.io,resources=clusterimages,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=stvz.io,resources=clusterimages/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=stvz.io,resources=clusterimages/finalizers,verbs=update
 // +kubebuilder:rbac:groups=core,resources=nodes,verbs=get;list;watch;update;patch
 // +kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch
+// +kubebuilder:rbac:groups=stvz.io,resources=nodeimagestates,verbs=get;list;watch
 
 // Reconcile is the main controller loop for the image controller.
 func (c Controller) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
@@ -63,8 +99,9 @@ func (c Controller) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Resul
 
 	observed := NewObservedState()
 	observer := StateObserver{
-		Client:  c.Client,
-		Request: req,
+		Client:    c.Client,
+		Request:   req,
+		NewObject: c.NewObject,
 	}
 
 	err := observer.observe(ctx, observed)
@@ -88,7 +125,7 @@ func (c Controller) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Resul
 
 	// TODO: Because we don't do anything with the image we could just return without
 	// a requeue here.  Check this out later.
-	if observed.image.DeletionTimestamp.IsZero() { // nolint:nestif
+	if observed.image.GetDeletionTimestamp().IsZero() { // nolint:nestif
 		has := controllerutil.ContainsFinalizer(observed.image, stvziov1.Finalizer)
 		if !has {
 			logger.V(8).Info("adding finalizer and monitor", "finalizer", stvziov1.Finalizer)
@@ -122,7 +159,15 @@ func (c Controller) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Resul
 		return ctrl.Result{}, nil
 	}
 
-	observed.image.Status.Data = observed.image.GetStatusData()
+	repos := c.resolveRepositories(ctx, observed.image)
+	data := stvziov1.NewImageData(repos)
+	if c.Resolver != nil {
+		data = c.resolveDigests(ctx, observed.image, data)
+	}
+
+	status := observed.image.GetImageStatus()
+	status.Repositories = repos
+	status.Data = data
 	err = c.Client.Status().Update(ctx, observed.image)
 	if err != nil {
 		return ctrl.Result{
@@ -130,39 +175,39 @@ func (c Controller) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Resul
 		}, err
 	}
 
+	// Tags can be added or moved upstream at any time, so keep resolving them.
+	if c.Resolver != nil || c.TagSelector != nil {
+		return ctrl.Result{
+			RequeueAfter: c.ResolveInterval,
+		}, nil
+	}
+
 	return ctrl.Result{}, nil
 }
 
-func (c *Controller) finish(ctx context.Context, image *stvziov1.Image) error {
+func (c *Controller) finish(ctx context.Context, image stvziov1.ImageObject) error {
 	logger := log.FromContext(ctx)
 
-	// I only care if there are nodes that still have any images present?
-	selectors := labels.NewSelector()
-
-	// If the image has selectors, we need to add those.
-	if image.Spec.Selector != nil {
-		for _, selector := range image.Spec.Selector {
-			req, err := labels.NewRequirement(selector.Key, selector.Operator, selector.Values)
-			if err != nil {
-				return err
-			}
-			selectors = selectors.Add(*req)
-		}
+	// Only the node image state is checked since the agent keeps each image it has
+	// pulled in the state until it has been removed from the node.
+	states := new(stvziov1.NodeImageStateList)
+	err := c.Client.List(ctx, states)
+	if err != nil {
+		return err
 	}
 
 	// TODO: There's a condition here where if the image is also assigned to a node
 	// by another object, then the image would not be deleted and we would be stuck
 	// here forever.  We could potentially get around this by adding a name/namespace
 	// itentifier to the label?  Will revisit this later.
-	for _, i := range image.Spec.Repositories {
+	repos := image.GetImageStatus().Repositories
+	if len(repos) == 0 {
+		repos = image.GetRepositories().Explicit()
+	}
+
+	for _, i := range repos {
 		for _, tag := range i.Tags {
-			tagSelectors := selectors.DeepCopySelector()
-			label := stvziov1.HashedImageLabelKey(*i.Name + ":" + tag)
-			reqs, err := labels.NewRequirement(label, selection.Exists, nil)
-			if err != nil {
-				return err
-			}
-			tagSelectors = tagSelectors.Add(*reqs)
+			label := stvziov1.HashedImageLabelKey(i.Name + ":" + tag)
 
 			// If there are nodes that still have the image present, then we don't delete
 			// the finalizer.  This will keep the image resource around so the node worker
@@ -173,14 +218,10 @@ func (c *Controller) finish(ctx context.Context, image *stvziov1.Image) error {
 			// allows us to visualize that the entire cluster is in a consistent state.  I could
 			// set a timeout to remove the finalizer if the nodes are not cleaned up in a certain
 			// amount of time by using the deletion timestamp.
-			nodes := new(corev1.NodeList)
-			err = c.Client.List(ctx, nodes, &client.ListOptions{LabelSelector: tagSelectors})
-			if err != nil {
-				return err
-			}
-
-			if len(nodes.Items) > 0 {
-				return ErrNodesNotEmpty
+			for _, state := range states.Items {
+				if state.HasLabel(label) {
+					return ErrNodesNotEmpty
+				}
 			}
 		}
 	}
@@ -15,12 +15,16 @@
 package image
 
 import (
+	"context"
+	"errors"
 	"path"
+	"time"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
-	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
+	runtime "k8s.io/cri-api/pkg/apis/runtime/v1"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
@@ -70,6 +74,127 @@ var _ = Describe("Controller", func() {
 			Expect(image.ObjectMeta.Finalizers).To(ContainElement(stvziov1.Finalizer))
 		})
 
+		It("should add the finalizer and status data to a new cluster image", func() {
+			nn := types.NamespacedName{
+				Name: "sidecars",
+			}
+
+			By("mocking a new client")
+			c := mock.NewClient().WithLogger(logger).WithFixtureOrDie(
+				path.Join(fixtures, "cluster_image_step_1.yaml"),
+			)
+
+			By("creating a new controller for cluster images")
+			controller := &Controller{
+				Client: c,
+				NewObject: func() stvziov1.ImageObject {
+					return &stvziov1.ClusterImage{}
+				},
+			}
+
+			By("reconciling the object")
+			_, err := controller.Reconcile(ctx, reconcile.Request{
+				NamespacedName: nn,
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			By("checking if the object has the finalizer and status data")
+			image := &stvziov1.ClusterImage{}
+			err = c.Get(ctx, nn, image)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(image.ObjectMeta.Finalizers).To(ContainElement(stvziov1.Finalizer))
+			Expect(image.Status.Data).To(HaveLen(1))
+			Expect(image.Status.Data[0].Name).To(Equal("docker.io/library/busybox:1.36"))
+		})
+
+		It("should resolve the digests and keep the previous digest on failure", func() {
+			nn := types.NamespacedName{
+				Name: "sidecars",
+			}
+
+			By("mocking a new client")
+			c := mock.NewClient().WithLogger(logger).WithFixtureOrDie(
+				path.Join(fixtures, "cluster_image_step_1.yaml"),
+			)
+
+			By("creating a new controller with a resolver")
+			digest := "sha256:aaa"
+			controller := &Controller{
+				Client: c,
+				NewObject: func() stvziov1.ImageObject {
+					return &stvziov1.ClusterImage{}
+				},
+				Resolver: func(_ context.Context, _ *runtime.AuthConfig, name string) (string, error) {
+					if digest == "" {
+						return "", errors.New("registry unavailable")
+					}
+					return digest, nil
+				},
+				ResolveInterval: time.Minute,
+			}
+
+			By("reconciling the object")
+			response, err := controller.Reconcile(ctx, reconcile.Request{
+				NamespacedName: nn,
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(response.RequeueAfter).To(Equal(time.Minute))
+
+			image := &stvziov1.ClusterImage{}
+			err = c.Get(ctx, nn, image)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(image.Status.Data).To(HaveLen(1))
+			Expect(image.Status.Data[0].Digest).To(Equal("sha256:aaa"))
+
+			By("reconciling the object while the registry is unavailable")
+			digest = ""
+			_, err = controller.Reconcile(ctx, reconcile.Request{
+				NamespacedName: nn,
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			err = c.Get(ctx, nn, image)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(image.Status.Data[0].Digest).To(Equal("sha256:aaa"))
+		})
+
+		It("should expand the tag selections into the status", func() {
+			nn := types.NamespacedName{
+				Name: "selected",
+			}
+
+			By("mocking a new client")
+			c := mock.NewClient().WithLogger(logger).WithFixtureOrDie(
+				path.Join(fixtures, "cluster_image_selection.yaml"),
+			)
+
+			By("creating a new controller with a tag selector")
+			controller := &Controller{
+				Client: c,
+				NewObject: func() stvziov1.ImageObject {
+					return &stvziov1.ClusterImage{}
+				},
+				TagSelector: func(_ context.Context, _ *runtime.AuthConfig, repo stvziov1.RepositorySpec) ([]string, error) {
+					return append(repo.Tags, "1.25.0", "1.26.0"), nil
+				},
+				ResolveInterval: time.Minute,
+			}
+
+			By("reconciling the object")
+			_, err := controller.Reconcile(ctx, reconcile.Request{
+				NamespacedName: nn,
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			image := &stvziov1.ClusterImage{}
+			err = c.Get(ctx, nn, image)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(image.Status.Repositories).To(HaveLen(2))
+			Expect(image.Status.Repositories[0].Tags).To(Equal([]string{"1.24.0", "1.25.0", "1.26.0"}))
+			Expect(image.Status.Repositories[1].Tags).To(Equal([]string{"1.36"}))
+			Expect(image.Status.Data).To(HaveLen(4))
+		})
+
 		It("should add a monitor for the new object after it has been updated with the finalizer", func() {
 			nn := types.NamespacedName{
 				Namespace: "default",
@@ -121,26 +246,32 @@ var _ = Describe("Controller", func() {
 			Expect(err).ToNot(HaveOccurred())
 			Expect(controllerutil.ContainsFinalizer(image, stvziov1.Finalizer)).To(BeTrue())
 
-			By("adding the image labels to the nodes")
-			labels := map[string]string{
-				stvziov1.HashedImageLabelKey("docker.io/library/debian:bookworm-slim"): "available",
-				stvziov1.HashedImageLabelKey("docker.io/library/debian:bullseye-slim"): "available",
+			By("adding the images to the node image states")
+			images := []stvziov1.NodeImage{
+				{
+					Name:  "docker.io/library/debian:bookworm-slim",
+					Label: stvziov1.HashedImageLabelKey("docker.io/library/debian:bookworm-slim"),
+					State: stvziov1.ImageStateAvailable,
+				},
+				{
+					Name:  "docker.io/library/debian:bullseye-slim",
+					Label: stvziov1.HashedImageLabelKey("docker.io/library/debian:bullseye-slim"),
+					State: stvziov1.ImageStateAvailable,
+				},
 			}
 
-			var node1 = &corev1.Node{}
-			err = c.Get(ctx, types.NamespacedName{Name: "node1"}, node1)
-			Expect(err).ToNot(HaveOccurred())
-
-			var node2 = &corev1.Node{}
-			err = c.Get(ctx, types.NamespacedName{Name: "node2"}, node2)
-			Expect(err).ToNot(HaveOccurred())
-
-			node1.SetLabels(labels)
-			err = c.Update(ctx, node1)
+			var node1 = &stvziov1.NodeImageState{
+				ObjectMeta: metav1.ObjectMeta{Name: "node1"},
+				Status:     stvziov1.NodeImageStateStatus{TotalImages: 2, Images: images},
+			}
+			err = c.Create(ctx, node1)
 			Expect(err).ToNot(HaveOccurred())
 
-			node2.SetLabels(labels)
-			err = c.Update(ctx, node2)
+			var node2 = &stvziov1.NodeImageState{
+				ObjectMeta: metav1.ObjectMeta{Name: "node2"},
+				Status:     stvziov1.NodeImageStateStatus{TotalImages: 2, Images: images},
+			}
+			err = c.Create(ctx, node2)
 			Expect(err).ToNot(HaveOccurred())
 
 			By("creating a new controller")
@@ -160,21 +291,21 @@ var _ = Describe("Controller", func() {
 			err = c.Delete(ctx, image)
 			Expect(err).ToNot(HaveOccurred())
 
-			By("reconciling the object while the nodes still have the image labels")
+			By("reconciling the object while the nodes still have the images")
 			response, err = controller.Reconcile(ctx, reconcile.Request{
 				NamespacedName: nn,
 			})
 			Expect(err).ToNot(HaveOccurred())
 			Expect(response.RequeueAfter).ToNot(BeNil())
 
-			By("checking if the object still has the finalizer while the nodes still are labeled")
+			By("checking if the object still has the finalizer while the nodes still have the images")
 			err = c.Get(ctx, nn, image)
 			Expect(err).ToNot(HaveOccurred())
 			Expect(image.DeletionTimestamp.IsZero()).To(BeFalse())
 			Expect(controllerutil.ContainsFinalizer(image, stvziov1.Finalizer)).To(BeTrue())
 
-			By("removing the label from a single node, leaving the other node available")
-			node1.SetLabels(map[string]string{})
+			By("removing the images from a single node, leaving the other node available")
+			node1.Status = stvziov1.NodeImageStateStatus{}
 			err = c.Update(ctx, node1)
 			Expect(err).ToNot(HaveOccurred())
 
@@ -185,13 +316,13 @@ var _ = Describe("Controller", func() {
 			Expect(err).ToNot(HaveOccurred())
 			Expect(response.RequeueAfter).ToNot(BeNil())
 
-			By("checking if the object still has the finalizer while the last node is still labeled")
+			By("checking if the object still has the finalizer while the last node still has the images")
 			err = c.Get(ctx, nn, image)
 			Expect(err).ToNot(HaveOccurred())
 			Expect(controllerutil.ContainsFinalizer(image, stvziov1.Finalizer)).To(BeTrue())
 
-			By("removing the label from the final node")
-			node2.SetLabels(map[string]string{})
+			By("removing the images from the final node")
+			node2.Status = stvziov1.NodeImageStateStatus{}
 			err = c.Update(ctx, node2)
 			Expect(err).ToNot(HaveOccurred())
 
@@ -0,0 +1,82 @@
+// Copyright 2024 Coral Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package image
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	runtime "k8s.io/cri-api/pkg/apis/runtime/v1"
+	"k8s.io/kubernetes/pkg/credentialprovider"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	stvziov1 "stvz.io/coral/pkg/apis/stvz.io/v1"
+	"stvz.io/coral/pkg/credentials"
+)
+
+// DefaultResolveInterval is the default interval between digest resolutions.
+const DefaultResolveInterval = 5 * time.Minute
+
+// DigestResolver resolves an image reference to the digest of it's manifest in the
+// upstream registry.
+type DigestResolver func(ctx context.Context, auth *runtime.AuthConfig, name string) (string, error)
+
+// resolveDigests sets the upstream digest for each of the image tags.  If a tag can
+// not be resolved, the previously resolved digest is kept so a registry outage does
+// not mark every node as stale.
+func (c *Controller) resolveDigests(ctx context.Context, image stvziov1.ImageObject, data []stvziov1.ImageData) []stvziov1.ImageData {
+	logger := log.FromContext(ctx)
+
+	previous := make(map[string]string)
+	for _, d := range image.GetImageStatus().Data {
+		previous[d.Name] = d.Digest
+	}
+
+	keyring, err := credentials.KeyringFor(ctx, c.Client, image.GetPullSecrets())
+	if err != nil {
+		logger.Error(err, "unable to load pull secrets, resolving without credentials")
+		keyring = credentialprovider.NewDockerKeyring()
+	}
+
+	for i := range data {
+		digest, err := c.resolve(ctx, keyring, data[i].Name)
+		if err != nil {
+			logger.Error(err, "unable to resolve digest", "image", data[i].Name)
+			resolveError.With(prometheus.Labels{
+				"name":      image.GetName(),
+				"namespace": image.GetNamespace(),
+			}).Inc()
+			data[i].Digest = previous[data[i].Name]
+			continue
+		}
+
+		data[i].Digest = digest
+	}
+
+	return data
+}
+
+// resolve tries each of the credentials that match the image and falls back to an
+// anonymous request when there are none.
+func (c *Controller) resolve(ctx context.Context, keyring credentialprovider.DockerKeyring, name string) (string, error) {
+	var digest string
+	err := credentials.WithAuth(keyring, name, func(auth *runtime.AuthConfig) error {
+		var err error
+		digest, err = c.Resolver(ctx, auth, name)
+		return err
+	})
+
+	return digest, err
+}
@@ -27,8 +27,26 @@ var (
 		},
 		[]string{"name", "namespace"},
 	)
+
+	selectError = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "coral_image_controller_select_error",
+			Help: "The number of errors that occurred while selecting repository tags.",
+		},
+		[]string{"name", "namespace"},
+	)
+
+	resolveError = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "coral_image_controller_resolve_error",
+			Help: "The number of errors that occurred while resolving image digests.",
+		},
+		[]string{"name", "namespace"},
+	)
 )
 
 func init() {
 	metrics.Registry.MustRegister(observerError)
+	metrics.Registry.MustRegister(resolveError)
+	metrics.Registry.MustRegister(selectError)
 }
@@ -25,7 +25,7 @@ import (
 )
 
 type ObservedState struct {
-	image       *stvziov1.Image
+	image       stvziov1.ImageObject
 	nodes       *corev1.NodeList
 	observeTime time.Time
 }
@@ -39,13 +39,18 @@ func NewObservedState() *ObservedState {
 }
 
 type StateObserver struct {
-	Client  client.Client
-	Request ctrl.Request
+	Client    client.Client
+	Request   ctrl.Request
+	NewObject func() stvziov1.ImageObject
 }
 
 func (o *StateObserver) observe(ctx context.Context, observed *ObservedState) error {
 	var err error
-	var observedImage = new(stvziov1.Image)
+	var observedImage stvziov1.ImageObject = new(stvziov1.Image)
+	if o.NewObject != nil {
+		observedImage = o.NewObject()
+	}
+
 	err = o.Client.Get(ctx, o.Request.NamespacedName, observedImage)
 	if err != nil {
 		if client.IgnoreNotFound(err) != nil {
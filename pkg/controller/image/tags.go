@@ -0,0 +1,81 @@
+// Copyright 2024 Coral Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package image
+
+import (
+	"context"
+
+	"github.com/prometheus/client_golang/prometheus"
+	runtime "k8s.io/cri-api/pkg/apis/runtime/v1"
+	"k8s.io/kubernetes/pkg/credentialprovider"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	stvziov1 "stvz.io/coral/pkg/apis/stvz.io/v1"
+	"stvz.io/coral/pkg/credentials"
+)
+
+// TagSelector expands the tag selection for a repository into a concrete list of
+// tags using the upstream registry.
+type TagSelector func(ctx context.Context, auth *runtime.AuthConfig, repo stvziov1.RepositorySpec) ([]string, error)
+
+// resolveRepositories expands any tag selections into concrete tags.  If a selection
+// can't be expanded, the previously resolved tags for the repository are kept so
+// images are not removed from the nodes because of a registry outage.
+func (c *Controller) resolveRepositories(ctx context.Context, image stvziov1.ImageObject) []stvziov1.RepositoryStatus {
+	repos := image.GetRepositories().Explicit()
+	if c.TagSelector == nil {
+		return repos
+	}
+
+	logger := log.FromContext(ctx)
+
+	previous := make(map[string][]string)
+	for _, r := range image.GetImageStatus().Repositories {
+		previous[r.Name] = r.Tags
+	}
+
+	keyring, err := credentials.KeyringFor(ctx, c.Client, image.GetPullSecrets())
+	if err != nil {
+		logger.Error(err, "unable to load pull secrets, selecting tags without credentials")
+		keyring = credentialprovider.NewDockerKeyring()
+	}
+
+	for i, repo := range image.GetRepositories() {
+		if repo.Selection == nil {
+			continue
+		}
+
+		var tags []string
+		err := credentials.WithAuth(keyring, *repo.Name, func(auth *runtime.AuthConfig) error {
+			var err error
+			tags, err = c.TagSelector(ctx, auth, repo)
+			return err
+		})
+		if err != nil {
+			logger.Error(err, "unable to select tags", "repository", *repo.Name)
+			selectError.With(prometheus.Labels{
+				"name":      image.GetName(),
+				"namespace": image.GetNamespace(),
+			}).Inc()
+			if tags, ok := previous[*repo.Name]; ok {
+				repos[i].Tags = tags
+			}
+			continue
+		}
+
+		repos[i].Tags = tags
+	}
+
+	return repos
+}
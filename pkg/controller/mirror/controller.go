@@ -2,27 +2,85 @@ package mirror
 
 import (
 	"context"
+	"sync"
+	"time"
 
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/tools/record"
+	crun "k8s.io/cri-api/pkg/apis/runtime/v1"
+	"k8s.io/kubernetes/pkg/credentialprovider"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
 	stvziov1 "stvz.io/coral/pkg/apis/stvz.io/v1"
+	"stvz.io/coral/pkg/credentials"
+	"stvz.io/coral/pkg/mirror"
 )
 
+const DefaultResolveInterval = 5 * time.Minute
+
+// DefaultSyncInterval is how often the status is refreshed while images are still
+// waiting to be mirrored.
+const DefaultSyncInterval = 30 * time.Second
+
+// TagSelector expands the tag selection for a repository into a concrete list of
+// tags using the upstream registry.
+type TagSelector func(ctx context.Context, auth *crun.AuthConfig, repo stvziov1.RepositorySpec) ([]string, error)
+
+// DigestResolver resolves an image reference to the digest the mirrored image is
+// expected to have once the selected platforms have been copied from the upstream
+// registry.
+type DigestResolver func(ctx context.Context, auth *crun.AuthConfig, name string, platforms stvziov1.PlatformSelection) (string, error)
+
+// RegistryChecker verifies the local registry is reachable with the credentials.
+type RegistryChecker func(ctx context.Context, dest *mirror.Destination) error
+
+// DestinationResolver resolves a mirrored image to it's digest and platforms in the
+// local registry.
+type DestinationResolver func(ctx context.Context, dest *mirror.Destination, name string) (mirror.Manifest, error)
+
 type Controller struct {
 	client.Client
 	Scheme   *runtime.Scheme
 	Recorder record.EventRecorder
+	// TagSelector expands repository tag selections.  Only the explicit tags are used
+	// when it's not set.
+	TagSelector TagSelector
+	// Resolver resolves the source digests.  Source digests are not tracked when it's
+	// not set.
+	Resolver DigestResolver
+	// RegistryChecker checks the local registry.  The registry is assumed to be
+	// available when it's not set.
+	RegistryChecker RegistryChecker
+	// DestinationResolver resolves the mirrored digests.  Destination digests are not
+	// tracked when it's not set.
+	DestinationResolver DestinationResolver
+	// ResolveInterval is how often the tag selections and source digests are
+	// resolved.  They are resolved on every reconcile when it's not set.
+	ResolveInterval time.Duration
+	// SyncInterval is how often the status is refreshed while images are pending.
+	SyncInterval time.Duration
+
+	mu sync.Mutex
+	// resolved is the last time the source digests were resolved for each mirror.
+	resolved map[types.NamespacedName]time.Time
 }
 
 func SetupWithManager(mgr ctrl.Manager) error {
 	c := &Controller{
-		Client:   mgr.GetClient(),
-		Scheme:   mgr.GetScheme(),
-		Recorder: mgr.GetEventRecorderFor("mirror-controller"),
+		Client:              mgr.GetClient(),
+		Scheme:              mgr.GetScheme(),
+		Recorder:            mgr.GetEventRecorderFor("mirror-controller"),
+		TagSelector:         mirror.SelectTags,
+		Resolver:            mirror.GetPlatformDigest,
+		RegistryChecker:     mirror.CheckRegistry,
+		DestinationResolver: mirror.InspectDestination,
+		ResolveInterval:     DefaultResolveInterval,
+		SyncInterval:        DefaultSyncInterval,
 	}
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&stvziov1.Mirror{}).
@@ -35,54 +93,213 @@ func SetupWithManager(mgr ctrl.Manager) error {
 // +kubebuilder:rbac:groups=stvz.io,resources=mirrors/finalizers,verbs=update
 // +kubebuilder:rbac:groups=core,resources=pods,verbs=get;list;watch
 // +kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch
+// +kubebuilder:rbac:groups=core,resources=configmaps,verbs=get;list;watch
+// +kubebuilder:rbac:groups=core,resources=events,verbs=create;patch
 
 func (c *Controller) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	logger := log.FromContext(ctx)
-	logger.V(6).Info("reconciling image", "request", req)
-
-	// err := observer.observe(ctx, observed)
-	// if err != nil {
-	// 	logger.Error(err, "unable to observe state", "request", req)
-	// 	return ctrl.Result{
-	// 		RequeueAfter: 10 * time.Second,
-	// 	}, err
-	// }
-
-	// The image has been deleted.
-	// if observed.mirror == nil {
-	// 	return ctrl.Result{}, nil
-	// }
-
-	// logger.V(8).Info("observed mirror", "obj", observed.mirror)
-
-	// desired, err := GetDesiredState(observed)
-	// if err != nil {
-	// 	logger.Error(err, "unable to get desired state", "request", req)
-	// 	return ctrl.Result{
-	// 		RequeueAfter: 10 * time.Second,
-	// 	}, err
-	// }
-
-	// logger.V(8).Info("desired state", "obj", desired)
-	// err = c.reconcileDeployment(ctx, observed.deployment, desired.deployment)
-	// if err != nil {
-	// 	logger.Error(err, "unable to reconcile deployment", "request", req)
-	// 	return ctrl.Result{
-	// 		RequeueAfter: 10 * time.Second,
-	// 	}, err
-	// }
+	logger.V(6).Info("reconciling mirror", "request", req)
+
+	observed := &stvziov1.Mirror{}
+	err := c.Get(ctx, req.NamespacedName, observed)
+	if err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	// The images are left in the local registry when the mirror is deleted since
+	// other mirrors may share them, so there is nothing to clean up.
+	if !observed.GetDeletionTimestamp().IsZero() {
+		c.forget(req.NamespacedName)
+		if controllerutil.ContainsFinalizer(observed, stvziov1.MirrorFinalizer) {
+			logger.V(8).Info("removing finalizer", "finalizer", stvziov1.MirrorFinalizer)
+			controllerutil.RemoveFinalizer(observed, stvziov1.MirrorFinalizer)
+			err = c.Update(ctx, observed)
+			if err != nil {
+				return ctrl.Result{
+					RequeueAfter: 10 * time.Second,
+				}, err
+			}
+		}
+		return ctrl.Result{}, nil
+	}
+
+	if !controllerutil.ContainsFinalizer(observed, stvziov1.MirrorFinalizer) {
+		logger.V(8).Info("adding finalizer", "finalizer", stvziov1.MirrorFinalizer)
+		controllerutil.AddFinalizer(observed, stvziov1.MirrorFinalizer)
+		err = c.Update(ctx, observed)
+		if err != nil {
+			return ctrl.Result{
+				RequeueAfter: 10 * time.Second,
+			}, err
+		}
+	}
+
+	keyring := c.keyring(ctx, observed)
+	now := time.Now()
+	due := c.sourcesDue(req.NamespacedName, observed, now)
+
+	// Resolve the tag selections so the mirror workers only act on concrete tags.
+	repos := c.resolveRepositories(ctx, keyring, observed, due)
+	dest, registryErr := c.checkRegistry(ctx, observed)
+	if registryErr != nil {
+		logger.Error(registryErr, "registry is unavailable")
+		if c.Recorder != nil {
+			c.Recorder.Event(observed, corev1.EventTypeWarning, ReasonRegistryUnavailable, registryErr.Error())
+		}
+	}
+
+	images := c.resolveImages(ctx, keyring, observed, repos, dest, due)
+
+	status := &observed.Status
+	status.ObservedGeneration = observed.Generation
+	status.Repositories = repos
+	status.Images = images
+	SetCounts(status)
+	SetConditions(status, observed.Generation, registryErr)
+
+	err = c.Status().Update(ctx, observed)
+	if err != nil {
+		return ctrl.Result{
+			RequeueAfter: 10 * time.Second,
+		}, err
+	}
+
+	if due {
+		c.markResolved(req.NamespacedName, now)
+	}
+
+	// Keep refreshing the status while the mirror pods are working through the
+	// images, then fall back to the resolve interval to catch upstream changes.
+	if status.TotalImages > status.SyncedImages && c.SyncInterval > 0 {
+		return ctrl.Result{
+			RequeueAfter: c.SyncInterval,
+		}, nil
+	}
+
+	if c.ResolveInterval > 0 {
+		return ctrl.Result{
+			RequeueAfter: c.ResolveInterval,
+		}, nil
+	}
 
 	return ctrl.Result{}, nil
 }
 
-// func (c *Controller) reconcileDeployment(ctx context.Context, observed *appsv1.Deployment, desired *appsv1.Deployment) error {
-// 	if observed == nil && desired != nil {
-// 		return c.Create(ctx, desired)
-// 	}
+// sourcesDue reports if the source digests need to be resolved again.  They are
+// resolved when the spec has changed or the resolve interval has passed, otherwise
+// the digests from the previous status are reused.
+func (c *Controller) sourcesDue(key types.NamespacedName, obj *stvziov1.Mirror, now time.Time) bool {
+	if c.ResolveInterval <= 0 || obj.Status.ObservedGeneration != obj.Generation {
+		return true
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	last, ok := c.resolved[key]
+	return !ok || now.Sub(last) >= c.ResolveInterval
+}
+
+// markResolved records when the source digests for the mirror were resolved.
+func (c *Controller) markResolved(key types.NamespacedName, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
-// 	if observed != nil && desired != nil {
-// 		return c.Update(ctx, observed)
-// 	}
+	if c.resolved == nil {
+		c.resolved = make(map[types.NamespacedName]time.Time)
+	}
+	c.resolved[key] = now
+}
+
+// forget drops the resolve time for a deleted mirror.
+func (c *Controller) forget(key types.NamespacedName) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.resolved, key)
+}
+
+// keyring builds the keyring from the mirror pull secrets.  If the secrets can't be
+// loaded, an empty keyring is used so requests are made without credentials.
+func (c *Controller) keyring(ctx context.Context, obj *stvziov1.Mirror) credentialprovider.DockerKeyring {
+	keys := make([]client.ObjectKey, len(obj.Spec.ImagePullSecrets))
+	for i, s := range obj.Spec.ImagePullSecrets {
+		keys[i] = client.ObjectKey{Name: s.Name, Namespace: obj.Namespace}
+	}
+
+	keyring, err := credentials.KeyringFor(ctx, c.Client, keys)
+	if err != nil {
+		log.FromContext(ctx).Error(err, "unable to load pull secrets, continuing without credentials")
+		return credentialprovider.NewDockerKeyring()
+	}
+
+	return keyring
+}
+
+// checkRegistry loads the registry credentials and certificates and verifies the
+// local registry is reachable with them.  The destination is only returned when the
+// registry is available.
+func (c *Controller) checkRegistry(ctx context.Context, obj *stvziov1.Mirror) (*mirror.Destination, error) {
+	if obj.Spec.Registry == nil {
+		return nil, ErrRegistryNotConfigured
+	}
+
+	dest, err := mirror.LoadDestination(ctx, c.Client, obj.Namespace, *obj.Spec.Registry)
+	if err != nil {
+		return nil, err
+	}
 
-// 	return nil
-// }
+	if c.RegistryChecker != nil {
+		if err := c.RegistryChecker(ctx, dest); err != nil {
+			return nil, err
+		}
+	}
+
+	return dest, nil
+}
+
+// resolveRepositories expands any tag selections into concrete tags.  If a selection
+// can't be expanded or isn't due to be resolved, the previously resolved tags for the
+// repository are kept.
+func (c *Controller) resolveRepositories(ctx context.Context, keyring credentialprovider.DockerKeyring, obj *stvziov1.Mirror, due bool) []stvziov1.RepositoryStatus { //nolint:lll
+	repos := obj.Spec.Repositories.Explicit()
+	if c.TagSelector == nil {
+		return repos
+	}
+
+	logger := log.FromContext(ctx)
+
+	previous := make(map[string][]string)
+	for _, r := range obj.Status.Repositories {
+		previous[r.Name] = r.Tags
+	}
+
+	for i, repo := range obj.Spec.Repositories {
+		if repo.Selection == nil && repo.ListSelection != stvziov1.ListSelectorAll {
+			continue
+		}
+
+		if tags, ok := previous[*repo.Name]; ok && !due {
+			repos[i].Tags = tags
+			continue
+		}
+
+		var tags []string
+		err := credentials.WithAuth(keyring, *repo.Name, func(auth *crun.AuthConfig) error {
+			var err error
+			tags, err = c.TagSelector(ctx, auth, repo)
+			return err
+		})
+		if err != nil {
+			logger.Error(err, "unable to select tags", "repository", *repo.Name)
+			if tags, ok := previous[*repo.Name]; ok {
+				repos[i].Tags = tags
+			}
+			continue
+		}
+
+		repos[i].Tags = tags
+	}
+
+	return repos
+}
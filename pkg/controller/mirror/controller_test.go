@@ -0,0 +1,272 @@
+// Copyright 2024 Coral Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mirror
+
+import (
+	"context"
+	"errors"
+	"path"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	crun "k8s.io/cri-api/pkg/apis/runtime/v1"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	stvziov1 "stvz.io/coral/pkg/apis/stvz.io/v1"
+	"stvz.io/coral/pkg/mirror"
+	"stvz.io/coral/pkg/mock"
+)
+
+var _ = Describe("Controller", func() {
+	nn := types.NamespacedName{
+		Namespace: "default",
+		Name:      "base",
+	}
+
+	source := func(_ context.Context, _ *crun.AuthConfig, name string, _ stvziov1.PlatformSelection) (string, error) {
+		return "sha256:" + name, nil
+	}
+
+	Context("Reconcile", func() {
+		It("should add the finalizer and report pending images", func() {
+			By("mocking a new client")
+			c := mock.NewClient().WithLogger(logger).WithFixtureOrDie(
+				path.Join(fixtures, "mirror_step_1.yaml"),
+			)
+
+			By("creating a new controller")
+			controller := &Controller{
+				Client:   c,
+				Resolver: source,
+				DestinationResolver: func(_ context.Context, _ *mirror.Destination, _ string) (mirror.Manifest, error) {
+					return mirror.Manifest{}, errors.New("manifest unknown")
+				},
+				SyncInterval: 30 * time.Second,
+			}
+
+			By("reconciling the object")
+			response, err := controller.Reconcile(ctx, reconcile.Request{
+				NamespacedName: nn,
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(response.RequeueAfter).To(Equal(30 * time.Second))
+
+			obj := &stvziov1.Mirror{}
+			err = c.Get(ctx, nn, obj)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(obj.Finalizers).To(ContainElement(stvziov1.MirrorFinalizer))
+			Expect(obj.Status.TotalImages).To(Equal(2))
+			Expect(obj.Status.SyncedImages).To(Equal(0))
+			Expect(obj.Status.Images).To(HaveLen(2))
+			Expect(obj.Status.Images[0].Name).To(Equal("docker.io/library/alpine:3.18"))
+			Expect(obj.Status.Images[0].SourceDigest).To(Equal("sha256:docker.io/library/alpine:3.18"))
+			Expect(obj.Status.Images[0].State).To(Equal(stvziov1.MirrorImageStatePending))
+			Expect(meta.IsStatusConditionFalse(obj.Status.Conditions, stvziov1.MirrorConditionReady)).To(BeTrue())
+			Expect(meta.IsStatusConditionTrue(obj.Status.Conditions, stvziov1.MirrorConditionSyncing)).To(BeTrue())
+		})
+
+		It("should report synced images when the digests match", func() {
+			By("mocking a new client")
+			c := mock.NewClient().WithLogger(logger).WithFixtureOrDie(
+				path.Join(fixtures, "mirror_step_1.yaml"),
+			)
+
+			By("creating a new controller")
+			controller := &Controller{
+				Client:   c,
+				Resolver: source,
+				DestinationResolver: func(ctx context.Context, _ *mirror.Destination, name string) (mirror.Manifest, error) {
+					digest, err := source(ctx, nil, name, stvziov1.PlatformSelection{})
+					return mirror.Manifest{Digest: digest}, err
+				},
+			}
+
+			By("reconciling the object")
+			_, err := controller.Reconcile(ctx, reconcile.Request{
+				NamespacedName: nn,
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			obj := &stvziov1.Mirror{}
+			err = c.Get(ctx, nn, obj)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(obj.Status.SyncedImages).To(Equal(2))
+			Expect(obj.Status.Images[1].LastSyncTime).ToNot(BeNil())
+			Expect(meta.IsStatusConditionTrue(obj.Status.Conditions, stvziov1.MirrorConditionReady)).To(BeTrue())
+			Expect(meta.IsStatusConditionFalse(obj.Status.Conditions, stvziov1.MirrorConditionDegraded)).To(BeTrue())
+		})
+
+		It("should not look up synced images again until the resolve interval", func() {
+			By("mocking a new client")
+			c := mock.NewClient().WithLogger(logger).WithFixtureOrDie(
+				path.Join(fixtures, "mirror_step_1.yaml"),
+			)
+
+			By("creating a new controller")
+			sources, destinations := 0, 0
+			controller := &Controller{
+				Client: c,
+				Resolver: func(ctx context.Context, auth *crun.AuthConfig, name string, platforms stvziov1.PlatformSelection) (string, error) {
+					sources++
+					return source(ctx, auth, name, platforms)
+				},
+				DestinationResolver: func(_ context.Context, _ *mirror.Destination, name string) (mirror.Manifest, error) {
+					destinations++
+					if name == "docker.io/library/alpine:3.18" {
+						return mirror.Manifest{}, errors.New("manifest unknown")
+					}
+					return mirror.Manifest{Digest: "sha256:" + name}, nil
+				},
+				ResolveInterval: 5 * time.Minute,
+				SyncInterval:    30 * time.Second,
+			}
+
+			By("reconciling the object")
+			_, err := controller.Reconcile(ctx, reconcile.Request{
+				NamespacedName: nn,
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(sources).To(Equal(2))
+			Expect(destinations).To(Equal(2))
+
+			By("reconciling the object again")
+			_, err = controller.Reconcile(ctx, reconcile.Request{
+				NamespacedName: nn,
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(sources).To(Equal(2))
+			Expect(destinations).To(Equal(3))
+
+			obj := &stvziov1.Mirror{}
+			err = c.Get(ctx, nn, obj)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(obj.Status.SyncedImages).To(Equal(1))
+			Expect(obj.Status.Images[0].SourceDigest).To(Equal("sha256:docker.io/library/alpine:3.18"))
+			Expect(obj.Status.Images[0].State).To(Equal(stvziov1.MirrorImageStatePending))
+
+			By("reconciling the object after the resolve interval")
+			controller.markResolved(nn, time.Now().Add(-10*time.Minute))
+			_, err = controller.Reconcile(ctx, reconcile.Request{
+				NamespacedName: nn,
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(sources).To(Equal(4))
+			Expect(destinations).To(Equal(5))
+		})
+
+		It("should resolve the digests for the selected platforms", func() {
+			By("mocking a new client")
+			c := mock.NewClient().WithLogger(logger).WithFixtureOrDie(
+				path.Join(fixtures, "mirror_platforms.yaml"),
+			)
+
+			digest := func(name string, platforms stvziov1.PlatformSelection) string {
+				return "sha256:" + name + "/" + string(platforms.Mode)
+			}
+
+			By("creating a new controller")
+			controller := &Controller{
+				Client: c,
+				Resolver: func(_ context.Context, _ *crun.AuthConfig, name string, platforms stvziov1.PlatformSelection) (string, error) {
+					return digest(name, platforms), nil
+				},
+				DestinationResolver: func(_ context.Context, _ *mirror.Destination, name string) (mirror.Manifest, error) {
+					return mirror.Manifest{
+						Digest:    digest(name, stvziov1.PlatformSelection{Mode: stvziov1.PlatformModeList}),
+						Platforms: []string{"linux/amd64"},
+					}, nil
+				},
+			}
+
+			By("reconciling the object")
+			key := types.NamespacedName{Namespace: "default", Name: "platforms"}
+			_, err := controller.Reconcile(ctx, reconcile.Request{
+				NamespacedName: key,
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			obj := &stvziov1.Mirror{}
+			err = c.Get(ctx, key, obj)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(obj.Status.Images).To(HaveLen(2))
+			Expect(obj.Status.Images[0].SourceDigest).To(Equal("sha256:docker.io/library/alpine:3.19/list"))
+			Expect(obj.Status.Images[0].State).To(Equal(stvziov1.MirrorImageStateSynced))
+			Expect(obj.Status.Images[0].Platforms).To(Equal([]string{"linux/amd64"}))
+			Expect(obj.Status.Images[1].SourceDigest).To(Equal("sha256:docker.io/library/busybox:1.36/all"))
+			Expect(obj.Status.Images[1].State).To(Equal(stvziov1.MirrorImageStatePending))
+		})
+
+		It("should be degraded when the registry is unavailable", func() {
+			By("mocking a new client")
+			c := mock.NewClient().WithLogger(logger).WithFixtureOrDie(
+				path.Join(fixtures, "mirror_step_1.yaml"),
+			)
+
+			By("creating a new controller")
+			controller := &Controller{
+				Client: c,
+				RegistryChecker: func(_ context.Context, _ *mirror.Destination) error {
+					return errors.New("connection refused")
+				},
+			}
+
+			By("reconciling the object")
+			_, err := controller.Reconcile(ctx, reconcile.Request{
+				NamespacedName: nn,
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			obj := &stvziov1.Mirror{}
+			err = c.Get(ctx, nn, obj)
+			Expect(err).ToNot(HaveOccurred())
+			degraded := meta.FindStatusCondition(obj.Status.Conditions, stvziov1.MirrorConditionDegraded)
+			Expect(degraded).ToNot(BeNil())
+			Expect(degraded.Status).To(Equal(metav1.ConditionTrue))
+			Expect(degraded.Reason).To(Equal(ReasonRegistryUnavailable))
+		})
+	})
+
+	Context("ImageState", func() {
+		now := metav1.Now()
+
+		It("should keep failures reported by the workers until the image syncs", func() {
+			img := stvziov1.MirrorImageStatus{
+				Name:         "docker.io/library/alpine:3.19",
+				SourceDigest: "sha256:a",
+				State:        stvziov1.MirrorImageStateFailed,
+				LastError:    "unauthorized",
+			}
+
+			Expect(ImageState(img, nil, now).State).To(Equal(stvziov1.MirrorImageStateFailed))
+
+			img.DestinationDigest = "sha256:a"
+			synced := ImageState(img, nil, now)
+			Expect(synced.State).To(Equal(stvziov1.MirrorImageStateSynced))
+			Expect(synced.LastError).To(BeEmpty())
+			Expect(synced.LastSyncTime).To(Equal(&now))
+		})
+
+		It("should fail when the source can't be resolved", func() {
+			img := ImageState(stvziov1.MirrorImageStatus{
+				State: stvziov1.MirrorImageStatePending,
+			}, errors.New("not found"), now)
+			Expect(img.State).To(Equal(stvziov1.MirrorImageStateFailed))
+			Expect(img.LastError).To(Equal("not found"))
+		})
+	})
+})
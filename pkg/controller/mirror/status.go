@@ -0,0 +1,209 @@
+// Copyright 2024 Coral Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mirror
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	crun "k8s.io/cri-api/pkg/apis/runtime/v1"
+	"k8s.io/kubernetes/pkg/credentialprovider"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	stvziov1 "stvz.io/coral/pkg/apis/stvz.io/v1"
+	"stvz.io/coral/pkg/credentials"
+	"stvz.io/coral/pkg/mirror"
+)
+
+// Condition reasons.
+const (
+	ReasonSynced              = "Synced"
+	ReasonSyncing             = "Syncing"
+	ReasonIdle                = "Idle"
+	ReasonImagesFailed        = "ImagesFailed"
+	ReasonRegistryUnavailable = "RegistryUnavailable"
+	ReasonAsExpected          = "AsExpected"
+)
+
+// resolveImages builds the status for each of the mirrored images.  The source digest
+// is compared with the digest in the local registry to decide if the image has been
+// synced.  Failures reported by the mirror workers are kept until the image syncs.
+// Unless the sources are due to be resolved, images with a known source digest are
+// not looked up upstream again and synced images are not looked up at all.
+func (c *Controller) resolveImages(ctx context.Context, keyring credentialprovider.DockerKeyring, obj *stvziov1.Mirror, repos []stvziov1.RepositoryStatus, dest *mirror.Destination, due bool) []stvziov1.MirrorImageStatus { //nolint:lll
+	logger := log.FromContext(ctx)
+
+	previous := make(map[string]stvziov1.MirrorImageStatus)
+	for _, img := range obj.Status.Images {
+		previous[img.Name] = img
+	}
+
+	now := metav1.Now()
+	images := make([]stvziov1.MirrorImageStatus, 0)
+	for i, repo := range repos {
+		// The resolved repositories are in the same order as the spec.
+		platforms := obj.Spec.PlatformsFor(obj.Spec.Repositories[i])
+		for _, tag := range repo.Tags {
+			name, err := stvziov1.NormalizeRepoTag(repo.Name, tag)
+			if err != nil {
+				logger.Error(err, "unable to normalize image", "repository", repo.Name, "tag", tag)
+				continue
+			}
+
+			prev, ok := previous[name]
+			if !ok {
+				prev = stvziov1.MirrorImageStatus{
+					Name:  name,
+					State: stvziov1.MirrorImageStatePending,
+				}
+			}
+
+			cached := !due && ok && prev.SourceDigest != ""
+			if cached && prev.State == stvziov1.MirrorImageStateSynced {
+				images = append(images, prev)
+				continue
+			}
+
+			img := prev.DeepCopy()
+			var sourceErr error
+			if c.Resolver != nil && !cached {
+				var digest string
+				sourceErr = credentials.WithAuth(keyring, name, func(auth *crun.AuthConfig) error {
+					var err error
+					digest, err = c.Resolver(ctx, auth, name, platforms)
+					return err
+				})
+				if sourceErr == nil {
+					img.SourceDigest = digest
+				}
+			}
+
+			// A missing image in the local registry is expected until the mirror workers
+			// have copied it, so the error is not recorded.
+			if dest != nil && c.DestinationResolver != nil {
+				m, err := c.DestinationResolver(ctx, dest, name)
+				if err != nil {
+					m = mirror.Manifest{}
+				}
+				img.DestinationDigest = m.Digest
+				img.Platforms = m.Platforms
+			}
+
+			images = append(images, ImageState(*img, sourceErr, now))
+		}
+	}
+
+	return images
+}
+
+// ImageState determines the state of the image from the digests.  When the source
+// can't be resolved, the image is failed.  When the digests match, the image is
+// synced and the sync time is updated if it wasn't already synced.
+func ImageState(img stvziov1.MirrorImageStatus, sourceErr error, now metav1.Time) stvziov1.MirrorImageStatus {
+	switch {
+	case sourceErr != nil:
+		img.State = stvziov1.MirrorImageStateFailed
+		img.LastError = sourceErr.Error()
+	case img.SourceDigest != "" && img.SourceDigest == img.DestinationDigest:
+		if img.State != stvziov1.MirrorImageStateSynced || img.LastSyncTime == nil {
+			img.LastSyncTime = &now
+		}
+		img.State = stvziov1.MirrorImageStateSynced
+		img.LastError = ""
+	case img.State == stvziov1.MirrorImageStateFailed && img.LastError != "":
+		// Keep the failure reported by the mirror workers.
+	case img.SourceDigest == "" && img.State == stvziov1.MirrorImageStateSynced:
+		// Without digests there is nothing to compare, so trust the mirror workers.
+	default:
+		img.State = stvziov1.MirrorImageStatePending
+	}
+
+	return img
+}
+
+// SetCounts sets the image counts from the image statuses.
+func SetCounts(status *stvziov1.MirrorStatus) {
+	status.TotalImages = len(status.Images)
+	status.SyncedImages = 0
+	status.FailedImages = 0
+	for _, img := range status.Images {
+		switch img.State { //nolint:exhaustive
+		case stvziov1.MirrorImageStateSynced:
+			status.SyncedImages++
+		case stvziov1.MirrorImageStateFailed:
+			status.FailedImages++
+		}
+	}
+}
+
+// SetConditions sets the Ready, Syncing and Degraded conditions from the image counts
+// and the registry availability.
+func SetConditions(status *stvziov1.MirrorStatus, generation int64, registryErr error) {
+	pending := status.TotalImages - status.SyncedImages - status.FailedImages
+
+	ready := metav1.Condition{
+		Type:               stvziov1.MirrorConditionReady,
+		Status:             metav1.ConditionTrue,
+		Reason:             ReasonSynced,
+		Message:            "all images have been mirrored",
+		ObservedGeneration: generation,
+	}
+	syncing := metav1.Condition{
+		Type:               stvziov1.MirrorConditionSyncing,
+		Status:             metav1.ConditionFalse,
+		Reason:             ReasonIdle,
+		Message:            "no images are waiting to be mirrored",
+		ObservedGeneration: generation,
+	}
+	degraded := metav1.Condition{
+		Type:               stvziov1.MirrorConditionDegraded,
+		Status:             metav1.ConditionFalse,
+		Reason:             ReasonAsExpected,
+		Message:            "the registry is available and no images have failed",
+		ObservedGeneration: generation,
+	}
+
+	if pending > 0 {
+		ready.Status = metav1.ConditionFalse
+		ready.Reason = ReasonSyncing
+		ready.Message = fmt.Sprintf("%d images are waiting to be mirrored", pending)
+		syncing.Status = metav1.ConditionTrue
+		syncing.Reason = ReasonSyncing
+		syncing.Message = ready.Message
+	}
+
+	if status.FailedImages > 0 {
+		ready.Status = metav1.ConditionFalse
+		ready.Reason = ReasonImagesFailed
+		ready.Message = fmt.Sprintf("%d images have failed to be mirrored", status.FailedImages)
+		degraded.Status = metav1.ConditionTrue
+		degraded.Reason = ReasonImagesFailed
+		degraded.Message = ready.Message
+	}
+
+	if registryErr != nil {
+		ready.Status = metav1.ConditionFalse
+		ready.Reason = ReasonRegistryUnavailable
+		ready.Message = registryErr.Error()
+		degraded.Status = metav1.ConditionTrue
+		degraded.Reason = ReasonRegistryUnavailable
+		degraded.Message = registryErr.Error()
+	}
+
+	meta.SetStatusCondition(&status.Conditions, ready)
+	meta.SetStatusCondition(&status.Conditions, syncing)
+	meta.SetStatusCondition(&status.Conditions, degraded)
+}
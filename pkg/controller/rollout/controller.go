@@ -0,0 +1,280 @@
+// Copyright 2024 Coral Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rollout
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	stvziov1 "stvz.io/coral/pkg/apis/stvz.io/v1"
+	"stvz.io/coral/pkg/controller/workload"
+)
+
+// Controller prefetches the images of held workloads through an Image owned by
+// the workload and resumes the rollout once enough of the target nodes have the
+// new images available.
+type Controller struct {
+	client.Client
+	Recorder record.EventRecorder
+
+	// object returns an empty object of the kind handled by the controller.
+	object func() client.Object
+}
+
+func SetupWithManager(mgr ctrl.Manager) error {
+	recorder := mgr.GetEventRecorderFor("rollout-controller")
+
+	err := ctrl.NewControllerManagedBy(mgr).
+		Named("rollout-deployment").
+		For(&appsv1.Deployment{}).
+		Owns(&stvziov1.Image{}).
+		Complete(&Controller{
+			Client:   mgr.GetClient(),
+			Recorder: recorder,
+			object:   func() client.Object { return &appsv1.Deployment{} },
+		})
+	if err != nil {
+		return err
+	}
+
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("rollout-statefulset").
+		For(&appsv1.StatefulSet{}).
+		Owns(&stvziov1.Image{}).
+		Complete(&Controller{
+			Client:   mgr.GetClient(),
+			Recorder: recorder,
+			object:   func() client.Object { return &appsv1.StatefulSet{} },
+		})
+}
+
+// +kubebuilder:rbac:groups=apps,resources=deployments;statefulsets,verbs=get;list;watch;update;patch
+// +kubebuilder:rbac:groups=core,resources=nodes,verbs=get;list;watch
+// +kubebuilder:rbac:groups=core,resources=events,verbs=create;patch
+// +kubebuilder:rbac:groups=stvz.io,resources=images,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=stvz.io,resources=nodeimagestates,verbs=get;list;watch
+
+// Reconcile resumes the rollout of a held workload once its images are available.
+func (c *Controller) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+	logger.V(6).Info("reconciling rollout", "request", req)
+
+	obj := c.object()
+	if err := c.Get(ctx, req.NamespacedName, obj); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	held := Held(obj)
+	if len(held) == 0 || !obj.GetDeletionTimestamp().IsZero() {
+		return ctrl.Result{}, nil
+	}
+
+	if obj.GetLabels()[PrefetchLabel] != "true" {
+		Release(obj)
+		if err := c.Update(ctx, obj); err != nil {
+			return ctrl.Result{}, err
+		}
+
+		c.Recorder.Event(obj, corev1.EventTypeNormal, "RolloutResumed", "rollout resumed since prefetching was disabled")
+		return ctrl.Result{}, nil
+	}
+
+	// Only the images still used by the workload are prefetched, so the rollout
+	// would never be resumed while waiting on any others.
+	spec, _ := podSpec(obj)
+	images := Images(spec)
+	held = slices.DeleteFunc(held, func(image string) bool {
+		return !slices.Contains(images, image)
+	})
+	if len(held) == 0 {
+		Release(obj)
+		if err := c.Update(ctx, obj); err != nil {
+			return ctrl.Result{}, err
+		}
+
+		c.Recorder.Event(obj, corev1.EventTypeNormal, "RolloutResumed", "rollout resumed since none of the held images can be prefetched")
+		return ctrl.Result{}, nil
+	}
+
+	image, err := c.image(ctx, obj)
+	if err != nil {
+		return ctrl.Result{RequeueAfter: 10 * time.Second}, err
+	}
+
+	available, total, err := c.available(ctx, image.Spec.Selector, held)
+	if err != nil {
+		return ctrl.Result{RequeueAfter: 10 * time.Second}, err
+	}
+
+	threshold := Threshold(obj)
+	if total > 0 && float64(available)/float64(total) < threshold {
+		logger.V(4).Info("waiting for images", "name", req.Name, "namespace", req.Namespace, "available", available, "total", total)
+		return ctrl.Result{RequeueAfter: 30 * time.Second}, nil
+	}
+
+	Release(obj)
+	if err := c.Update(ctx, obj); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	c.Recorder.Eventf(obj, corev1.EventTypeNormal, "RolloutResumed",
+		"rollout resumed with %s available on %d of %d nodes", strings.Join(held, ", "), available, total)
+	return ctrl.Result{}, nil
+}
+
+// image creates or updates the Image that prefetches the images of the workload to
+// the nodes matching the node selector of its pod template.
+func (c *Controller) image(ctx context.Context, obj client.Object) (*stvziov1.Image, error) {
+	gvk, err := apiutil.GVKForObject(obj, c.Scheme())
+	if err != nil {
+		return nil, err
+	}
+
+	spec, _ := podSpec(obj)
+	desired := stvziov1.ImageSpec{
+		Selector:         selector(spec.NodeSelector),
+		Repositories:     workload.Repositories([]workload.Workload{{Object: obj, Kind: gvk, Spec: spec}}),
+		ImagePullSecrets: spec.ImagePullSecrets,
+	}
+
+	image := &stvziov1.Image{}
+	name := ImagePrefix + strings.ToLower(gvk.Kind) + "-" + obj.GetName()
+
+	err = c.Get(ctx, types.NamespacedName{Namespace: obj.GetNamespace(), Name: name}, image)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return nil, err
+	}
+
+	if apierrors.IsNotFound(err) {
+		image = &stvziov1.Image{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: obj.GetNamespace(),
+			},
+			Spec: desired,
+		}
+		if err := controllerutil.SetControllerReference(obj, image, c.Scheme()); err != nil {
+			return nil, err
+		}
+		if err := c.Create(ctx, image); err != nil {
+			return nil, err
+		}
+
+		c.Recorder.Eventf(obj, corev1.EventTypeNormal, "PrefetchStarted", "prefetching %s with image %s", strings.Join(Held(obj), ", "), name)
+		return image, nil
+	}
+
+	if equality.Semantic.DeepEqual(image.Spec, desired) {
+		return image, nil
+	}
+
+	image.Spec = desired
+	if err := c.Update(ctx, image); err != nil {
+		return nil, err
+	}
+
+	c.Recorder.Eventf(obj, corev1.EventTypeNormal, "PrefetchStarted", "prefetching %s with image %s", strings.Join(Held(obj), ", "), name)
+	return image, nil
+}
+
+// available returns the number of target nodes that have all of the images
+// available along with the total number of target nodes.  Control plane nodes are
+// excluded in the same way as the monitor.
+func (c *Controller) available(ctx context.Context, selectors []stvziov1.NodeSelector, images []string) (int, int, error) {
+	s := labels.NewSelector()
+	for _, selector := range selectors {
+		req, err := labels.NewRequirement(selector.Key, selector.Operator, selector.Values)
+		if err != nil {
+			return 0, 0, err
+		}
+		s = s.Add(*req)
+	}
+
+	req, err := labels.NewRequirement("node-role.kubernetes.io/control-plane", selection.DoesNotExist, nil)
+	if err != nil {
+		return 0, 0, err
+	}
+	s = s.Add(*req)
+
+	nodes := &corev1.NodeList{}
+	if err := c.List(ctx, nodes, &client.ListOptions{LabelSelector: s}); err != nil {
+		return 0, 0, err
+	}
+
+	states := &stvziov1.NodeImageStateList{}
+	if err := c.List(ctx, states); err != nil {
+		return 0, 0, err
+	}
+
+	nodeStates := make(map[string]map[string]string)
+	for _, nis := range states.Items {
+		nodeStates[nis.Name] = nis.StateByLabel()
+	}
+
+	available := 0
+	for _, node := range nodes.Items {
+		ready := true
+		for _, image := range images {
+			if nodeStates[node.Name][stvziov1.HashedImageLabelKey(image)] != string(stvziov1.ImageStateAvailable) {
+				ready = false
+				break
+			}
+		}
+		if ready {
+			available++
+		}
+	}
+
+	return available, len(nodes.Items), nil
+}
+
+// selector converts the node selector of a pod template to the selector of an Image.
+func selector(nodeSelector map[string]string) []stvziov1.NodeSelector {
+	if len(nodeSelector) == 0 {
+		return nil
+	}
+
+	selectors := make([]stvziov1.NodeSelector, 0, len(nodeSelector))
+	for key, value := range nodeSelector {
+		selectors = append(selectors, stvziov1.NodeSelector{
+			Key:      key,
+			Operator: selection.In,
+			Values:   []string{value},
+		})
+	}
+
+	sort.Slice(selectors, func(i, j int) bool {
+		return selectors[i].Key < selectors[j].Key
+	})
+
+	return selectors
+}
@@ -0,0 +1,139 @@
+// Copyright 2024 Coral Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rollout
+
+import (
+	"path"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/selection"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	stvziov1 "stvz.io/coral/pkg/apis/stvz.io/v1"
+	"stvz.io/coral/pkg/mock"
+)
+
+var _ = Describe("Controller", func() {
+	var c client.Client
+
+	BeforeEach(func() {
+		c = mock.NewClient().WithLogger(logger).WithFixtureOrDie(
+			path.Join(fixtures, "rollout_step_1.yaml"),
+		)
+	})
+
+	reconcileObject := func(controller *Controller, name string) reconcile.Result {
+		response, err := controller.Reconcile(ctx, reconcile.Request{
+			NamespacedName: types.NamespacedName{Namespace: "default", Name: name},
+		})
+		Expect(err).ToNot(HaveOccurred())
+		return response
+	}
+
+	Context("Reconcile", func() {
+		It("should resume the rollout once the threshold is reached", func() {
+			controller := &Controller{
+				Client:   c,
+				Recorder: record.NewFakeRecorder(10),
+				object:   func() client.Object { return &appsv1.Deployment{} },
+			}
+
+			response := reconcileObject(controller, "web")
+			Expect(response.RequeueAfter).To(BeZero())
+
+			By("checking that the image was created for the deployment")
+			image := &stvziov1.Image{}
+			err := c.Get(ctx, types.NamespacedName{Namespace: "default", Name: "coral-rollout-deployment-web"}, image)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(image.Spec.Selector).To(Equal([]stvziov1.NodeSelector{
+				{Key: "pool", Operator: selection.In, Values: []string{"apps"}},
+			}))
+			Expect(image.Spec.Repositories).To(HaveLen(1))
+			Expect(*image.Spec.Repositories[0].Name).To(Equal("docker.io/library/nginx"))
+			Expect(image.OwnerReferences).To(HaveLen(1))
+			Expect(image.OwnerReferences[0].Name).To(Equal("web"))
+
+			By("checking that the deployment was resumed")
+			deployment := &appsv1.Deployment{}
+			err = c.Get(ctx, types.NamespacedName{Namespace: "default", Name: "web"}, deployment)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(deployment.Spec.Paused).To(BeFalse())
+			Expect(deployment.GetAnnotations()).ToNot(HaveKey(HoldAnnotation))
+		})
+
+		It("should resume the rollout when none of the held images can be prefetched", func() {
+			controller := &Controller{
+				Client:   c,
+				Recorder: record.NewFakeRecorder(10),
+				object:   func() client.Object { return &appsv1.Deployment{} },
+			}
+
+			response := reconcileObject(controller, "cache")
+			Expect(response.RequeueAfter).To(BeZero())
+
+			By("checking that no image was created for the deployment")
+			image := &stvziov1.Image{}
+			err := c.Get(ctx, types.NamespacedName{Namespace: "default", Name: "coral-rollout-deployment-cache"}, image)
+			Expect(apierrors.IsNotFound(err)).To(BeTrue())
+
+			deployment := &appsv1.Deployment{}
+			err = c.Get(ctx, types.NamespacedName{Namespace: "default", Name: "cache"}, deployment)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(deployment.Spec.Paused).To(BeFalse())
+			Expect(deployment.GetAnnotations()).ToNot(HaveKey(HoldAnnotation))
+		})
+
+		It("should keep the rollout held until the images are available", func() {
+			controller := &Controller{
+				Client:   c,
+				Recorder: record.NewFakeRecorder(10),
+				object:   func() client.Object { return &appsv1.StatefulSet{} },
+			}
+
+			response := reconcileObject(controller, "db")
+			Expect(response.RequeueAfter).ToNot(BeZero())
+
+			statefulSet := &appsv1.StatefulSet{}
+			err := c.Get(ctx, types.NamespacedName{Namespace: "default", Name: "db"}, statefulSet)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(*statefulSet.Spec.UpdateStrategy.RollingUpdate.Partition).To(Equal(int32(3)))
+			Expect(Held(statefulSet)).To(Equal([]string{"docker.io/library/postgres:17"}))
+
+			By("marking the image as available on the remaining node")
+			state := &stvziov1.NodeImageState{}
+			err = c.Get(ctx, types.NamespacedName{Name: "node-1"}, state)
+			Expect(err).ToNot(HaveOccurred())
+			state.Status.Images = append(state.Status.Images, stvziov1.NodeImage{
+				Name:  "docker.io/library/postgres:17",
+				Label: stvziov1.HashedImageLabelKey("docker.io/library/postgres:17"),
+				State: stvziov1.ImageStateAvailable,
+			})
+			Expect(c.Update(ctx, state)).To(Succeed())
+
+			response = reconcileObject(controller, "db")
+			Expect(response.RequeueAfter).To(BeZero())
+
+			err = c.Get(ctx, types.NamespacedName{Namespace: "default", Name: "db"}, statefulSet)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(statefulSet.Spec.UpdateStrategy.RollingUpdate.Partition).To(BeNil())
+			Expect(statefulSet.GetAnnotations()).To(BeEmpty())
+		})
+	})
+})
@@ -0,0 +1,107 @@
+// Copyright 2024 Coral Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rollout
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/go-logr/logr"
+	admissionv1 "k8s.io/api/admission/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// +kubebuilder:webhook:verbs=update,path=/mutate-stvz-io-v1-rollout-hold,mutating=true,failurePolicy=fail,groups=apps,resources=deployments;statefulsets,versions=v1,name=mrollout.image.stvz.io,admissionReviewVersions=v1,sideEffects=noneOnDryRun
+
+// Holder holds the rollout of opted in workloads when the images in their pod
+// template change so the controller can prefetch the new images first.
+type Holder struct {
+	decoder  *admission.Decoder
+	log      logr.Logger
+	recorder record.EventRecorder
+}
+
+// SetupWebhookWithManager registers the rollout hold webhook.
+func SetupWebhookWithManager(mgr ctrl.Manager) error {
+	mgr.GetWebhookServer().Register("/mutate-stvz-io-v1-rollout-hold", &webhook.Admission{
+		Handler: &Holder{
+			decoder:  admission.NewDecoder(mgr.GetScheme()),
+			log:      mgr.GetLogger().WithName("rollout-hold"),
+			recorder: mgr.GetEventRecorderFor("rollout-hold"),
+		},
+	})
+
+	return nil
+}
+
+func (h *Holder) Handle(_ context.Context, req admission.Request) admission.Response {
+	if req.Operation != admissionv1.Update {
+		return admission.Allowed("")
+	}
+
+	var obj, old client.Object
+	switch req.Kind.Kind {
+	case "Deployment":
+		obj, old = &appsv1.Deployment{}, &appsv1.Deployment{}
+	case "StatefulSet":
+		obj, old = &appsv1.StatefulSet{}, &appsv1.StatefulSet{}
+	default:
+		return admission.Allowed("")
+	}
+
+	if err := h.decoder.DecodeRaw(req.Object, obj); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	if err := h.decoder.DecodeRaw(req.OldObject, old); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+
+	if obj.GetLabels()[PrefetchLabel] != "true" {
+		return admission.Allowed("")
+	}
+
+	updated, _ := podSpec(obj)
+	previous, _ := podSpec(old)
+	changed := Changed(previous, updated)
+	if len(changed) == 0 {
+		return admission.Allowed("")
+	}
+
+	if !Hold(obj, changed) {
+		h.log.V(4).Info("unable to hold rollout", "kind", req.Kind.Kind, "namespace", req.Namespace, "name", req.Name)
+		return admission.Allowed("")
+	}
+
+	marshaled, err := json.Marshal(obj)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+
+	if req.DryRun == nil || !*req.DryRun {
+		h.recorder.Eventf(obj, corev1.EventTypeNormal, "RolloutHeld", "rollout held until %s are prefetched", strings.Join(changed, ", "))
+	}
+
+	return admission.PatchResponseFromRaw(req.Object.Raw, marshaled)
+}
+
+var _ admission.Handler = &Holder{}
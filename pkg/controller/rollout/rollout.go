@@ -0,0 +1,212 @@
+// Copyright 2024 Coral Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rollout
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/containers/image/v5/docker/reference"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// PrefetchLabel opts a Deployment or StatefulSet into holding its rollouts until
+	// the new images have been prefetched.
+	PrefetchLabel = "image.stvz.io/prefetch-rollout"
+	// ThresholdAnnotation is the fraction of the target nodes, between 0 and 1, that
+	// must have the new images available before the rollout is resumed.
+	ThresholdAnnotation = "image.stvz.io/prefetch-threshold"
+	// HoldAnnotation lists the images that the rollout is waiting on.
+	HoldAnnotation = "image.stvz.io/rollout-hold"
+	// PartitionAnnotation stores the rolling update partition of a StatefulSet while
+	// the rollout is held.  It's empty when the partition wasn't set.
+	PartitionAnnotation = "image.stvz.io/rollout-partition"
+	// ImagePrefix is the prefix of the Image maintained for each workload.
+	ImagePrefix = "coral-rollout-"
+	// DefaultThreshold is used when the threshold annotation is missing or invalid.
+	DefaultThreshold = 1.0
+)
+
+// podSpec returns the pod template spec of a supported workload.
+func podSpec(obj client.Object) (corev1.PodSpec, bool) {
+	switch o := obj.(type) {
+	case *appsv1.Deployment:
+		return o.Spec.Template.Spec, true
+	case *appsv1.StatefulSet:
+		return o.Spec.Template.Spec, true
+	default:
+		return corev1.PodSpec{}, false
+	}
+}
+
+// Images returns the normalized NAME:TAG of the images used by the containers and
+// init containers of the pod spec.  Images that are untagged, use the latest tag or
+// are referenced only by a digest are skipped, the same as the generated Images,
+// since they aren't prefetched.
+func Images(spec corev1.PodSpec) []string {
+	var images []string
+	for _, c := range append(slices.Clone(spec.InitContainers), spec.Containers...) {
+		named, err := reference.ParseNormalizedNamed(c.Image)
+		if err != nil {
+			continue
+		}
+
+		tagged, ok := named.(reference.Tagged)
+		if !ok || tagged.Tag() == "latest" {
+			continue
+		}
+
+		image := reference.TrimNamed(named).String() + ":" + tagged.Tag()
+		if !slices.Contains(images, image) {
+			images = append(images, image)
+		}
+	}
+
+	slices.Sort(images)
+	return images
+}
+
+// Changed returns the images in the updated pod spec that weren't used by the
+// previous pod spec.
+func Changed(previous, updated corev1.PodSpec) []string {
+	old := Images(previous)
+
+	var changed []string
+	for _, image := range Images(updated) {
+		if !slices.Contains(old, image) {
+			changed = append(changed, image)
+		}
+	}
+
+	return changed
+}
+
+// Held returns the images that the rollout of the workload is waiting on.
+func Held(obj client.Object) []string {
+	value := obj.GetAnnotations()[HoldAnnotation]
+	if value == "" {
+		return nil
+	}
+
+	return strings.Split(value, ",")
+}
+
+// Threshold returns the fraction of the target nodes that must have the images
+// available before the rollout is resumed.
+func Threshold(obj client.Object) float64 {
+	value, ok := obj.GetAnnotations()[ThresholdAnnotation]
+	if !ok {
+		return DefaultThreshold
+	}
+
+	threshold, err := strconv.ParseFloat(value, 64)
+	if err != nil || threshold < 0 || threshold > 1 {
+		return DefaultThreshold
+	}
+
+	return threshold
+}
+
+// Hold pauses the rollout of the workload until the images have been prefetched.
+// Deployments are paused and StatefulSets using rolling updates have their partition
+// raised to the number of replicas.  Workloads that are already held have the images
+// added to the list.  It returns false if the rollout can't be held, which is the
+// case when there are no images, for Deployments that were paused by someone else and
+// StatefulSets using the OnDelete strategy.
+func Hold(obj client.Object, images []string) bool {
+	if len(images) == 0 {
+		return false
+	}
+
+	held := Held(obj)
+
+	switch o := obj.(type) {
+	case *appsv1.Deployment:
+		if len(held) == 0 && o.Spec.Paused {
+			return false
+		}
+		o.Spec.Paused = true
+	case *appsv1.StatefulSet:
+		if o.Spec.UpdateStrategy.Type == appsv1.OnDeleteStatefulSetStrategyType {
+			return false
+		}
+		if o.Spec.UpdateStrategy.RollingUpdate == nil {
+			o.Spec.UpdateStrategy.RollingUpdate = &appsv1.RollingUpdateStatefulSetStrategy{}
+		}
+
+		rolling := o.Spec.UpdateStrategy.RollingUpdate
+		if len(held) == 0 {
+			partition := ""
+			if rolling.Partition != nil {
+				partition = strconv.Itoa(int(*rolling.Partition))
+			}
+			setAnnotation(o, PartitionAnnotation, partition)
+		}
+
+		replicas := int32(1)
+		if o.Spec.Replicas != nil {
+			replicas = *o.Spec.Replicas
+		}
+		rolling.Partition = &replicas
+	default:
+		return false
+	}
+
+	for _, image := range images {
+		if !slices.Contains(held, image) {
+			held = append(held, image)
+		}
+	}
+	slices.Sort(held)
+	setAnnotation(obj, HoldAnnotation, strings.Join(held, ","))
+
+	return true
+}
+
+// Release resumes the rollout of a held workload and removes the hold annotations.
+func Release(obj client.Object) {
+	switch o := obj.(type) {
+	case *appsv1.Deployment:
+		o.Spec.Paused = false
+	case *appsv1.StatefulSet:
+		if rolling := o.Spec.UpdateStrategy.RollingUpdate; rolling != nil {
+			rolling.Partition = nil
+			if value := o.GetAnnotations()[PartitionAnnotation]; value != "" {
+				if partition, err := strconv.ParseInt(value, 10, 32); err == nil {
+					p := int32(partition)
+					rolling.Partition = &p
+				}
+			}
+		}
+	}
+
+	annotations := obj.GetAnnotations()
+	delete(annotations, HoldAnnotation)
+	delete(annotations, PartitionAnnotation)
+	obj.SetAnnotations(annotations)
+}
+
+func setAnnotation(obj client.Object, key, value string) {
+	annotations := obj.GetAnnotations()
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+	annotations[key] = value
+	obj.SetAnnotations(annotations)
+}
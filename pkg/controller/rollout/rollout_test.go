@@ -0,0 +1,145 @@
+// Copyright 2024 Coral Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rollout
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func deployment(image string) *appsv1.Deployment {
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"},
+		Spec: appsv1.DeploymentSpec{
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					InitContainers: []corev1.Container{{Name: "init", Image: "alpine:3.19"}},
+					Containers:     []corev1.Container{{Name: "web", Image: image}},
+				},
+			},
+		},
+	}
+}
+
+var _ = Describe("Images", func() {
+	It("should normalize the images and skip digests and latest", func() {
+		spec := deployment("nginx").Spec.Template.Spec
+		spec.Containers = append(spec.Containers, corev1.Container{
+			Name:  "pinned",
+			Image: "busybox@sha256:9ae97d36d26566ff84e8893c64a6dc4fe8ca6d1144bf5b87b2b85a32def253c7",
+		}, corev1.Container{
+			Name:  "cache",
+			Image: "redis:latest",
+		}, corev1.Container{
+			Name:  "queue",
+			Image: "rabbitmq:3.13",
+		})
+
+		Expect(Images(spec)).To(Equal([]string{
+			"docker.io/library/alpine:3.19",
+			"docker.io/library/rabbitmq:3.13",
+		}))
+	})
+
+	It("should not return untagged or latest images that were added", func() {
+		previous := deployment("nginx:1.25").Spec.Template.Spec
+		Expect(Changed(previous, deployment("nginx").Spec.Template.Spec)).To(BeEmpty())
+		Expect(Changed(previous, deployment("nginx:latest").Spec.Template.Spec)).To(BeEmpty())
+	})
+
+	It("should return the images that were added", func() {
+		previous := deployment("nginx:1.25").Spec.Template.Spec
+		updated := deployment("docker.io/library/nginx:1.26").Spec.Template.Spec
+		Expect(Changed(previous, updated)).To(Equal([]string{"docker.io/library/nginx:1.26"}))
+		Expect(Changed(updated, updated)).To(BeEmpty())
+	})
+})
+
+var _ = Describe("Threshold", func() {
+	It("should default missing and invalid values", func() {
+		d := deployment("nginx:1.26")
+		Expect(Threshold(d)).To(Equal(DefaultThreshold))
+
+		d.SetAnnotations(map[string]string{ThresholdAnnotation: "1.5"})
+		Expect(Threshold(d)).To(Equal(DefaultThreshold))
+
+		d.SetAnnotations(map[string]string{ThresholdAnnotation: "0.8"})
+		Expect(Threshold(d)).To(Equal(0.8))
+	})
+})
+
+var _ = Describe("Hold", func() {
+	It("should not hold the rollout without any images", func() {
+		d := deployment("nginx")
+		Expect(Hold(d, nil)).To(BeFalse())
+		Expect(d.Spec.Paused).To(BeFalse())
+		Expect(Held(d)).To(BeEmpty())
+	})
+
+	It("should pause and resume a deployment", func() {
+		d := deployment("nginx:1.26")
+		Expect(Hold(d, []string{"docker.io/library/nginx:1.26"})).To(BeTrue())
+		Expect(d.Spec.Paused).To(BeTrue())
+		Expect(Held(d)).To(Equal([]string{"docker.io/library/nginx:1.26"}))
+
+		By("extending a held rollout")
+		Expect(Hold(d, []string{"docker.io/library/alpine:3.20"})).To(BeTrue())
+		Expect(Held(d)).To(Equal([]string{"docker.io/library/alpine:3.20", "docker.io/library/nginx:1.26"}))
+
+		Release(d)
+		Expect(d.Spec.Paused).To(BeFalse())
+		Expect(d.GetAnnotations()).ToNot(HaveKey(HoldAnnotation))
+	})
+
+	It("should not hold a deployment that was already paused", func() {
+		d := deployment("nginx:1.26")
+		d.Spec.Paused = true
+		Expect(Hold(d, []string{"docker.io/library/nginx:1.26"})).To(BeFalse())
+		Expect(Held(d)).To(BeEmpty())
+	})
+
+	It("should raise and restore the partition of a statefulset", func() {
+		replicas, partition := int32(3), int32(1)
+		s := &appsv1.StatefulSet{
+			Spec: appsv1.StatefulSetSpec{
+				Replicas: &replicas,
+				UpdateStrategy: appsv1.StatefulSetUpdateStrategy{
+					Type:          appsv1.RollingUpdateStatefulSetStrategyType,
+					RollingUpdate: &appsv1.RollingUpdateStatefulSetStrategy{Partition: &partition},
+				},
+			},
+		}
+
+		Expect(Hold(s, []string{"docker.io/library/postgres:17"})).To(BeTrue())
+		Expect(*s.Spec.UpdateStrategy.RollingUpdate.Partition).To(Equal(int32(3)))
+		Expect(s.GetAnnotations()).To(HaveKeyWithValue(PartitionAnnotation, "1"))
+
+		Release(s)
+		Expect(*s.Spec.UpdateStrategy.RollingUpdate.Partition).To(Equal(int32(1)))
+		Expect(s.GetAnnotations()).To(BeEmpty())
+	})
+
+	It("should not hold a statefulset using the on delete strategy", func() {
+		s := &appsv1.StatefulSet{
+			Spec: appsv1.StatefulSetSpec{
+				UpdateStrategy: appsv1.StatefulSetUpdateStrategy{Type: appsv1.OnDeleteStatefulSetStrategyType},
+			},
+		}
+		Expect(Hold(s, []string{"docker.io/library/postgres:17"})).To(BeFalse())
+	})
+})
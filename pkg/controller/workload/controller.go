@@ -0,0 +1,239 @@
+// Copyright 2024 Coral Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package workload
+
+import (
+	"context"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	stvziov1 "stvz.io/coral/pkg/apis/stvz.io/v1"
+)
+
+const (
+	// GenerateLabel is the namespace label that opts the namespace into generating
+	// an Image from the images used by its workloads.
+	GenerateLabel = "image.stvz.io/generate"
+	// SelectorAnnotation is the namespace annotation holding the node selector of the
+	// generated Image as a label selector, for example "pool in (apps),gpu!=true".
+	SelectorAnnotation = "image.stvz.io/generate-selector"
+	// GeneratedLabel marks the Image objects that are maintained by the controller.
+	GeneratedLabel = "image.stvz.io/generated"
+	// GeneratedImageName is the name of the generated Image in each namespace.
+	GeneratedImageName = "coral-workloads"
+)
+
+// Controller maintains a generated Image in each opted in namespace listing the
+// images used by the Deployments, StatefulSets, DaemonSets and CronJobs in the
+// namespace.  The requests are keyed by the namespace name.
+type Controller struct {
+	client.Client
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+}
+
+func SetupWithManager(mgr ctrl.Manager) error {
+	c := &Controller{
+		Client:   mgr.GetClient(),
+		Scheme:   mgr.GetScheme(),
+		Recorder: mgr.GetEventRecorderFor("workload-controller"),
+	}
+
+	enqueue := handler.EnqueueRequestsFromMapFunc(namespaceRequest)
+	generated := predicate.NewPredicateFuncs(func(obj client.Object) bool {
+		return obj.GetName() == GeneratedImageName
+	})
+
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("workload").
+		For(&corev1.Namespace{}, builder.WithPredicates(predicate.Or(predicate.LabelChangedPredicate{}, predicate.AnnotationChangedPredicate{}))).
+		Watches(&appsv1.Deployment{}, enqueue, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Watches(&appsv1.StatefulSet{}, enqueue, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Watches(&appsv1.DaemonSet{}, enqueue, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Watches(&batchv1.CronJob{}, enqueue, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Watches(&stvziov1.Image{}, enqueue, builder.WithPredicates(generated)).
+		Complete(c)
+}
+
+// namespaceRequest maps an object to the request for its namespace.
+func namespaceRequest(_ context.Context, obj client.Object) []reconcile.Request {
+	return []reconcile.Request{
+		{NamespacedName: types.NamespacedName{Name: obj.GetNamespace()}},
+	}
+}
+
+// +kubebuilder:rbac:groups=core,resources=namespaces,verbs=get;list;watch
+// +kubebuilder:rbac:groups=apps,resources=deployments;statefulsets;daemonsets,verbs=get;list;watch
+// +kubebuilder:rbac:groups=batch,resources=cronjobs,verbs=get;list;watch
+// +kubebuilder:rbac:groups=stvz.io,resources=images,verbs=get;list;watch;create;update;patch;delete
+
+// Reconcile generates the Image for the namespace from its workloads.
+func (c *Controller) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+	logger.V(6).Info("reconciling namespace workloads", "request", req)
+
+	ns := &corev1.Namespace{}
+	if err := c.Get(ctx, types.NamespacedName{Name: req.Name}, ns); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	existing := &stvziov1.Image{}
+	err := c.Get(ctx, types.NamespacedName{Namespace: ns.Name, Name: GeneratedImageName}, existing)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return ctrl.Result{RequeueAfter: 10 * time.Second}, err
+	}
+	if apierrors.IsNotFound(err) {
+		existing = nil
+	}
+
+	optedIn := ns.GetLabels()[GenerateLabel] == "true"
+
+	// Leave images with the same name that weren't created by the controller alone.
+	if existing != nil && existing.GetLabels()[GeneratedLabel] != "true" {
+		if optedIn {
+			logger.Info("image exists and was not generated, skipping", "namespace", ns.Name, "name", GeneratedImageName)
+			c.Recorder.Eventf(ns, corev1.EventTypeWarning, "ImageNotGenerated",
+				"image %s already exists and is not maintained by coral", GeneratedImageName)
+		}
+		return ctrl.Result{}, nil
+	}
+
+	// Prune the generated image when the namespace opts out.  The workloads are only
+	// listed for opted in namespaces.
+	if !optedIn {
+		if existing != nil {
+			logger.V(4).Info("removing generated image", "namespace", ns.Name)
+			return ctrl.Result{}, client.IgnoreNotFound(c.Delete(ctx, existing))
+		}
+		return ctrl.Result{}, nil
+	}
+
+	workloads, err := c.workloads(ctx, ns.Name)
+	if err != nil {
+		return ctrl.Result{RequeueAfter: 10 * time.Second}, err
+	}
+
+	// Prune the generated image when there are no longer any images in use.
+	repos := Repositories(workloads)
+	if len(repos) == 0 {
+		if existing != nil {
+			logger.V(4).Info("removing generated image", "namespace", ns.Name)
+			return ctrl.Result{}, client.IgnoreNotFound(c.Delete(ctx, existing))
+		}
+		return ctrl.Result{}, nil
+	}
+
+	selector, err := Selector(ns.GetAnnotations()[SelectorAnnotation])
+	if err != nil {
+		c.Recorder.Eventf(ns, corev1.EventTypeWarning, "InvalidSelector", "unable to parse %s: %s", SelectorAnnotation, err.Error())
+		return ctrl.Result{}, nil
+	}
+
+	desired := stvziov1.ImageSpec{
+		Selector:     selector,
+		Repositories: repos,
+	}
+	owners := ownerReferences(workloads)
+
+	if existing == nil {
+		image := &stvziov1.Image{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:            GeneratedImageName,
+				Namespace:       ns.Name,
+				Labels:          map[string]string{GeneratedLabel: "true"},
+				OwnerReferences: owners,
+			},
+			Spec: desired,
+		}
+
+		logger.V(4).Info("creating generated image", "namespace", ns.Name, "repositories", len(repos))
+		return ctrl.Result{}, c.Create(ctx, image)
+	}
+
+	if equality.Semantic.DeepEqual(existing.Spec, desired) && equality.Semantic.DeepEqual(existing.OwnerReferences, owners) {
+		return ctrl.Result{}, nil
+	}
+
+	existing.Spec = desired
+	existing.OwnerReferences = owners
+
+	logger.V(4).Info("updating generated image", "namespace", ns.Name, "repositories", len(repos))
+	return ctrl.Result{}, c.Update(ctx, existing)
+}
+
+// workloads returns the workloads in the namespace that haven't been deleted.
+func (c *Controller) workloads(ctx context.Context, namespace string) ([]Workload, error) {
+	var workloads []Workload
+
+	deployments := &appsv1.DeploymentList{}
+	if err := c.List(ctx, deployments, client.InNamespace(namespace)); err != nil {
+		return nil, err
+	}
+	for i := range deployments.Items {
+		d := &deployments.Items[i]
+		workloads = append(workloads, Workload{d, appsv1.SchemeGroupVersion.WithKind("Deployment"), d.Spec.Template.Spec})
+	}
+
+	statefulSets := &appsv1.StatefulSetList{}
+	if err := c.List(ctx, statefulSets, client.InNamespace(namespace)); err != nil {
+		return nil, err
+	}
+	for i := range statefulSets.Items {
+		s := &statefulSets.Items[i]
+		workloads = append(workloads, Workload{s, appsv1.SchemeGroupVersion.WithKind("StatefulSet"), s.Spec.Template.Spec})
+	}
+
+	daemonSets := &appsv1.DaemonSetList{}
+	if err := c.List(ctx, daemonSets, client.InNamespace(namespace)); err != nil {
+		return nil, err
+	}
+	for i := range daemonSets.Items {
+		d := &daemonSets.Items[i]
+		workloads = append(workloads, Workload{d, appsv1.SchemeGroupVersion.WithKind("DaemonSet"), d.Spec.Template.Spec})
+	}
+
+	cronJobs := &batchv1.CronJobList{}
+	if err := c.List(ctx, cronJobs, client.InNamespace(namespace)); err != nil {
+		return nil, err
+	}
+	for i := range cronJobs.Items {
+		j := &cronJobs.Items[i]
+		workloads = append(workloads, Workload{j, batchv1.SchemeGroupVersion.WithKind("CronJob"), j.Spec.JobTemplate.Spec.Template.Spec})
+	}
+
+	active := workloads[:0]
+	for _, w := range workloads {
+		if w.Object.GetDeletionTimestamp().IsZero() {
+			active = append(active, w)
+		}
+	}
+
+	return active, nil
+}
@@ -0,0 +1,120 @@
+// Copyright 2024 Coral Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package workload
+
+import (
+	"path"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/selection"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	stvziov1 "stvz.io/coral/pkg/apis/stvz.io/v1"
+	"stvz.io/coral/pkg/mock"
+)
+
+var _ = Describe("Controller", func() {
+	var controller *Controller
+
+	BeforeEach(func() {
+		c := mock.NewClient().WithLogger(logger).WithFixtureOrDie(
+			path.Join(fixtures, "workload_step_1.yaml"),
+		)
+		controller = &Controller{
+			Client:   c,
+			Recorder: record.NewFakeRecorder(10),
+		}
+	})
+
+	reconcileNamespace := func(name string) {
+		response, err := controller.Reconcile(ctx, reconcile.Request{
+			NamespacedName: types.NamespacedName{Name: name},
+		})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(response.Requeue).To(BeFalse())
+	}
+
+	Context("Reconcile", func() {
+		It("should list the images of the workloads and prune stale ones", func() {
+			reconcileNamespace("apps")
+
+			image := &stvziov1.Image{}
+			err := controller.Get(ctx, types.NamespacedName{Namespace: "apps", Name: GeneratedImageName}, image)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(image.Finalizers).To(ContainElement(stvziov1.Finalizer))
+
+			names := make([]string, len(image.Spec.Repositories))
+			for i, r := range image.Spec.Repositories {
+				names[i] = *r.Name
+			}
+			Expect(names).To(Equal([]string{
+				"docker.io/library/alpine",
+				"docker.io/library/nginx",
+				"docker.io/library/postgres",
+			}))
+			Expect(image.Spec.Repositories[1].Tags).To(Equal([]string{"1.24", "1.25"}))
+
+			Expect(image.Spec.Selector).To(ConsistOf(
+				stvziov1.NodeSelector{Key: "pool", Operator: selection.In, Values: []string{"apps"}},
+				stvziov1.NodeSelector{Key: "gpu", Operator: selection.NotEquals, Values: []string{"true"}},
+			))
+
+			Expect(image.OwnerReferences).To(HaveLen(3))
+			Expect(image.OwnerReferences[0].Kind).To(Equal("CronJob"))
+			Expect(image.OwnerReferences[0].APIVersion).To(Equal("batch/v1"))
+			Expect(image.OwnerReferences[1].Kind).To(Equal("Deployment"))
+			Expect(image.OwnerReferences[2].Kind).To(Equal("StatefulSet"))
+		})
+
+		It("should not generate an image in namespaces without the label", func() {
+			reconcileNamespace("other")
+
+			err := controller.Get(ctx, types.NamespacedName{Namespace: "other", Name: GeneratedImageName}, &stvziov1.Image{})
+			Expect(apierrors.IsNotFound(err)).To(BeTrue())
+		})
+
+		It("should leave images it didn't generate alone without warning outside of opted in namespaces", func() {
+			reconcileNamespace("manual")
+
+			image := &stvziov1.Image{}
+			err := controller.Get(ctx, types.NamespacedName{Namespace: "manual", Name: GeneratedImageName}, image)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(controller.Recorder.(*record.FakeRecorder).Events).To(BeEmpty())
+		})
+
+		It("should remove the generated image when no workloads are left", func() {
+			reconcileNamespace("empty")
+
+			err := controller.Get(ctx, types.NamespacedName{Namespace: "empty", Name: GeneratedImageName}, &stvziov1.Image{})
+			Expect(apierrors.IsNotFound(err)).To(BeTrue())
+		})
+	})
+})
+
+var _ = Describe("Selector", func() {
+	It("should return no selectors for an empty string", func() {
+		selectors, err := Selector("")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(selectors).To(BeNil())
+	})
+
+	It("should return an error for an invalid selector", func() {
+		_, err := Selector("pool in (")
+		Expect(err).To(HaveOccurred())
+	})
+})
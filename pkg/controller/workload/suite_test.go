@@ -0,0 +1,52 @@
+// Copyright 2024 Coral Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package workload
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.uber.org/zap/zapcore"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+)
+
+var (
+	ctx      context.Context
+	cancel   context.CancelFunc
+	logger   logr.Logger
+	fixtures = filepath.Join("..", "..", "..", "fixtures", "controller_test")
+)
+
+func TestWorkloadController(t *testing.T) {
+	RegisterFailHandler(Fail)
+	suiteConfig, _ := GinkgoConfiguration()
+	suiteConfig.ParallelTotal = 1
+	RunSpecs(t, "Workload Controller Suite", suiteConfig)
+}
+
+var _ = BeforeSuite(func() {
+	logger = zap.New(zap.WriteTo(GinkgoWriter), zap.UseDevMode(true), zap.Level(zapcore.Level(-8)))
+	logf.SetLogger(logger)
+	ctx, cancel = context.WithCancel(context.Background())
+})
+
+var _ = AfterSuite(func() {
+	cancel()
+})
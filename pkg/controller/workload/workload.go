@@ -0,0 +1,131 @@
+// Copyright 2024 Coral Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package workload
+
+import (
+	"slices"
+	"sort"
+
+	"github.com/containers/image/v5/docker/reference"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	stvziov1 "stvz.io/coral/pkg/apis/stvz.io/v1"
+)
+
+// Workload is a workload along with the pod spec of its template.
+type Workload struct {
+	Object client.Object
+	Kind   schema.GroupVersionKind
+	Spec   corev1.PodSpec
+}
+
+// Repositories returns the repositories and tags used by the containers and init
+// containers of the workloads, sorted by name.  Images referenced only by digest
+// are skipped since an Image can only list tags.  Untagged images and the latest tag
+// are skipped as well since Images don't support latest.
+func Repositories(workloads []Workload) stvziov1.Repositories {
+	tags := make(map[string][]string)
+	add := func(containers []corev1.Container) {
+		for _, c := range containers {
+			named, err := reference.ParseNormalizedNamed(c.Image)
+			if err != nil {
+				continue
+			}
+
+			tagged, ok := named.(reference.Tagged)
+			if !ok || tagged.Tag() == "latest" {
+				continue
+			}
+			tag := tagged.Tag()
+
+			repo := reference.TrimNamed(named).String()
+			if !slices.Contains(tags[repo], tag) {
+				tags[repo] = append(tags[repo], tag)
+			}
+		}
+	}
+
+	for _, w := range workloads {
+		add(w.Spec.InitContainers)
+		add(w.Spec.Containers)
+	}
+
+	repos := make(stvziov1.Repositories, 0, len(tags))
+	for repo, t := range tags {
+		name := repo
+		slices.Sort(t)
+		repos = append(repos, stvziov1.RepositorySpec{
+			Name: &name,
+			Tags: t,
+		})
+	}
+
+	sort.Slice(repos, func(i, j int) bool {
+		return *repos[i].Name < *repos[j].Name
+	})
+
+	return repos
+}
+
+// Selector converts a label selector into the node selectors of an Image.
+func Selector(s string) ([]stvziov1.NodeSelector, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	selector, err := labels.Parse(s)
+	if err != nil {
+		return nil, err
+	}
+
+	requirements, _ := selector.Requirements()
+	selectors := make([]stvziov1.NodeSelector, len(requirements))
+	for i, r := range requirements {
+		selectors[i] = stvziov1.NodeSelector{
+			Key:      r.Key(),
+			Operator: r.Operator(),
+			Values:   r.Values().List(),
+		}
+	}
+
+	return selectors, nil
+}
+
+// ownerReferences returns a reference to each of the workloads, so the generated
+// Image is garbage collected once all of the workloads have been deleted.
+func ownerReferences(workloads []Workload) []metav1.OwnerReference {
+	refs := make([]metav1.OwnerReference, len(workloads))
+	for i, w := range workloads {
+		apiVersion, kind := w.Kind.ToAPIVersionAndKind()
+		refs[i] = metav1.OwnerReference{
+			APIVersion: apiVersion,
+			Kind:       kind,
+			Name:       w.Object.GetName(),
+			UID:        w.Object.GetUID(),
+		}
+	}
+
+	sort.Slice(refs, func(i, j int) bool {
+		if refs[i].Kind != refs[j].Kind {
+			return refs[i].Kind < refs[j].Kind
+		}
+		return refs[i].Name < refs[j].Name
+	})
+
+	return refs
+}
@@ -0,0 +1,44 @@
+package credentials
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	runtimev1 "k8s.io/cri-api/pkg/apis/runtime/v1"
+	"k8s.io/kubernetes/pkg/credentialprovider"
+	"k8s.io/kubernetes/pkg/credentialprovider/secrets"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// KeyringFor builds a docker keyring from the referenced pull secrets.
+func KeyringFor(ctx context.Context, c client.Client, keys []client.ObjectKey) (credentialprovider.DockerKeyring, error) {
+	pullSecrets := make([]corev1.Secret, 0, len(keys))
+	for _, key := range keys {
+		secret := &corev1.Secret{}
+		if err := c.Get(ctx, key, secret); err != nil {
+			return nil, err
+		}
+		pullSecrets = append(pullSecrets, *secret)
+	}
+
+	return secrets.MakeDockerKeyring(pullSecrets, credentialprovider.NewDockerKeyring())
+}
+
+// WithAuth calls fn with each of the credentials in the keyring that match the name
+// until it succeeds.  If there are no matching credentials, fn is called once with
+// nil credentials.
+func WithAuth(keyring credentialprovider.DockerKeyring, name string, fn func(*runtimev1.AuthConfig) error) error {
+	auths, found := keyring.Lookup(name)
+	if !found {
+		return fn(nil)
+	}
+
+	var err error
+	for _, auth := range toRuntimeAuthConfig(auths) {
+		if err = fn(auth); err == nil {
+			return nil
+		}
+	}
+
+	return err
+}
@@ -2,6 +2,7 @@ package mirror
 
 import (
 	"context"
+	"sync"
 
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime/schema"
@@ -14,40 +15,57 @@ import (
 	"stvz.io/hashring"
 )
 
-// type MirrorCache struct {
-// 	items map[client.ObjectKey]*stvziov1.Mirror
-// 	sync.Mutex
-// }
+// MirrorCache holds the mirrors seen by the informer.  It is written by the
+// mirror event handler and read by the mirror workers and the registry
+// notification handler, so all access goes through the lock.
+type MirrorCache struct {
+	items map[client.ObjectKey]*stvziov1.Mirror
+	sync.Mutex
+}
 
-// func (m *MirrorCache) Set(mirror *stvziov1.Mirror) {
-// 	if m.items == nil {
-// 		m.items = make(map[client.ObjectKey]*stvziov1.Mirror)
-// 	}
+func NewMirrorCache() *MirrorCache {
+	return &MirrorCache{
+		items: make(map[client.ObjectKey]*stvziov1.Mirror),
+	}
+}
 
-// 	m.items[client.ObjectKeyFromObject(mirror)] = mirror
-// }
+func (m *MirrorCache) Set(mirror *stvziov1.Mirror) {
+	m.Lock()
+	defer m.Unlock()
 
-// func (m *MirrorCache) Remove(mirror *stvziov1.Mirror) {
-// 	delete(m.items, client.ObjectKeyFromObject(mirror))
-// }
+	if m.items == nil {
+		m.items = make(map[client.ObjectKey]*stvziov1.Mirror)
+	}
 
-// func (m *MirrorCache) Items() []*stvziov1.Mirror {
-// 	m.Lock()
-// 	defer m.Unlock()
+	m.items[client.ObjectKeyFromObject(mirror)] = mirror
+}
 
-// 	items := make([]*stvziov1.Mirror, 0, len(m.items))
-// 	for _, mirror := range m.items {
-// 		items = append(items, mirror)
-// 	}
+func (m *MirrorCache) Remove(mirror *stvziov1.Mirror) {
+	m.Lock()
+	defer m.Unlock()
 
-// 	return items
-// }
+	delete(m.items, client.ObjectKeyFromObject(mirror))
+}
+
+// Items returns a snapshot of the cached mirrors that is safe to range over
+// while the cache is being updated.
+func (m *MirrorCache) Items() []*stvziov1.Mirror {
+	m.Lock()
+	defer m.Unlock()
+
+	items := make([]*stvziov1.Mirror, 0, len(m.items))
+	for _, mirror := range m.items {
+		items = append(items, mirror)
+	}
+
+	return items
+}
 
 type Informer struct {
 	ServerRing *hashring.Ring
 	Keyring    *credentials.Keyring
 	Client     client.Client
-	Mirrors    map[client.ObjectKey]*stvziov1.Mirror
+	Mirrors    *MirrorCache
 	Namespace  string
 	Labels     labels.Selector
 	cache.Cache
@@ -57,7 +75,7 @@ func SetupWithManager(ctx context.Context, mgr ctrl.Manager, namespace string, l
 	informer := &Informer{
 		ServerRing: hashring.NewRing(1, nil),
 		Keyring:    credentials.NewKeyring(mgr.GetClient()),
-		Mirrors:    make(map[client.ObjectKey]*stvziov1.Mirror),
+		Mirrors:    NewMirrorCache(),
 		Client:     mgr.GetClient(),
 		Cache:      mgr.GetCache(),
 		Namespace:  namespace,
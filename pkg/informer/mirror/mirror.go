@@ -9,7 +9,7 @@ import (
 
 type MirrorHandler struct {
 	Keyring *credentials.Keyring
-	Mirrors map[client.ObjectKey]*stvziov1.Mirror
+	Mirrors *MirrorCache
 }
 
 func (h *MirrorHandler) OnAdd(obj interface{}, init bool) {
@@ -39,7 +39,7 @@ func (h *MirrorHandler) OnDelete(obj interface{}) {
 }
 
 func (h *MirrorHandler) add(obj *stvziov1.Mirror) {
-	h.Mirrors[client.ObjectKeyFromObject(obj)] = obj
+	h.Mirrors.Set(obj)
 
 	secrets := make([]client.ObjectKey, len(obj.Spec.ImagePullSecrets))
 	for i, s := range obj.Spec.ImagePullSecrets {
@@ -52,7 +52,7 @@ func (h *MirrorHandler) add(obj *stvziov1.Mirror) {
 }
 
 func (h *MirrorHandler) remove(obj *stvziov1.Mirror) {
-	delete(h.Mirrors, client.ObjectKeyFromObject(obj))
+	h.Mirrors.Remove(obj)
 
 	// Oh... how do I know if these are not in use by other mirrors?  I think
 	secrets := make([]client.ObjectKey, len(obj.Spec.ImagePullSecrets))
@@ -0,0 +1,184 @@
+// Copyright 2024 Coral Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package image
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/containers/image/v5/docker/reference"
+	corev1 "k8s.io/api/core/v1"
+	stvziov1 "stvz.io/coral/pkg/apis/stvz.io/v1"
+)
+
+// Coverage holds the objects that can cover the images used by a workload.  An
+// image is covered when it is prefetched by an Image or ClusterImage, or copied by
+// a Mirror.
+type Coverage struct {
+	Namespace     string
+	Images        []stvziov1.Image
+	ClusterImages []stvziov1.ClusterImage
+	Mirrors       []stvziov1.Mirror
+}
+
+// Check returns the reasons the container image is not allowed.  The image must be
+// covered and must not be pulled from an external registry.
+func (c *Coverage) Check(kind, name, image string, policy corev1.PullPolicy) []string {
+	var container string
+	switch kind {
+	case InitContainerKind:
+		container = "init container " + name
+	case EphemeralContainerKind:
+		container = "ephemeral container " + name
+	default:
+		container = "container " + name
+	}
+
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return []string{fmt.Sprintf("%s: image %s is not a valid reference", container, image)}
+	}
+	named = reference.TagNameOnly(named)
+
+	// Images in the local registry of a mirror are covered and internal.
+	if c.internal(named) {
+		return nil
+	}
+
+	var reasons []string
+	if !c.covered(named, image) {
+		repo := reference.TrimNamed(named).String()
+		target := repo
+		if tagged, ok := named.(reference.Tagged); ok {
+			target = fmt.Sprintf("%s with tag %s", repo, tagged.Tag())
+		}
+
+		reasons = append(reasons, fmt.Sprintf(
+			"%s: image %s is not covered by an Image, ClusterImage or Mirror; add %s to an Image in namespace %s, a ClusterImage or a Mirror",
+			container, image, target, c.Namespace,
+		))
+	}
+
+	if policy = effectivePullPolicy(named, policy); policy != corev1.PullNever {
+		reasons = append(reasons, fmt.Sprintf(
+			"%s: image %s would be pulled from the external registry %s with pull policy %s; set the pull policy to Never or rewrite the image to a Mirror",
+			container, image, reference.Domain(named), policy,
+		))
+	}
+
+	return reasons
+}
+
+// internal returns true if the image is hosted by the local registry of a mirror.
+func (c *Coverage) internal(named reference.Named) bool {
+	for _, m := range c.Mirrors {
+		if m.Spec.Registry != nil && reference.Domain(named) == m.Spec.Registry.Address() {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (c *Coverage) covered(named reference.Named, image string) bool {
+	if _, ok := MirroredImage(c.Mirrors, image); ok {
+		return true
+	}
+
+	for _, i := range c.Images {
+		if i.Namespace == c.Namespace && imageCovers(&i, named) {
+			return true
+		}
+	}
+
+	for _, i := range c.ClusterImages {
+		if imageCovers(&i, named) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// imageCovers returns true if the image object prefetches the image.  Images
+// referenced by digest are matched against the digests resolved by the controller.
+func imageCovers(obj stvziov1.ImageObject, named reference.Named) bool {
+	repo := reference.TrimNamed(named).String()
+
+	if digested, ok := named.(reference.Digested); ok {
+		for _, data := range obj.GetImageStatus().Data {
+			ref, err := reference.ParseNormalizedNamed(data.Name)
+			if err == nil && reference.TrimNamed(ref).String() == repo && data.Digest == digested.Digest().String() {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	tagged, ok := named.(reference.Tagged)
+	if !ok {
+		return false
+	}
+
+	repos := append(obj.GetRepositories().Explicit(), obj.GetImageStatus().Repositories...)
+	for _, r := range repos {
+		name, err := stvziov1.NormalizeRepo(r.Name)
+		if err == nil && name == repo && slices.Contains(r.Tags, tagged.Tag()) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// effectivePullPolicy returns the pull policy kubernetes uses for the container.  It
+// defaults to Always for the latest tag and IfNotPresent otherwise.
+func effectivePullPolicy(named reference.Named, policy corev1.PullPolicy) corev1.PullPolicy {
+	if policy != "" {
+		return policy
+	}
+
+	if _, ok := named.(reference.Digested); ok {
+		return corev1.PullIfNotPresent
+	}
+
+	if tagged, ok := named.(reference.Tagged); ok && tagged.Tag() != "latest" {
+		return corev1.PullIfNotPresent
+	}
+
+	return corev1.PullAlways
+}
+
+// Violations returns the reasons the containers in the pod spec are not allowed.
+// Only the ephemeral containers are checked when ephemeral is true, since they are
+// the only containers that can be changed through the subresource.
+func (c *Coverage) Violations(spec corev1.PodSpec, ephemeral bool) []string {
+	var reasons []string
+	if !ephemeral {
+		for _, ct := range spec.InitContainers {
+			reasons = append(reasons, c.Check(InitContainerKind, ct.Name, ct.Image, ct.ImagePullPolicy)...)
+		}
+		for _, ct := range spec.Containers {
+			reasons = append(reasons, c.Check(ContainerKind, ct.Name, ct.Image, ct.ImagePullPolicy)...)
+		}
+	}
+
+	for _, ct := range spec.EphemeralContainers {
+		reasons = append(reasons, c.Check(EphemeralContainerKind, ct.Name, ct.Image, ct.ImagePullPolicy)...)
+	}
+
+	return reasons
+}
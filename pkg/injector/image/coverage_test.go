@@ -0,0 +1,124 @@
+// Copyright 2024 Coral Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package image
+
+import (
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	stvziov1 "stvz.io/coral/pkg/apis/stvz.io/v1"
+)
+
+var _ = Describe("Coverage:", func() {
+	debian := "docker.io/library/debian"
+	digest := "sha256:" + strings.Repeat("b", 64)
+
+	coverage := &Coverage{
+		Namespace: "default",
+		Images: []stvziov1.Image{
+			{
+				ObjectMeta: metav1.ObjectMeta{Name: "debian", Namespace: "default"},
+				Spec: stvziov1.ImageSpec{
+					Repositories: stvziov1.Repositories{
+						{Name: &debian, Tags: []string{"bookworm-slim"}},
+					},
+				},
+				Status: stvziov1.ImageStatus{
+					Data: []stvziov1.ImageData{
+						{Name: "docker.io/library/debian:bookworm-slim", Digest: digest},
+					},
+				},
+			},
+			{
+				ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: "other"},
+				Spec: stvziov1.ImageSpec{
+					Repositories: stvziov1.Repositories{
+						{Name: &debian, Tags: []string{"bullseye-slim"}},
+					},
+				},
+			},
+		},
+		Mirrors: []stvziov1.Mirror{
+			{
+				ObjectMeta: metav1.ObjectMeta{Name: "mirror", Namespace: "coral"},
+				Spec: stvziov1.MirrorSpec{
+					Registry: &stvziov1.RegistrySpec{Host: "registry.internal", Port: 5000},
+				},
+			},
+		},
+	}
+
+	Context("Check", func() {
+		It("should allow covered images that are never pulled", func() {
+			Expect(coverage.Check(ContainerKind, "app", "debian:bookworm-slim", corev1.PullNever)).To(BeEmpty())
+			Expect(coverage.Check(ContainerKind, "app", "docker.io/library/debian@"+digest, corev1.PullNever)).To(BeEmpty())
+		})
+
+		It("should allow images from the local registry of a mirror", func() {
+			Expect(coverage.Check(ContainerKind, "app", "registry.internal:5000/docker.io/library/debian@"+digest, corev1.PullIfNotPresent)).To(BeEmpty())
+		})
+
+		It("should reject images covered by an image in another namespace", func() {
+			reasons := coverage.Check(InitContainerKind, "migrate", "debian:bullseye-slim", corev1.PullNever)
+			Expect(reasons).To(HaveLen(1))
+			Expect(reasons[0]).To(ContainSubstring("init container migrate: image debian:bullseye-slim is not covered"))
+			Expect(reasons[0]).To(ContainSubstring("add docker.io/library/debian with tag bullseye-slim to an Image in namespace default"))
+		})
+
+		It("should reject images pulled from an external registry", func() {
+			reasons := coverage.Check(ContainerKind, "app", "debian:bookworm-slim", corev1.PullIfNotPresent)
+			Expect(reasons).To(HaveLen(1))
+			Expect(reasons[0]).To(ContainSubstring("container app: image debian:bookworm-slim would be pulled from the external registry docker.io with pull policy IfNotPresent"))
+		})
+
+		It("should default the pull policy to Always for the latest tag", func() {
+			reasons := coverage.Check(ContainerKind, "app", "busybox", "")
+			Expect(reasons).To(HaveLen(2))
+			Expect(reasons[1]).To(ContainSubstring("pull policy Always"))
+		})
+	})
+
+	Context("Violations", func() {
+		spec := corev1.PodSpec{
+			InitContainers: []corev1.Container{
+				{Name: "migrate", Image: "busybox:1.36", ImagePullPolicy: corev1.PullNever},
+			},
+			Containers: []corev1.Container{
+				{Name: "app", Image: "debian:bookworm-slim", ImagePullPolicy: corev1.PullNever},
+			},
+			EphemeralContainers: []corev1.EphemeralContainer{
+				{EphemeralContainerCommon: corev1.EphemeralContainerCommon{
+					Name: "debugger", Image: "debian:bookworm-slim", ImagePullPolicy: corev1.PullAlways,
+				}},
+			},
+		}
+
+		It("should check every kind of container", func() {
+			reasons := coverage.Violations(spec, false)
+			Expect(reasons).To(HaveLen(2))
+			Expect(reasons[0]).To(HavePrefix("init container migrate:"))
+			Expect(reasons[1]).To(HavePrefix("ephemeral container debugger:"))
+		})
+
+		It("should only check the ephemeral containers for the subresource", func() {
+			reasons := coverage.Violations(spec, true)
+			Expect(reasons).To(HaveLen(1))
+			Expect(reasons[0]).To(HavePrefix("ephemeral container debugger:"))
+		})
+	})
+})
@@ -0,0 +1,115 @@
+// Copyright 2024 Coral Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package image
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// maxEventMessage is the longest event message recorded for a dry run.  The full
+// patch is available in the annotation.
+const maxEventMessage = 1024
+
+// DryRun computes the changes the mutation would make without applying them.  The
+// changes are recorded as a json patch in the dry run patch annotation, which is the
+// only change made to the object.  When there are no changes, the annotation is not
+// added and any patch from a previous dry run is removed.  The operations of the
+// patch are returned with the response.
+func (m *Mutator) DryRun(req admission.Request) (admission.Response, []string) {
+	// The changes are computed from the decoded object, since the mutation is applied
+	// in place, so fields only added by decoding aren't reported as changes.  The
+	// injected annotation is always set by the mutation, so it's set beforehand to
+	// keep it out of the changes.
+	annotations := m.obj.GetAnnotations()
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+	annotations[InjectedAnnotation] = "true"
+	m.obj.SetAnnotations(annotations)
+
+	before, err := json.Marshal(m.obj)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err), nil
+	}
+
+	obj, err := m.mutated()
+	if err != nil {
+		return admission.Errored(http.StatusBadRequest, err), nil
+	}
+
+	o, err := json.Marshal(obj)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err), nil
+	}
+
+	changes := admission.PatchResponseFromRaw(before, o).Patches
+	ops := make([]string, len(changes))
+	for i, c := range changes {
+		ops[i] = c.Operation + " " + c.Path
+	}
+
+	patch, err := json.Marshal(changes)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err), nil
+	}
+
+	// The patch is added to the original object since the decoded object has been
+	// mutated.
+	original := &unstructured.Unstructured{}
+	if err := json.Unmarshal(req.Object.Raw, &original.Object); err != nil {
+		return admission.Errored(http.StatusBadRequest, err), nil
+	}
+
+	annotations = original.GetAnnotations()
+	if len(changes) == 0 {
+		if _, ok := annotations[DryRunPatchAnnotation]; !ok {
+			resp := admission.Allowed("")
+			resp.Warnings = m.warnings
+			return resp, nil
+		}
+		delete(annotations, DryRunPatchAnnotation)
+	} else {
+		if annotations == nil {
+			annotations = make(map[string]string)
+		}
+		annotations[DryRunPatchAnnotation] = string(patch)
+	}
+	original.SetAnnotations(annotations)
+
+	out, err := json.Marshal(original.Object)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err), nil
+	}
+
+	resp := admission.PatchResponseFromRaw(req.Object.Raw, out)
+	resp.Warnings = m.warnings
+	return resp, ops
+}
+
+// dryRunMessage returns the event message describing the changes of a dry run.
+func dryRunMessage(modes []string, ops []string) string {
+	msg := fmt.Sprintf("dry run of %s would apply %d changes: %s", strings.Join(modes, ","), len(ops), strings.Join(ops, ", "))
+	if len(msg) > maxEventMessage {
+		msg = msg[:maxEventMessage-3] + "..."
+	}
+
+	return msg
+}
@@ -0,0 +1,239 @@
+// Copyright 2024 Coral Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package image
+
+import (
+	"encoding/json"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.uber.org/zap/zapcore"
+	admissionv1 "k8s.io/api/admission/v1"
+	"k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset/scheme"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+var _ = Describe("Dry run:", func() {
+	logger := zap.New(
+		zap.Level(zapcore.Level(8) * -1),
+	)
+
+	request := func(annotations string) admission.Request {
+		return admission.Request{
+			AdmissionRequest: admissionv1.AdmissionRequest{
+				Kind: metav1.GroupVersionKind{
+					Group:   "apps",
+					Version: "v1",
+					Kind:    "Deployment",
+				},
+				Object: runtime.RawExtension{
+					Raw: []byte(`{
+						"apiVersion": "apps/v1",
+						"kind": "Deployment",
+						"metadata": {
+							"name": "test",
+							"namespace": "default",
+							"annotations": ` + annotations + `
+						},
+						"spec": {
+							"selector": {"matchLabels": {"app": "test"}},
+							"template": {
+								"metadata": {"labels": {"app": "test"}},
+								"spec": {
+									"containers": [{
+										"name": "test",
+										"image": "docker.io/library/debian:bookworm-slim",
+										"imagePullPolicy": "IfNotPresent"
+									}]
+								}
+							}
+						}
+					}`),
+				},
+			},
+		}
+	}
+
+	ownedPod := func(annotations string) admission.Request {
+		return admission.Request{
+			AdmissionRequest: admissionv1.AdmissionRequest{
+				Kind: metav1.GroupVersionKind{
+					Version: "v1",
+					Kind:    "Pod",
+				},
+				Object: runtime.RawExtension{
+					Raw: []byte(`{
+						"apiVersion": "v1",
+						"kind": "Pod",
+						"metadata": {
+							"name": "test-abc",
+							"namespace": "default",
+							"annotations": ` + annotations + `,
+							"ownerReferences": [{
+								"apiVersion": "apps/v1",
+								"kind": "ReplicaSet",
+								"name": "test",
+								"uid": "1"
+							}]
+						},
+						"spec": {
+							"containers": [{
+								"name": "test",
+								"image": "docker.io/library/debian:bookworm-slim"
+							}]
+						}
+					}`),
+				},
+			},
+		}
+	}
+
+	Context("DryRun", func() {
+		It("should only add the patch annotation to the object", func() {
+			req := request(`{"image.stvz.io/inject": "pull-policy,selectors", "image.stvz.io/dry-run": "true"}`)
+
+			m := NewMutator(logger)
+			Expect(m.FromReq(req, admission.NewDecoder(scheme.Scheme))).To(Succeed())
+			Expect(m.Modes()).To(Equal([]string{"pull-policy", "selectors"}))
+
+			resp, ops := m.DryRun(req)
+			Expect(resp.Allowed).To(BeTrue())
+			Expect(ops).To(ContainElement("replace /spec/template/spec/containers/0/imagePullPolicy"))
+			Expect(ops).To(ContainElement("add /spec/template/spec/nodeSelector"))
+
+			Expect(resp.Patches).To(HaveLen(1))
+			Expect(resp.Patches[0].Operation).To(Equal("add"))
+			Expect(resp.Patches[0].Path).To(Equal("/metadata/annotations/image.stvz.io~1dry-run-patch"))
+
+			var patch []map[string]interface{}
+			Expect(json.Unmarshal([]byte(resp.Patches[0].Value.(string)), &patch)).To(Succeed())
+			Expect(patch).To(HaveLen(len(ops)))
+		})
+
+		It("should not report changes when the spec already matches the mutation", func() {
+			// A dry run never applies the injected annotation, so it's missing even
+			// when nothing else would change.
+			req := admission.Request{
+				AdmissionRequest: admissionv1.AdmissionRequest{
+					Kind: metav1.GroupVersionKind{
+						Group:   "apps",
+						Version: "v1",
+						Kind:    "Deployment",
+					},
+					Object: runtime.RawExtension{
+						Raw: []byte(`{
+							"apiVersion": "apps/v1",
+							"kind": "Deployment",
+							"metadata": {
+								"name": "test",
+								"namespace": "default",
+								"annotations": {
+									"image.stvz.io/inject": "pull-policy,selectors",
+									"image.stvz.io/dry-run": "true"
+								}
+							},
+							"spec": {
+								"selector": {"matchLabels": {"app": "test"}},
+								"template": {
+									"metadata": {"labels": {"app": "test"}},
+									"spec": {
+										"nodeSelector": {"image.stvz.io/e28d47094db7c64507211886dcba74c9": "available"},
+										"containers": [{
+											"name": "test",
+											"image": "docker.io/library/debian:bookworm-slim",
+											"imagePullPolicy": "Never"
+										}]
+									}
+								}
+							}
+						}`),
+					},
+				},
+			}
+
+			m := NewMutator(logger)
+			Expect(m.FromReq(req, admission.NewDecoder(scheme.Scheme))).To(Succeed())
+
+			resp, ops := m.DryRun(req)
+			Expect(resp.Allowed).To(BeTrue())
+			Expect(ops).To(BeEmpty())
+			Expect(resp.Patches).To(BeEmpty())
+		})
+
+		It("should not add the patch annotation to owned pods", func() {
+			req := ownedPod(`{"image.stvz.io/inject": "pull-policy", "image.stvz.io/dry-run": "true"}`)
+
+			m := NewMutator(logger)
+			Expect(m.FromReq(req, admission.NewDecoder(scheme.Scheme))).To(Succeed())
+
+			resp, ops := m.DryRun(req)
+			Expect(resp.Allowed).To(BeTrue())
+			Expect(ops).To(BeEmpty())
+			Expect(resp.Patches).To(BeEmpty())
+		})
+
+		It("should remove a stale dry run patch when nothing would change", func() {
+			req := ownedPod(`{"image.stvz.io/inject": "pull-policy", "image.stvz.io/dry-run": "true", "image.stvz.io/dry-run-patch": "[]"}`)
+
+			m := NewMutator(logger)
+			Expect(m.FromReq(req, admission.NewDecoder(scheme.Scheme))).To(Succeed())
+
+			resp, ops := m.DryRun(req)
+			Expect(resp.Allowed).To(BeTrue())
+			Expect(ops).To(BeEmpty())
+			Expect(resp.Patches).To(HaveLen(1))
+			Expect(resp.Patches[0].Operation).To(Equal("remove"))
+			Expect(resp.Patches[0].Path).To(Equal("/metadata/annotations/image.stvz.io~1dry-run-patch"))
+		})
+
+		It("should remove a stale dry run patch when the changes are applied", func() {
+			req := request(`{"image.stvz.io/inject": "pull-policy", "image.stvz.io/dry-run-patch": "[]"}`)
+
+			m := NewMutator(logger)
+			Expect(m.FromReq(req, admission.NewDecoder(scheme.Scheme))).To(Succeed())
+
+			resp := m.Mutate(req)
+			Expect(resp.Allowed).To(BeTrue())
+
+			var paths []string
+			for _, p := range resp.Patches {
+				paths = append(paths, p.Operation+" "+p.Path)
+			}
+			Expect(paths).To(ContainElement("remove /metadata/annotations/image.stvz.io~1dry-run-patch"))
+			Expect(paths).To(ContainElement("replace /spec/template/spec/containers/0/imagePullPolicy"))
+		})
+	})
+
+	Context("dryRunMessage", func() {
+		It("should describe the changes", func() {
+			msg := dryRunMessage([]string{"pull-policy"}, []string{"replace /spec/containers/0/imagePullPolicy"})
+			Expect(msg).To(Equal("dry run of pull-policy would apply 1 changes: replace /spec/containers/0/imagePullPolicy"))
+		})
+
+		It("should truncate long messages", func() {
+			ops := make([]string, 100)
+			for i := range ops {
+				ops[i] = "replace /spec/template/spec/containers/" + strings.Repeat("0", 10) + "/imagePullPolicy"
+			}
+			msg := dryRunMessage([]string{"pull-policy"}, ops)
+			Expect(msg).To(HaveLen(maxEventMessage))
+			Expect(msg).To(HaveSuffix("..."))
+		})
+	})
+})
@@ -16,19 +16,28 @@ package image
 import (
 	"context"
 	"net/http"
+	"strconv"
 
 	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
 	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+	stvziov1 "stvz.io/coral/pkg/apis/stvz.io/v1"
 )
 
 // +kubebuilder:docs-gen:collapse=Go imports
 
-// +kubebuilder:webhook:verbs=create;update,path=/mutate-stvz-io-v1-image-injector,mutating=true,failurePolicy=fail,groups=apps,resources=cronjobs;daemonsets;deployments;jobs;replicasets;replicationcontrollers;statefulsets,versions=v1,name=minjector.image.stvz.io,admissionReviewVersions=v1,sideEffects=none
+// +kubebuilder:rbac:groups=stvz.io,resources=injectionpolicies,verbs=get;list;watch
+// +kubebuilder:rbac:groups=stvz.io,resources=clusterinjectionpolicies,verbs=get;list;watch
+// +kubebuilder:rbac:groups=core,resources=namespaces,verbs=get;list;watch
+
+// +kubebuilder:webhook:verbs=create;update,path=/mutate-stvz-io-v1-image-injector,mutating=true,failurePolicy=fail,groups="";apps;batch,resources=cronjobs;daemonsets;deployments;jobs;pods;pods/ephemeralcontainers;replicasets;replicationcontrollers;statefulsets,versions=v1,name=minjector.image.stvz.io,admissionReviewVersions=v1,sideEffects=noneOnDryRun
 
 type Injector struct {
 	client.Client
@@ -36,24 +45,42 @@ type Injector struct {
 	decoder *admission.Decoder
 	log     logr.Logger
 
+	// recorder records the changes that would be made in dry run mode.
+	recorder record.EventRecorder
+
+	// templates are the pod template paths of the kinds that aren't natively
+	// supported.
+	templates TemplatePaths
+
 	// default webhook action as config value
 	defaultAction admission.Response
 }
 
 // SetupWebhookWithManager adds webhook for BuildSet.
-func SetupWebhookWithManager(mgr ctrl.Manager) error {
+func SetupWebhookWithManager(mgr ctrl.Manager, templates TemplatePaths) error {
 	i := &Injector{
 		Client:        mgr.GetClient(),
 		cache:         mgr.GetCache(),
 		decoder:       admission.NewDecoder(mgr.GetScheme()),
 		defaultAction: admission.Allowed(""),
 		log:           mgr.GetLogger().WithName("image-injector"),
+		recorder:      mgr.GetEventRecorderFor("image-injector"),
+		templates:     templates,
 	}
 
 	mgr.GetWebhookServer().Register("/mutate-stvz-io-v1-image-injector", &webhook.Admission{
 		Handler: i,
 	})
 
+	mgr.GetWebhookServer().Register("/validate-stvz-io-v1-image-injector", &webhook.Admission{
+		Handler: &Validator{
+			Client:    mgr.GetClient(),
+			decoder:   admission.NewDecoder(mgr.GetScheme()),
+			log:       mgr.GetLogger().WithName("image-validator"),
+			templates: templates,
+		},
+	})
+
 	return nil
 }
 
@@ -64,18 +91,77 @@ func (i *Injector) Handle(ctx context.Context, req admission.Request) admission.
 	logger := log.FromContext(ctx)
 	logger.Info("handling request", "req", req)
 
-	mutator := NewMutator(i.log)
+	mutator := NewMutator(i.log).WithTemplates(i.templates)
 	if err := mutator.FromReq(req, i.decoder); err != nil {
 		return admission.Errored(http.StatusBadRequest, err)
 	}
 
+	var nsLabels map[string]string
+	if req.Namespace != "" {
+		ns := &corev1.Namespace{}
+		if err := i.Get(ctx, types.NamespacedName{Name: req.Namespace}, ns); err != nil {
+			return admission.Errored(http.StatusInternalServerError, err)
+		}
+		nsLabels = ns.GetLabels()
+	}
+
+	name, policy, err := i.policy(ctx, req.Namespace, nsLabels, mutator.Object())
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	if policy != nil {
+		logger.V(4).Info("applying injection policy", "policy", name)
+		mutator.ApplyPolicy(name, *policy)
+	}
+
 	// If we are not managing the object, then we should just allow it through
 	if !mutator.Managed() {
-		admission.Allowed("")
+		return admission.Allowed("")
+	}
+
+	if mutator.Rewrites() {
+		mirrors := &stvziov1.MirrorList{}
+		if err := i.List(ctx, mirrors); err != nil {
+			return admission.Errored(http.StatusInternalServerError, err)
+		}
+		mutator.WithMirrors(mirrors.Items)
+	}
+
+	dryRun := mutator.Object().GetAnnotations()[DryRunAnnotation] == "true" || nsLabels[DryRunAnnotation] == "true"
+	for _, mode := range mutator.Modes() {
+		injectorMutations.WithLabelValues(mode, req.Namespace, strconv.FormatBool(dryRun)).Inc()
+	}
+
+	if !dryRun {
+		// Run the mutators
+		return mutator.Mutate(req)
+	}
+
+	// Events are a side effect, so they are skipped when the request is a dry run.
+	resp, patch := mutator.DryRun(req)
+	if resp.Allowed && len(patch) > 0 && (req.DryRun == nil || !*req.DryRun) {
+		i.recorder.Event(mutator.Object(), corev1.EventTypeNormal, "InjectionDryRun", dryRunMessage(mutator.Modes(), patch))
+	}
+
+	return resp
+}
+
+// policy returns the merged injection policies that apply to the object, if any.
+func (i *Injector) policy(ctx context.Context, namespace string, nsLabels map[string]string, obj client.Object) (string, *stvziov1.InjectionPolicySpec, error) {
+	clusterPolicies := &stvziov1.ClusterInjectionPolicyList{}
+	if err := i.List(ctx, clusterPolicies); err != nil {
+		return "", nil, err
+	}
+
+	policies := &stvziov1.InjectionPolicyList{}
+	if namespace != "" {
+		if err := i.List(ctx, policies, client.InNamespace(namespace)); err != nil {
+			return "", nil, err
+		}
 	}
 
-	// Run the mutators
-	return mutator.Mutate(req)
+	name, spec := MergePolicies(i.log, policies.Items, clusterPolicies.Items, nsLabels, obj.GetLabels())
+	return name, spec, nil
 }
 
 var _ admission.Handler = &Injector{}
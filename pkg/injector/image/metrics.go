@@ -0,0 +1,34 @@
+// Copyright 2024 Coral Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package image
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var (
+	injectorMutations = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "coral_injector_mutations",
+			Help: "The number of workloads handled by the injector for each mode.",
+		},
+		[]string{"mode", "namespace", "dry_run"},
+	)
+)
+
+func init() {
+	metrics.Registry.MustRegister(injectorMutations)
+}
@@ -16,20 +16,51 @@ package image
 
 import (
 	"encoding/json"
+	"fmt"
 	"maps"
 	"net/http"
+	"slices"
 	"strings"
 
+	"github.com/containers/image/v5/docker/reference"
 	"github.com/go-logr/logr"
 	appsv1 "k8s.io/api/apps/v1"
 	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
 	stvziov1 "stvz.io/coral/pkg/apis/stvz.io/v1"
 	"stvz.io/coral/pkg/util"
 )
 
+// Container kinds that can be used to target containers explicitly in the include
+// and exclude annotations, for example "init:migrate".  Names without a kind match
+// containers of every kind.
+const (
+	ContainerKind          = "container"
+	InitContainerKind      = "init"
+	EphemeralContainerKind = "ephemeral"
+)
+
+// Annotations used to control the injection on a workload.
+const (
+	InjectAnnotation   = "image.stvz.io/inject"
+	IncludedAnnotation = "image.stvz.io/included"
+	ExcludedAnnotation = "image.stvz.io/excluded"
+	InjectedAnnotation = "image.stvz.io/injected"
+	// DryRunAnnotation enables the dry run mode when set to "true" on a workload or
+	// as a label on a namespace.
+	DryRunAnnotation = "image.stvz.io/dry-run"
+	// DryRunPatchAnnotation holds the json patch computed in dry run mode.
+	DryRunPatchAnnotation = "image.stvz.io/dry-run-patch"
+)
+
+// EphemeralContainersSubResource is the pod subresource used to add ephemeral
+// containers to a running pod.
+const EphemeralContainersSubResource = "ephemeralcontainers"
+
 type Action struct {
 	MutatePullPolicy bool
 	MutateSelectors  bool
@@ -40,12 +71,24 @@ type Mutator struct {
 
 	policy    bool
 	selectors bool
+	affinity  bool
+	rewrite   bool
+
+	// mirrors are used to find the local references when rewriting images.
+	mirrors  []stvziov1.Mirror
+	warnings admission.Warnings
+
+	// templates are the pod template paths of the kinds that aren't natively
+	// supported, and path is the template path of the decoded object.
+	templates TemplatePaths
+	path      []string
 
 	include []string
 	exclude []string
 
-	kind string
-	obj  client.Object
+	kind        string
+	subResource string
+	obj         client.Object
 }
 
 func NewMutator(log logr.Logger) *Mutator {
@@ -56,61 +99,222 @@ func NewMutator(log logr.Logger) *Mutator {
 
 func (m *Mutator) FromReq(req admission.Request, decoder *admission.Decoder) error {
 	m.kind = req.Kind.Kind
+	m.subResource = req.SubResource
 
-	obj, err := util.ObjectFromKind(m.kind)
-	if err != nil {
-		return err
-	}
-
-	err = decoder.Decode(req, obj)
+	obj, path, err := decodeObject(req, decoder, m.templates)
 	if err != nil {
 		return err
 	}
 	m.obj = obj
+	m.path = path
 
-	annotation, ok := obj.GetAnnotations()["image.stvz.io/inject"]
+	annotation, ok := obj.GetAnnotations()[InjectAnnotation]
 	if !ok || annotation == "" {
 		return nil
 	}
 
-	if included, ok := obj.GetAnnotations()["image.stvz.io/included"]; ok {
+	if included, ok := obj.GetAnnotations()[IncludedAnnotation]; ok {
 		m.include = strings.Split(included, ",")
 	} else {
 		m.include = []string{}
 	}
 
-	if excluded, ok := obj.GetAnnotations()["image.stvz.io/excluded"]; ok {
+	if excluded, ok := obj.GetAnnotations()[ExcludedAnnotation]; ok {
 		m.exclude = strings.Split(excluded, ",")
 	} else {
 		m.exclude = []string{}
 	}
 
-	parts := strings.Split(annotation, ",")
-	for _, part := range parts {
-		switch part {
-		case "pull-policy":
+	m.setModes(strings.Split(annotation, ","))
+
+	return nil
+}
+
+// decodeObject decodes the object in the request along with the path to the pod
+// template for registered kinds.  Registered kinds are checked first so the registry
+// can also be used for custom resources sharing a name with one of the native kinds.
+func decodeObject(req admission.Request, decoder *admission.Decoder, templates TemplatePaths) (client.Object, []string, error) {
+	var obj client.Object
+	path, ok := templates[schema.GroupVersionKind(req.Kind)]
+	if ok {
+		obj = &unstructured.Unstructured{}
+	} else {
+		var err error
+		obj, err = util.ObjectFromKind(req.Kind.Kind)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if err := decoder.Decode(req, obj); err != nil {
+		return nil, nil, err
+	}
+
+	return obj, path, nil
+}
+
+// podSpec returns the pod spec of a natively supported object.
+func podSpec(obj client.Object) (corev1.PodSpec, bool) {
+	switch o := obj.(type) {
+	case *batchv1.CronJob:
+		return o.Spec.JobTemplate.Spec.Template.Spec, true
+	case *appsv1.DaemonSet:
+		return o.Spec.Template.Spec, true
+	case *appsv1.Deployment:
+		return o.Spec.Template.Spec, true
+	case *batchv1.Job:
+		return o.Spec.Template.Spec, true
+	case *appsv1.ReplicaSet:
+		return o.Spec.Template.Spec, true
+	case *corev1.ReplicationController:
+		if o.Spec.Template == nil {
+			return corev1.PodSpec{}, false
+		}
+		return o.Spec.Template.Spec, true
+	case *appsv1.StatefulSet:
+		return o.Spec.Template.Spec, true
+	case *corev1.Pod:
+		return o.Spec, true
+	default:
+		return corev1.PodSpec{}, false
+	}
+}
+
+func (m *Mutator) setModes(modes []string) {
+	m.policy, m.selectors, m.affinity, m.rewrite = false, false, false, false
+
+	for _, mode := range modes {
+		switch stvziov1.InjectionMode(mode) {
+		case stvziov1.InjectionModePullPolicy:
 			m.policy = true
-		case "selectors":
+		case stvziov1.InjectionModeSelectors:
 			m.selectors = true
+		case stvziov1.InjectionModeSoftSelectors, "affinity":
+			m.affinity = true
+		case stvziov1.InjectionModeRewrite:
+			m.rewrite = true
 		}
 	}
+}
 
-	return nil
+// Object returns the decoded object.
+func (m *Mutator) Object() client.Object {
+	return m.obj
+}
+
+// ApplyPolicy merges an injection policy with the annotations on the object.  The
+// policy takes precedence over the annotations unless it allows overrides, in which
+// case each annotation present on the object replaces the matching policy setting.
+// An inject annotation with an empty value opts the object out of the policy.
+func (m *Mutator) ApplyPolicy(name string, spec stvziov1.InjectionPolicySpec) {
+	annotations := m.obj.GetAnnotations()
+
+	if v, ok := annotations[InjectAnnotation]; ok && spec.AllowOverride {
+		m.setModes(strings.Split(v, ","))
+	} else {
+		modes := make([]string, len(spec.Modes))
+		for i, mode := range spec.Modes {
+			modes[i] = string(mode)
+		}
+		m.setModes(modes)
+	}
+
+	if v, ok := annotations[IncludedAnnotation]; ok && spec.AllowOverride {
+		m.include = strings.Split(v, ",")
+	} else {
+		m.include = spec.Include
+	}
+
+	if v, ok := annotations[ExcludedAnnotation]; ok && spec.AllowOverride {
+		m.exclude = strings.Split(v, ",")
+	} else {
+		m.exclude = spec.Exclude
+	}
+
+	if spec.AllowOverride {
+		return
+	}
+
+	for _, key := range []string{InjectAnnotation, IncludedAnnotation, ExcludedAnnotation} {
+		if _, ok := annotations[key]; ok {
+			m.warnings = append(m.warnings, fmt.Sprintf("injection policy %s does not allow overrides, the %s annotation was ignored", name, key))
+		}
+	}
 }
 
 func (m *Mutator) Managed() bool {
-	return m.policy || m.selectors
+	return m.policy || m.selectors || m.affinity || m.rewrite
+}
+
+// Modes returns the names of the enabled injection modes.
+func (m *Mutator) Modes() []string {
+	var modes []string
+	for mode, enabled := range map[stvziov1.InjectionMode]bool{
+		stvziov1.InjectionModePullPolicy:    m.policy,
+		stvziov1.InjectionModeSelectors:     m.selectors,
+		stvziov1.InjectionModeSoftSelectors: m.affinity,
+		stvziov1.InjectionModeRewrite:       m.rewrite,
+	} {
+		if enabled {
+			modes = append(modes, string(mode))
+		}
+	}
+	slices.Sort(modes)
+
+	return modes
+}
+
+// Rewrites returns true if the image references should be rewritten to the mirrors.
+func (m *Mutator) Rewrites() bool {
+	return m.rewrite
+}
+
+// WithTemplates sets the pod template paths of the kinds that aren't natively
+// supported.
+func (m *Mutator) WithTemplates(templates TemplatePaths) *Mutator {
+	m.templates = templates
+	return m
+}
+
+// WithMirrors sets the mirrors used to rewrite the image references.
+func (m *Mutator) WithMirrors(mirrors []stvziov1.Mirror) *Mutator {
+	m.mirrors = mirrors
+	return m
 }
 
 func (m *Mutator) Mutate(req admission.Request) admission.Response {
-	obj := m.mutate(m.obj)
+	obj, err := m.mutated()
+	if err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+
+	// The changes are applied, so the patch recorded by a previous dry run is stale.
+	if annotations := obj.GetAnnotations(); annotations != nil {
+		delete(annotations, DryRunPatchAnnotation)
+		obj.SetAnnotations(annotations)
+	}
 
 	o, err := json.Marshal(obj)
 	if err != nil {
 		return admission.Errored(http.StatusInternalServerError, err)
 	}
 
-	return admission.PatchResponseFromRaw(req.Object.Raw, o)
+	resp := admission.PatchResponseFromRaw(req.Object.Raw, o)
+	resp.Warnings = m.warnings
+	return resp
+}
+
+// mutated returns the object with the mutations applied.
+func (m *Mutator) mutated() (client.Object, error) {
+	// Registered kinds are decoded as unstructured objects, so the pod template is
+	// managed before the rest of the mutation.
+	if obj, ok := m.obj.(*unstructured.Unstructured); ok && m.path != nil {
+		if err := m.manageTemplate(obj, m.path); err != nil {
+			return nil, err
+		}
+	}
+
+	return m.mutate(m.obj), nil
 }
 
 func (m *Mutator) mutate(obj client.Object) client.Object {
@@ -118,13 +322,19 @@ func (m *Mutator) mutate(obj client.Object) client.Object {
 	// already be managing, then just allow it through as we'll be updating the templates
 	// in the other objects.
 	if m.kind == "Pod" || m.kind == "ReplicaSet" {
-		if ref := m.obj.GetOwnerReferences(); len(ref) > 0 {
+		if ref := m.obj.GetOwnerReferences(); len(ref) > 0 && m.subResource != EphemeralContainersSubResource {
 			return obj
 		}
 	}
 
-	// Otherwise, handle the policy
-	switch m.kind {
+	// Otherwise, handle the policy.  Registered kinds have already been managed
+	// through their template paths.
+	kind := m.kind
+	if m.path != nil {
+		kind = ""
+	}
+
+	switch kind {
 	case "CronJob":
 		o, _ := m.obj.(*batchv1.CronJob)
 		o.Spec.JobTemplate.Spec.Template.Spec = m.manage(o.Spec.JobTemplate.Spec.Template.Spec)
@@ -148,7 +358,11 @@ func (m *Mutator) mutate(obj client.Object) client.Object {
 		o.Spec.Template.Spec = m.manage(o.Spec.Template.Spec)
 	case "Pod":
 		o, _ := m.obj.(*corev1.Pod)
-		o.Spec = m.manage(o.Spec)
+		if m.subResource == EphemeralContainersSubResource {
+			o.Spec = m.manageEphemeral(o.Spec)
+		} else {
+			o.Spec = m.manage(o.Spec)
+		}
 	}
 
 	annotations := obj.GetAnnotations()
@@ -156,7 +370,7 @@ func (m *Mutator) mutate(obj client.Object) client.Object {
 		annotations = make(map[string]string)
 	}
 
-	annotations["image.stvz.io/injected"] = "true"
+	annotations[InjectedAnnotation] = "true"
 	obj.SetAnnotations(annotations)
 
 	return obj
@@ -171,34 +385,172 @@ func (m *Mutator) manage(spec corev1.PodSpec) corev1.PodSpec {
 		spec = m.manageSelectors(spec)
 	}
 
+	if m.affinity {
+		spec = m.manageAffinity(spec)
+	}
+
+	// The selectors are derived from the original image names, so the images are
+	// rewritten last.
+	if m.rewrite {
+		spec = m.rewriteImages(spec)
+	}
+
 	return spec
 }
 
-func (m *Mutator) manageImagePullPolicy(spec corev1.PodSpec) corev1.PodSpec {
-	var containers []corev1.Container
+// manageEphemeral only manages the ephemeral containers.  Ephemeral containers are
+// added to pods that are already scheduled and the rest of the spec can't be
+// changed through the subresource.
+func (m *Mutator) manageEphemeral(spec corev1.PodSpec) corev1.PodSpec {
+	if m.policy {
+		for i, c := range spec.EphemeralContainers {
+			if m.selected(EphemeralContainerKind, c.Name) {
+				spec.EphemeralContainers[i].ImagePullPolicy = corev1.PullNever
+			}
+		}
+	}
+
+	if m.rewrite {
+		for i, c := range spec.EphemeralContainers {
+			if m.selected(EphemeralContainerKind, c.Name) {
+				spec.EphemeralContainers[i].Image = m.rewriteImage(c.Name, c.Image)
+			}
+		}
+	}
+
+	return spec
+}
+
+// selected returns true if the container is selected by the include and exclude
+// annotations.  Include always takes precedence over exclude.
+func (m *Mutator) selected(kind, name string) bool {
 	switch {
 	case len(m.include) > 0:
-		containers = util.ModifyFunc(spec.Containers, m.include, func(c corev1.Container, n string) corev1.Container {
-			if c.Name == n {
-				c.ImagePullPolicy = corev1.PullNever
-			}
-			return c
-		})
+		return containerListed(m.include, kind, name)
 	case len(m.exclude) > 0:
-		containers = util.ModifyFunc(spec.Containers, m.exclude, func(c corev1.Container, n string) corev1.Container {
-			if c.Name != n {
+		return !containerListed(m.exclude, kind, name)
+	default:
+		return true
+	}
+}
+
+func containerListed(list []string, kind, name string) bool {
+	return slices.Contains(list, name) || slices.Contains(list, kind+":"+name)
+}
+
+// imageKeys returns the node label keys for the images of the selected containers
+// and init containers.  Ephemeral containers are skipped as they never affect
+// scheduling.
+func (m *Mutator) imageKeys(spec corev1.PodSpec) []string {
+	var keys []string
+	add := func(kind string, containers []corev1.Container) {
+		for _, c := range containers {
+			if !m.selected(kind, c.Name) {
+				continue
+			}
+
+			image := c.Image
+			if source, ok := SourceImage(m.mirrors, image); ok {
+				// The image was rewritten to a mirror and the nodes are labeled
+				// with the source image.
+				if source == "" {
+					continue
+				}
+				image = source
+			}
+
+			// The agent labels the nodes with the normalized NAME:TAG of the
+			// images, so short names have to be expanded before hashing.  Images
+			// referenced only by a digest are never labeled.
+			named, err := reference.ParseNormalizedNamed(image)
+			if err != nil {
+				continue
+			}
+			tagged, ok := reference.TagNameOnly(named).(reference.Tagged)
+			if !ok {
+				continue
+			}
+			image = reference.TrimNamed(named).String() + ":" + tagged.Tag()
+
+			if key := stvziov1.HashedImageLabelKey(image); !slices.Contains(keys, key) {
+				keys = append(keys, key)
+			}
+		}
+	}
+
+	add(InitContainerKind, spec.InitContainers)
+	add(ContainerKind, spec.Containers)
+
+	return keys
+}
+
+// rewriteImages points the container and init container images at the local
+// registries of the mirrors covering them.  Images that are not mirrored or have not
+// been synced yet are left unchanged and a warning is returned to the client.
+func (m *Mutator) rewriteImages(spec corev1.PodSpec) corev1.PodSpec {
+	rewrite := func(kind string, containers []corev1.Container) []corev1.Container {
+		out := make([]corev1.Container, len(containers))
+		for i, c := range containers {
+			if m.selected(kind, c.Name) {
+				c.Image = m.rewriteImage(c.Name, c.Image)
+			}
+			out[i] = c
+		}
+		return out
+	}
+
+	if spec.InitContainers != nil {
+		spec.InitContainers = rewrite(InitContainerKind, spec.InitContainers)
+	}
+	spec.Containers = rewrite(ContainerKind, spec.Containers)
+
+	return spec
+}
+
+func (m *Mutator) rewriteImage(name, image string) string {
+	// Images that were already rewritten are left alone when the workload is
+	// admitted again.
+	if _, ok := SourceImage(m.mirrors, image); ok {
+		return image
+	}
+
+	mirrored, ok := MirroredImage(m.mirrors, image)
+	if !ok {
+		m.warnings = append(m.warnings, fmt.Sprintf("container %s: image %s is not mirrored and was not rewritten", name, image))
+		return image
+	}
+
+	if mirrored == "" {
+		m.warnings = append(m.warnings, fmt.Sprintf("container %s: image %s has not been mirrored yet and was not rewritten", name, image))
+		return image
+	}
+
+	m.log.V(4).Info("rewriting image", "container", name, "image", image, "mirrored", mirrored)
+	return mirrored
+}
+
+func (m *Mutator) manageImagePullPolicy(spec corev1.PodSpec) corev1.PodSpec {
+	never := func(kind string, containers []corev1.Container) []corev1.Container {
+		out := make([]corev1.Container, len(containers))
+		for i, c := range containers {
+			if m.selected(kind, c.Name) {
 				c.ImagePullPolicy = corev1.PullNever
 			}
-			return c
-		})
-	default:
-		for _, c := range spec.Containers {
-			c.ImagePullPolicy = corev1.PullNever
-			containers = append(containers, c)
+			out[i] = c
 		}
+		return out
+	}
+
+	if spec.InitContainers != nil {
+		spec.InitContainers = never(InitContainerKind, spec.InitContainers)
 	}
+	spec.Containers = never(ContainerKind, spec.Containers)
 
-	spec.Containers = containers
+	for i, c := range spec.EphemeralContainers {
+		if m.selected(EphemeralContainerKind, c.Name) {
+			spec.EphemeralContainers[i].ImagePullPolicy = corev1.PullNever
+		}
+	}
 
 	return spec
 }
@@ -216,26 +568,75 @@ func (m *Mutator) manageSelectors(spec corev1.PodSpec) corev1.PodSpec {
 		return strings.HasPrefix(k, stvziov1.LabelPrefix)
 	})
 
-	var containers []corev1.Container
-	// Include will always take precedence over exclude.
-	switch {
-	case len(m.include) > 0:
-		containers = util.FilterFunc(spec.Containers, m.include, func(c corev1.Container, n string) bool {
-			return c.Name == n
-		})
-	case len(m.exclude) > 0:
-		containers = util.FilterFunc(spec.Containers, m.exclude, func(c corev1.Container, n string) bool {
-			return c.Name != n
-		})
-	default:
-		containers = spec.Containers
+	for _, key := range m.imageKeys(spec) {
+		selectors[key] = "available"
 	}
 
-	for _, c := range containers {
-		selectors[stvziov1.HashedImageLabelKey(c.Image)] = "available"
+	spec.NodeSelector = selectors
+
+	return spec
+}
+
+// MaxAffinityWeight is the combined weight of the preferred node affinity terms
+// added for a pod.  It is split between the images so a node with every image
+// present is always preferred over one with only some of them.
+const MaxAffinityWeight int32 = 100
+
+// manageAffinity adds a preferred node affinity term for each selected container
+// and init container image.  Unlike the node selectors, the pod can still be
+// scheduled on a node without the images.  Terms that were previously added by
+// coral are replaced and any other affinity is left alone.
+func (m *Mutator) manageAffinity(spec corev1.PodSpec) corev1.PodSpec {
+	var terms []corev1.PreferredSchedulingTerm
+	if spec.Affinity != nil && spec.Affinity.NodeAffinity != nil {
+		terms = slices.DeleteFunc(spec.Affinity.NodeAffinity.PreferredDuringSchedulingIgnoredDuringExecution, ownedTerm)
 	}
 
-	spec.NodeSelector = selectors
+	if keys := m.imageKeys(spec); len(keys) > 0 {
+		weight := max(1, MaxAffinityWeight/int32(len(keys)))
+		for _, key := range keys {
+			terms = append(terms, corev1.PreferredSchedulingTerm{
+				Weight: weight,
+				Preference: corev1.NodeSelectorTerm{
+					MatchExpressions: []corev1.NodeSelectorRequirement{
+						{
+							Key:      key,
+							Operator: corev1.NodeSelectorOpIn,
+							Values:   []string{"available"},
+						},
+					},
+				},
+			})
+		}
+	}
+
+	if len(terms) == 0 && (spec.Affinity == nil || spec.Affinity.NodeAffinity == nil) {
+		return spec
+	}
+
+	if spec.Affinity == nil {
+		spec.Affinity = &corev1.Affinity{}
+	}
+	if spec.Affinity.NodeAffinity == nil {
+		spec.Affinity.NodeAffinity = &corev1.NodeAffinity{}
+	}
+	spec.Affinity.NodeAffinity.PreferredDuringSchedulingIgnoredDuringExecution = terms
 
 	return spec
 }
+
+// ownedTerm returns true if the preferred scheduling term was added by coral.
+func ownedTerm(term corev1.PreferredSchedulingTerm) bool {
+	expressions := term.Preference.MatchExpressions
+	if len(expressions) == 0 {
+		return false
+	}
+
+	for _, e := range expressions {
+		if !strings.HasPrefix(e.Key, stvziov1.LabelPrefix) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -15,6 +15,8 @@
 package image
 
 import (
+	"strings"
+
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	"go.uber.org/zap/zapcore"
@@ -27,6 +29,7 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+	stvziov1 "stvz.io/coral/pkg/apis/stvz.io/v1"
 )
 
 // +kubebuilder:docs-gen:collapse=Imports
@@ -115,6 +118,37 @@ var _ = Describe("Image functions:", func() {
 			Expect(mutator.selectors).To(BeTrue())
 		})
 
+		It("should identify both names of the preferred affinity mode", func() {
+			for _, mode := range []string{"soft-selectors", "affinity"} {
+				mutator = NewMutator(logger)
+				req.Object = runtime.RawExtension{
+					Raw: []byte(`{
+						"apiVersion": "v1",
+						"kind": "Pod",
+						"metadata": {
+							"name": "test",
+							"namespace": "default",
+							"annotations": {
+								"image.stvz.io/inject": "` + mode + `"
+							}
+						},
+						"spec": {
+							"containers": [{
+								"name": "test",
+								"image": "docker.io/library/debian:bookworm-slim"
+							}]
+						}
+					}`),
+				}
+
+				err := mutator.FromReq(req, decoder)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(mutator.affinity).To(BeTrue())
+				Expect(mutator.selectors).To(BeFalse())
+				Expect(mutator.Managed()).To(BeTrue())
+			}
+		})
+
 		It("should set included and excluded pull policies from annotations", func() {
 			req.Object = runtime.RawExtension{
 				Raw: []byte(`{
@@ -375,6 +409,51 @@ var _ = Describe("Image functions:", func() {
 		})
 	})
 
+	Context("mutate ephemeral containers", func() {
+		It("it should only manage the ephemeral containers of an owned pod", func() {
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "test",
+					OwnerReferences: []metav1.OwnerReference{
+						{
+							Kind: "ReplicaSet",
+							Name: "test",
+						},
+					},
+				},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{
+						{
+							Name:            "bookworm",
+							Image:           "docker.io/library/debian:bookworm-slim",
+							ImagePullPolicy: corev1.PullIfNotPresent,
+						},
+					},
+					EphemeralContainers: []corev1.EphemeralContainer{
+						{
+							EphemeralContainerCommon: corev1.EphemeralContainerCommon{
+								Name:            "debugger",
+								Image:           "docker.io/library/busybox:latest",
+								ImagePullPolicy: corev1.PullIfNotPresent,
+							},
+						},
+					},
+				},
+			}
+			m := &Mutator{
+				policy:      true,
+				selectors:   true,
+				kind:        "Pod",
+				subResource: EphemeralContainersSubResource,
+				obj:         pod,
+			}
+			got := m.mutate(pod).(*corev1.Pod)
+			Expect(got.Spec.EphemeralContainers[0].ImagePullPolicy).To(Equal(corev1.PullNever))
+			Expect(got.Spec.Containers[0].ImagePullPolicy).To(Equal(corev1.PullIfNotPresent))
+			Expect(got.Spec.NodeSelector).To(BeEmpty())
+		})
+	})
+
 	Context("manage", func() {
 		It("it should return the original spec if no selectors or pull policies are set", func() {
 			mutator := &Mutator{
@@ -556,6 +635,28 @@ var _ = Describe("Image functions:", func() {
 			Expect(got.NodeSelector).To(HaveKeyWithValue("image.stvz.io/52eacfd06bb1d06c9b440400a88c6fac", "available"))
 		})
 
+		It("it should return selectors for the normalized names of short images", func() {
+			mutator := &Mutator{}
+
+			spec := corev1.PodSpec{
+				Containers: []corev1.Container{
+					{
+						Name:  "bookworm",
+						Image: "debian:bookworm-slim",
+					},
+					{
+						Name:  "busybox",
+						Image: "busybox",
+					},
+				},
+			}
+			got := mutator.manageSelectors(spec)
+			Expect(got.NodeSelector).To(Equal(map[string]string{
+				"image.stvz.io/e28d47094db7c64507211886dcba74c9":                 "available",
+				stvziov1.HashedImageLabelKey("docker.io/library/busybox:latest"): "available",
+			}))
+		})
+
 		It("it should not contain previous selectors when the image has been updated", func() {
 			mutator := &Mutator{}
 
@@ -693,4 +794,366 @@ var _ = Describe("Image functions:", func() {
 			Expect(got.Containers[1].ImagePullPolicy).To(Equal(corev1.PullIfNotPresent))
 		})
 	})
+
+	Context("manage init and ephemeral containers", func() {
+		var spec corev1.PodSpec
+
+		BeforeEach(func() {
+			spec = corev1.PodSpec{
+				InitContainers: []corev1.Container{
+					{
+						Name:            "migrate",
+						Image:           "docker.io/library/debian:bullseye-slim",
+						ImagePullPolicy: corev1.PullIfNotPresent,
+					},
+				},
+				Containers: []corev1.Container{
+					{
+						Name:            "migrate",
+						Image:           "docker.io/library/debian:bookworm-slim",
+						ImagePullPolicy: corev1.PullIfNotPresent,
+					},
+				},
+				EphemeralContainers: []corev1.EphemeralContainer{
+					{
+						EphemeralContainerCommon: corev1.EphemeralContainerCommon{
+							Name:            "debugger",
+							Image:           "docker.io/library/busybox:latest",
+							ImagePullPolicy: corev1.PullIfNotPresent,
+						},
+					},
+				},
+			}
+		})
+
+		It("it should set the pull policy on every kind of container", func() {
+			mutator := &Mutator{}
+
+			got := mutator.manageImagePullPolicy(spec)
+			Expect(got.InitContainers[0].ImagePullPolicy).To(Equal(corev1.PullNever))
+			Expect(got.Containers[0].ImagePullPolicy).To(Equal(corev1.PullNever))
+			Expect(got.EphemeralContainers[0].ImagePullPolicy).To(Equal(corev1.PullNever))
+		})
+
+		It("it should match names without a kind across every kind of container", func() {
+			mutator := &Mutator{
+				exclude: []string{"migrate"},
+			}
+
+			got := mutator.manageImagePullPolicy(spec)
+			Expect(got.InitContainers[0].ImagePullPolicy).To(Equal(corev1.PullIfNotPresent))
+			Expect(got.Containers[0].ImagePullPolicy).To(Equal(corev1.PullIfNotPresent))
+			Expect(got.EphemeralContainers[0].ImagePullPolicy).To(Equal(corev1.PullNever))
+		})
+
+		It("it should only target the container kind given in the annotation", func() {
+			mutator := &Mutator{
+				include: []string{"init:migrate", "ephemeral:debugger"},
+			}
+
+			got := mutator.manageImagePullPolicy(spec)
+			Expect(got.InitContainers[0].ImagePullPolicy).To(Equal(corev1.PullNever))
+			Expect(got.Containers[0].ImagePullPolicy).To(Equal(corev1.PullIfNotPresent))
+			Expect(got.EphemeralContainers[0].ImagePullPolicy).To(Equal(corev1.PullNever))
+		})
+
+		It("it should add selectors for init container images, but not ephemeral ones", func() {
+			mutator := &Mutator{}
+
+			got := mutator.manageSelectors(spec)
+			Expect(got.NodeSelector).To(HaveLen(2))
+			Expect(got.NodeSelector).To(HaveKeyWithValue("image.stvz.io/52eacfd06bb1d06c9b440400a88c6fac", "available"))
+			Expect(got.NodeSelector).To(HaveKeyWithValue("image.stvz.io/e28d47094db7c64507211886dcba74c9", "available"))
+		})
+
+		It("it should exclude init container images from the selectors", func() {
+			mutator := &Mutator{
+				exclude: []string{"init:migrate"},
+			}
+
+			got := mutator.manageSelectors(spec)
+			Expect(got.NodeSelector).To(HaveLen(1))
+			Expect(got.NodeSelector).To(HaveKeyWithValue("image.stvz.io/e28d47094db7c64507211886dcba74c9", "available"))
+		})
+	})
+
+	Context("manageAffinity", func() {
+		It("it should add a weighted preferred term for each selected container", func() {
+			mutator := &Mutator{
+				exclude: []string{"sidecar"},
+			}
+
+			spec := corev1.PodSpec{
+				Containers: []corev1.Container{
+					{
+						Name:  "bookworm",
+						Image: "docker.io/library/debian:bookworm-slim",
+					},
+					{
+						Name:  "bullseye",
+						Image: "docker.io/library/debian:bullseye-slim",
+					},
+					{
+						Name:  "sidecar",
+						Image: "docker.io/library/busybox:latest",
+					},
+				},
+			}
+			got := mutator.manageAffinity(spec)
+			Expect(got.NodeSelector).To(BeEmpty())
+			Expect(got.Affinity).NotTo(BeNil())
+			Expect(got.Affinity.NodeAffinity).NotTo(BeNil())
+			Expect(got.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution).To(BeNil())
+
+			terms := got.Affinity.NodeAffinity.PreferredDuringSchedulingIgnoredDuringExecution
+			Expect(terms).To(HaveLen(2))
+			Expect(terms[0].Weight).To(Equal(int32(50)))
+			Expect(terms[0].Preference.MatchExpressions).To(Equal([]corev1.NodeSelectorRequirement{
+				{
+					Key:      "image.stvz.io/e28d47094db7c64507211886dcba74c9",
+					Operator: corev1.NodeSelectorOpIn,
+					Values:   []string{"available"},
+				},
+			}))
+			Expect(terms[1].Weight).To(Equal(int32(50)))
+			Expect(terms[1].Preference.MatchExpressions[0].Key).To(Equal("image.stvz.io/52eacfd06bb1d06c9b440400a88c6fac"))
+		})
+
+		It("it should add terms for the normalized names of short images", func() {
+			mutator := &Mutator{}
+
+			spec := corev1.PodSpec{
+				Containers: []corev1.Container{
+					{
+						Name:  "bookworm",
+						Image: "debian:bookworm-slim",
+					},
+				},
+			}
+			got := mutator.manageAffinity(spec)
+
+			terms := got.Affinity.NodeAffinity.PreferredDuringSchedulingIgnoredDuringExecution
+			Expect(terms).To(HaveLen(1))
+			Expect(terms[0].Preference.MatchExpressions[0].Key).To(Equal("image.stvz.io/e28d47094db7c64507211886dcba74c9"))
+		})
+
+		It("it should preserve existing affinity and replace previous coral terms", func() {
+			mutator := &Mutator{}
+
+			user := corev1.PreferredSchedulingTerm{
+				Weight: 10,
+				Preference: corev1.NodeSelectorTerm{
+					MatchExpressions: []corev1.NodeSelectorRequirement{
+						{
+							Key:      "kubernetes.io/arch",
+							Operator: corev1.NodeSelectorOpIn,
+							Values:   []string{"arm64"},
+						},
+					},
+				},
+			}
+			required := &corev1.NodeSelector{
+				NodeSelectorTerms: []corev1.NodeSelectorTerm{
+					{
+						MatchExpressions: []corev1.NodeSelectorRequirement{
+							{
+								Key:      "kubernetes.io/os",
+								Operator: corev1.NodeSelectorOpIn,
+								Values:   []string{"linux"},
+							},
+						},
+					},
+				},
+			}
+
+			spec := corev1.PodSpec{
+				Containers: []corev1.Container{
+					{
+						Name:  "bookworm",
+						Image: "docker.io/library/debian:bookworm-slim",
+					},
+				},
+				Affinity: &corev1.Affinity{
+					NodeAffinity: &corev1.NodeAffinity{
+						RequiredDuringSchedulingIgnoredDuringExecution: required,
+						PreferredDuringSchedulingIgnoredDuringExecution: []corev1.PreferredSchedulingTerm{
+							user,
+							{
+								Weight: 100,
+								Preference: corev1.NodeSelectorTerm{
+									MatchExpressions: []corev1.NodeSelectorRequirement{
+										{
+											Key:      "image.stvz.io/52eacfd06bb1d06c9b440400a88c6fac",
+											Operator: corev1.NodeSelectorOpIn,
+											Values:   []string{"available"},
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			}
+			got := mutator.manageAffinity(spec)
+			Expect(got.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution).To(Equal(required))
+
+			terms := got.Affinity.NodeAffinity.PreferredDuringSchedulingIgnoredDuringExecution
+			Expect(terms).To(HaveLen(2))
+			Expect(terms[0]).To(Equal(user))
+			Expect(terms[1].Weight).To(Equal(int32(100)))
+			Expect(terms[1].Preference.MatchExpressions[0].Key).To(Equal("image.stvz.io/e28d47094db7c64507211886dcba74c9"))
+		})
+
+		It("it should not add affinity when no containers are selected", func() {
+			mutator := &Mutator{
+				include: []string{"missing"},
+			}
+
+			spec := corev1.PodSpec{
+				Containers: []corev1.Container{
+					{
+						Name:  "bookworm",
+						Image: "docker.io/library/debian:bookworm-slim",
+					},
+				},
+			}
+			got := mutator.manageAffinity(spec)
+			Expect(got.Affinity).To(BeNil())
+		})
+	})
+
+	Context("rewriteImages", func() {
+		digest := "sha256:" + strings.Repeat("a", 64)
+		mirrors := []stvziov1.Mirror{
+			{
+				ObjectMeta: metav1.ObjectMeta{Name: "base", Namespace: "coral"},
+				Spec: stvziov1.MirrorSpec{
+					Registry: &stvziov1.RegistrySpec{Host: "localhost", Port: 5000},
+					Repositories: stvziov1.Repositories{
+						{
+							Name: &[]string{"docker.io/library/debian"}[0],
+							Tags: []string{"bookworm-slim", "bullseye-slim"},
+						},
+					},
+				},
+				Status: stvziov1.MirrorStatus{
+					Images: []stvziov1.MirrorImageStatus{
+						{
+							Name:              "docker.io/library/debian:bookworm-slim",
+							SourceDigest:      digest,
+							DestinationDigest: digest,
+							State:             stvziov1.MirrorImageStateSynced,
+						},
+					},
+				},
+			},
+		}
+
+		It("it should pin mirrored images to the local registry and warn about the others", func() {
+			mutator := &Mutator{
+				rewrite: true,
+				mirrors: mirrors,
+				log:     logger,
+			}
+
+			spec := corev1.PodSpec{
+				InitContainers: []corev1.Container{
+					{
+						Name:  "init",
+						Image: "debian:bullseye-slim",
+					},
+				},
+				Containers: []corev1.Container{
+					{
+						Name:  "bookworm",
+						Image: "docker.io/library/debian:bookworm-slim",
+					},
+					{
+						Name:  "alpine",
+						Image: "alpine:3.19",
+					},
+				},
+			}
+
+			got := mutator.manage(spec)
+			Expect(got.InitContainers[0].Image).To(Equal("debian:bullseye-slim"))
+			Expect(got.Containers[0].Image).To(Equal("localhost:5000/docker.io/library/debian@" + digest))
+			Expect(got.Containers[1].Image).To(Equal("alpine:3.19"))
+			Expect(mutator.warnings).To(HaveLen(2))
+			Expect(mutator.warnings[0]).To(ContainSubstring("debian:bullseye-slim has not been mirrored yet"))
+			Expect(mutator.warnings[1]).To(ContainSubstring("alpine:3.19 is not mirrored"))
+		})
+
+		It("it should only rewrite the included containers", func() {
+			mutator := &Mutator{
+				rewrite: true,
+				mirrors: mirrors,
+				include: []string{"bookworm"},
+				log:     logger,
+			}
+
+			spec := corev1.PodSpec{
+				Containers: []corev1.Container{
+					{
+						Name:  "bookworm",
+						Image: "docker.io/library/debian:bookworm-slim",
+					},
+					{
+						Name:  "bullseye",
+						Image: "docker.io/library/debian:bullseye-slim",
+					},
+				},
+			}
+
+			got := mutator.manage(spec)
+			Expect(got.Containers[0].Image).To(Equal("localhost:5000/docker.io/library/debian@" + digest))
+			Expect(got.Containers[1].Image).To(Equal("docker.io/library/debian:bullseye-slim"))
+		})
+
+		It("it should leave rewritten images and their selectors alone when admitted again", func() {
+			mutator := &Mutator{
+				rewrite:   true,
+				selectors: true,
+				mirrors:   mirrors,
+				log:       logger,
+			}
+
+			spec := corev1.PodSpec{
+				Containers: []corev1.Container{
+					{
+						Name:  "bookworm",
+						Image: "docker.io/library/debian:bookworm-slim",
+					},
+				},
+			}
+
+			got := mutator.manage(spec)
+			Expect(got.Containers[0].Image).To(Equal("localhost:5000/docker.io/library/debian@" + digest))
+			Expect(got.NodeSelector).To(Equal(map[string]string{
+				"image.stvz.io/e28d47094db7c64507211886dcba74c9": "available",
+			}))
+
+			got = mutator.manage(got)
+			Expect(got.Containers[0].Image).To(Equal("localhost:5000/docker.io/library/debian@" + digest))
+			Expect(got.NodeSelector).To(Equal(map[string]string{
+				"image.stvz.io/e28d47094db7c64507211886dcba74c9": "available",
+			}))
+			Expect(mutator.warnings).To(BeEmpty())
+		})
+
+		It("it should match images referenced by the source digest", func() {
+			image, ok := MirroredImage(mirrors, "debian@"+digest)
+			Expect(ok).To(BeTrue())
+			Expect(image).To(Equal("localhost:5000/docker.io/library/debian@" + digest))
+
+			_, ok = MirroredImage(mirrors, "debian@sha256:"+strings.Repeat("b", 64))
+			Expect(ok).To(BeFalse())
+		})
+
+		It("it should not return a reference until the destination digest is known", func() {
+			image, ok := MirroredImage(mirrors, "debian:bullseye-slim")
+			Expect(ok).To(BeTrue())
+			Expect(image).To(BeEmpty())
+		})
+	})
 })
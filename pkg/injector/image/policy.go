@@ -0,0 +1,98 @@
+// Copyright 2024 Coral Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package image
+
+import (
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/go-logr/logr"
+	stvziov1 "stvz.io/coral/pkg/apis/stvz.io/v1"
+)
+
+// MergePolicies merges the injection policies that apply to a workload and returns
+// the names of the merged policies.  The matching policies are ordered with the
+// namespaced policies first and the cluster policies after them, each sorted by name.
+// The modes of every matching policy are combined, include and exclude are taken from
+// the first policy in the order that sets them, and overrides are only allowed when
+// every matching policy allows them.  Policies with invalid selectors are skipped.
+// Nil is returned when no policy matches.
+func MergePolicies(
+	log logr.Logger,
+	policies []stvziov1.InjectionPolicy,
+	clusterPolicies []stvziov1.ClusterInjectionPolicy,
+	nsLabels, objLabels map[string]string,
+) (string, *stvziov1.InjectionPolicySpec) {
+	sort.Slice(policies, func(i, j int) bool {
+		return policies[i].Name < policies[j].Name
+	})
+	sort.Slice(clusterPolicies, func(i, j int) bool {
+		return clusterPolicies[i].Name < clusterPolicies[j].Name
+	})
+
+	var names []string
+	var matched []stvziov1.InjectionPolicySpec
+
+	for _, p := range policies {
+		ok, err := p.Spec.Matches(objLabels)
+		if err != nil {
+			log.Error(err, "invalid injection policy selector", "policy", p.Name, "namespace", p.Namespace)
+			continue
+		}
+
+		if ok {
+			names = append(names, p.Namespace+"/"+p.Name)
+			matched = append(matched, p.Spec)
+		}
+	}
+
+	for _, p := range clusterPolicies {
+		ok, err := p.Spec.Matches(nsLabels, objLabels)
+		if err != nil {
+			log.Error(err, "invalid cluster injection policy selector", "policy", p.Name)
+			continue
+		}
+
+		if ok {
+			names = append(names, p.Name)
+			matched = append(matched, p.Spec.InjectionPolicySpec)
+		}
+	}
+
+	if len(matched) == 0 {
+		return "", nil
+	}
+
+	merged := &stvziov1.InjectionPolicySpec{
+		AllowOverride: true,
+	}
+	for _, spec := range matched {
+		for _, mode := range spec.Modes {
+			if !slices.Contains(merged.Modes, mode) {
+				merged.Modes = append(merged.Modes, mode)
+			}
+		}
+		if merged.Include == nil && len(spec.Include) > 0 {
+			merged.Include = spec.Include
+		}
+		if merged.Exclude == nil && len(spec.Exclude) > 0 {
+			merged.Exclude = spec.Exclude
+		}
+		merged.AllowOverride = merged.AllowOverride && spec.AllowOverride
+	}
+
+	return strings.Join(names, ","), merged
+}
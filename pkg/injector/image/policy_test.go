@@ -0,0 +1,164 @@
+// Copyright 2024 Coral Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package image
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.uber.org/zap/zapcore"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	stvziov1 "stvz.io/coral/pkg/apis/stvz.io/v1"
+)
+
+var _ = Describe("Injection policies:", func() {
+	logger := zap.New(
+		zap.Level(zapcore.Level(8) * -1),
+	)
+
+	Context("MergePolicies", func() {
+		web := map[string]string{"app": "web"}
+
+		clusterPolicies := []stvziov1.ClusterInjectionPolicy{
+			{
+				ObjectMeta: metav1.ObjectMeta{Name: "production"},
+				Spec: stvziov1.ClusterInjectionPolicySpec{
+					NamespaceSelector: &metav1.LabelSelector{
+						MatchLabels: map[string]string{"env": "production"},
+					},
+					InjectionPolicySpec: stvziov1.InjectionPolicySpec{
+						Modes:         []stvziov1.InjectionMode{stvziov1.InjectionModeSelectors},
+						Exclude:       []string{"sidecar"},
+						AllowOverride: true,
+					},
+				},
+			},
+		}
+
+		It("should merge the namespaced and cluster policies", func() {
+			policies := []stvziov1.InjectionPolicy{
+				{
+					ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"},
+					Spec: stvziov1.InjectionPolicySpec{
+						ObjectSelector: &metav1.LabelSelector{MatchLabels: web},
+						Modes:          []stvziov1.InjectionMode{stvziov1.InjectionModeRewrite},
+						Include:        []string{"app"},
+						AllowOverride:  true,
+					},
+				},
+			}
+
+			name, spec := MergePolicies(logger, policies, clusterPolicies, map[string]string{"env": "production"}, web)
+			Expect(name).To(Equal("default/web,production"))
+			Expect(spec.Modes).To(Equal([]stvziov1.InjectionMode{stvziov1.InjectionModeRewrite, stvziov1.InjectionModeSelectors}))
+			Expect(spec.Include).To(Equal([]string{"app"}))
+			Expect(spec.Exclude).To(Equal([]string{"sidecar"}))
+			Expect(spec.AllowOverride).To(BeTrue())
+		})
+
+		It("should prefer the earlier policies and only allow overrides if every policy does", func() {
+			policies := []stvziov1.InjectionPolicy{
+				{
+					ObjectMeta: metav1.ObjectMeta{Name: "db", Namespace: "default"},
+					Spec: stvziov1.InjectionPolicySpec{
+						ObjectSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "db"}},
+						Modes:          []stvziov1.InjectionMode{stvziov1.InjectionModeRewrite},
+					},
+				},
+			}
+			clusters := append([]stvziov1.ClusterInjectionPolicy{
+				{
+					ObjectMeta: metav1.ObjectMeta{Name: "zz-everything"},
+					Spec: stvziov1.ClusterInjectionPolicySpec{
+						InjectionPolicySpec: stvziov1.InjectionPolicySpec{
+							Modes:   []stvziov1.InjectionMode{stvziov1.InjectionModePullPolicy},
+							Exclude: []string{"init:migrate"},
+						},
+					},
+				},
+			}, clusterPolicies...)
+
+			name, spec := MergePolicies(logger, policies, clusters, map[string]string{"env": "production"}, web)
+			Expect(name).To(Equal("production,zz-everything"))
+			Expect(spec.Modes).To(Equal([]stvziov1.InjectionMode{stvziov1.InjectionModeSelectors, stvziov1.InjectionModePullPolicy}))
+			Expect(spec.Exclude).To(Equal([]string{"sidecar"}))
+			Expect(spec.AllowOverride).To(BeFalse())
+
+			name, spec = MergePolicies(logger, policies, clusters, map[string]string{"env": "staging"}, web)
+			Expect(name).To(Equal("zz-everything"))
+			Expect(spec.Exclude).To(Equal([]string{"init:migrate"}))
+		})
+
+		It("should return nil when no policy matches", func() {
+			name, spec := MergePolicies(logger, nil, clusterPolicies, map[string]string{"env": "staging"}, web)
+			Expect(name).To(BeEmpty())
+			Expect(spec).To(BeNil())
+		})
+	})
+
+	Context("ApplyPolicy", func() {
+		pod := func(annotations map[string]string) *corev1.Pod {
+			return &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "test",
+					Annotations: annotations,
+				},
+			}
+		}
+
+		spec := stvziov1.InjectionPolicySpec{
+			Modes:   []stvziov1.InjectionMode{stvziov1.InjectionModePullPolicy, stvziov1.InjectionModeSoftSelectors},
+			Exclude: []string{"sidecar"},
+		}
+
+		It("should apply the policy to objects without annotations", func() {
+			m := &Mutator{obj: pod(nil)}
+			m.ApplyPolicy("default/policy", spec)
+
+			Expect(m.Managed()).To(BeTrue())
+			Expect(m.policy).To(BeTrue())
+			Expect(m.affinity).To(BeTrue())
+			Expect(m.selectors).To(BeFalse())
+			Expect(m.exclude).To(Equal([]string{"sidecar"}))
+			Expect(m.warnings).To(BeEmpty())
+		})
+
+		It("should ignore the annotations and warn when overrides are not allowed", func() {
+			m := &Mutator{obj: pod(map[string]string{InjectAnnotation: "", ExcludedAnnotation: "app"})}
+			m.ApplyPolicy("default/policy", spec)
+
+			Expect(m.policy).To(BeTrue())
+			Expect(m.exclude).To(Equal([]string{"sidecar"}))
+			Expect(m.warnings).To(HaveLen(2))
+		})
+
+		It("should let the annotations override the policy when allowed", func() {
+			override := spec
+			override.AllowOverride = true
+
+			m := &Mutator{obj: pod(map[string]string{InjectAnnotation: "rewrite", ExcludedAnnotation: "app"})}
+			m.ApplyPolicy("default/policy", override)
+			Expect(m.rewrite).To(BeTrue())
+			Expect(m.policy).To(BeFalse())
+			Expect(m.exclude).To(Equal([]string{"app"}))
+
+			m = &Mutator{obj: pod(map[string]string{InjectAnnotation: ""})}
+			m.ApplyPolicy("default/policy", override)
+			Expect(m.Managed()).To(BeFalse())
+			Expect(m.exclude).To(Equal([]string{"sidecar"}))
+		})
+	})
+})
@@ -0,0 +1,148 @@
+// Copyright 2024 Coral Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package image
+
+import (
+	"sort"
+
+	"github.com/containers/image/v5/docker/reference"
+	stvziov1 "stvz.io/coral/pkg/apis/stvz.io/v1"
+)
+
+// MirroredImage returns the reference to the image in the local registry of the
+// first mirror that covers it, pinned to the mirrored digest.  The reference is empty
+// while the image is tracked by a mirror that hasn't copied it yet, since the local
+// registry can't serve it.  Images referenced by digest are only matched when the
+// digest is the source digest of a mirrored tag.
+func MirroredImage(mirrors []stvziov1.Mirror, image string) (string, bool) {
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return "", false
+	}
+	named = reference.TagNameOnly(named)
+	repo := reference.TrimNamed(named).String()
+
+	tag := ""
+	if tagged, ok := named.(reference.Tagged); ok {
+		tag = tagged.Tag()
+	}
+	digest := ""
+	if digested, ok := named.(reference.Digested); ok {
+		digest = digested.Digest().String()
+	}
+
+	// Sort the mirrors so the same mirror is always chosen.
+	sorted := make([]stvziov1.Mirror, len(mirrors))
+	copy(sorted, mirrors)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Namespace != sorted[j].Namespace {
+			return sorted[i].Namespace < sorted[j].Namespace
+		}
+		return sorted[i].Name < sorted[j].Name
+	})
+
+	for _, m := range sorted {
+		if m.Spec.Registry == nil {
+			continue
+		}
+		prefix := m.Spec.Registry.Address() + "/" + repo
+
+		for _, img := range m.Status.Images {
+			ref, err := reference.ParseNormalizedNamed(img.Name)
+			if err != nil || reference.TrimNamed(ref).String() != repo {
+				continue
+			}
+
+			switch {
+			case digest != "" && img.SourceDigest == digest && img.DestinationDigest != "":
+				return prefix + "@" + img.DestinationDigest, true
+			case digest == "" && img.Name == repo+":"+tag && img.DestinationDigest != "":
+				return prefix + "@" + img.DestinationDigest, true
+			}
+		}
+
+		if digest == "" && mirrorsTag(m, repo, tag) {
+			return "", true
+		}
+	}
+
+	return "", false
+}
+
+func mirrorsTag(m stvziov1.Mirror, repo, tag string) bool {
+	repos := append(m.Spec.Repositories.Explicit(), m.Status.Repositories...)
+
+	for _, r := range repos {
+		name, err := stvziov1.NormalizeRepo(r.Name)
+		if err != nil || name != repo {
+			continue
+		}
+
+		for _, t := range r.Tags {
+			if t == tag {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// SourceImage returns the normalized NAME:TAG of the source image for an image in
+// the local registry of a mirror, so images that were already rewritten can be
+// matched against the images tracked by the agent.  The name is empty if the source
+// tag can't be found.  The second return value is false if the image is not in the
+// local registry of a mirror.
+func SourceImage(mirrors []stvziov1.Mirror, image string) (string, bool) {
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return "", false
+	}
+
+	for _, m := range mirrors {
+		if m.Spec.Registry == nil || reference.Domain(named) != m.Spec.Registry.Address() {
+			continue
+		}
+
+		repo, err := stvziov1.NormalizeRepo(reference.Path(named))
+		if err != nil {
+			return "", true
+		}
+
+		if tagged, ok := named.(reference.Tagged); ok {
+			return repo + ":" + tagged.Tag(), true
+		}
+
+		digested, ok := named.(reference.Digested)
+		if !ok {
+			return repo + ":latest", true
+		}
+
+		for _, img := range m.Status.Images {
+			ref, err := reference.ParseNormalizedNamed(img.Name)
+			if err != nil || reference.TrimNamed(ref).String() != repo {
+				continue
+			}
+
+			if img.DestinationDigest == digested.Digest().String() {
+				return img.Name, true
+			}
+		}
+
+		return "", true
+	}
+
+	return "", false
+}
@@ -0,0 +1,158 @@
+// Copyright 2024 Coral Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package image
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/yaml"
+)
+
+// ErrInvalidTemplatePath is returned when a pod template path entry can't be parsed.
+var ErrInvalidTemplatePath = errors.New("invalid pod template path")
+
+// templateFields are the pod spec fields managed by the mutator.  Only these fields
+// are written back to the template so fields unknown to the core pod spec, such as
+// the ones added by Knative, are preserved.
+var templateFields = []string{
+	"affinity",
+	"containers",
+	"ephemeralContainers",
+	"initContainers",
+	"nodeSelector",
+}
+
+// TemplatePath is the location of the pod template in a workload kind that isn't
+// natively supported by the injector.
+type TemplatePath struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	// Path is the dot separated path to the pod template, for example spec.template.
+	Path string `json:"path"`
+}
+
+// TemplatePaths maps workload kinds to the path of their pod template.
+type TemplatePaths map[schema.GroupVersionKind][]string
+
+// Add adds the path to the registry after validating it.
+func (t TemplatePaths) Add(p TemplatePath) error {
+	gv, err := schema.ParseGroupVersion(p.APIVersion)
+	if err != nil || gv.Version == "" || p.Kind == "" {
+		return fmt.Errorf("%w: %s/%s", ErrInvalidTemplatePath, p.APIVersion, p.Kind)
+	}
+
+	path := strings.Split(p.Path, ".")
+	for _, field := range path {
+		if field == "" {
+			return fmt.Errorf("%w: %s", ErrInvalidTemplatePath, p.Path)
+		}
+	}
+
+	t[gv.WithKind(p.Kind)] = path
+	return nil
+}
+
+// Set parses a path in the form of apiVersion/Kind=path, for example
+// argoproj.io/v1alpha1/Rollout=spec.template, and adds it to the registry.
+func (t TemplatePaths) Set(entry string) error {
+	kind, path, ok := strings.Cut(entry, "=")
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrInvalidTemplatePath, entry)
+	}
+
+	idx := strings.LastIndex(kind, "/")
+	if idx < 0 {
+		return fmt.Errorf("%w: %s", ErrInvalidTemplatePath, entry)
+	}
+
+	return t.Add(TemplatePath{
+		APIVersion: kind[:idx],
+		Kind:       kind[idx+1:],
+		Path:       path,
+	})
+}
+
+// Load reads a yaml or json list of paths from a file, usually mounted from a
+// ConfigMap, and adds them to the registry.
+func (t TemplatePaths) Load(file string) error {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+
+	var paths []TemplatePath
+	decoder := yaml.NewYAMLOrJSONDecoder(bytes.NewReader(data), 4096)
+	if err := decoder.Decode(&paths); err != nil {
+		return err
+	}
+
+	for _, p := range paths {
+		if err := t.Add(p); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// templateSpec returns the pod spec of the template found at the path in the
+// unstructured object along with the raw spec.
+func templateSpec(obj *unstructured.Unstructured, path []string) (corev1.PodSpec, map[string]interface{}, error) {
+	spec := corev1.PodSpec{}
+
+	raw, found, err := unstructured.NestedMap(obj.Object, append(append([]string{}, path...), "spec")...)
+	if err != nil {
+		return spec, nil, err
+	}
+	if !found {
+		return spec, nil, fmt.Errorf("pod template not found at %s", strings.Join(path, "."))
+	}
+
+	err = runtime.DefaultUnstructuredConverter.FromUnstructured(raw, &spec)
+	return spec, raw, err
+}
+
+// manageTemplate manages the pod template found at the path in the unstructured
+// object.
+func (m *Mutator) manageTemplate(obj *unstructured.Unstructured, path []string) error {
+	spec, raw, err := templateSpec(obj, path)
+	if err != nil {
+		return err
+	}
+
+	spec = m.manage(spec)
+	out, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&spec)
+	if err != nil {
+		return err
+	}
+
+	for _, field := range templateFields {
+		if v, ok := out[field]; ok {
+			raw[field] = v
+		} else {
+			delete(raw, field)
+		}
+	}
+
+	return unstructured.SetNestedMap(obj.Object, raw, append(append([]string{}, path...), "spec")...)
+}
@@ -0,0 +1,171 @@
+// Copyright 2024 Coral Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package image
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.uber.org/zap/zapcore"
+	admissionv1 "k8s.io/api/admission/v1"
+	"k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset/scheme"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+var _ = Describe("Template paths:", func() {
+	logger := zap.New(
+		zap.Level(zapcore.Level(8) * -1),
+	)
+
+	rollout := schema.GroupVersionKind{Group: "argoproj.io", Version: "v1alpha1", Kind: "Rollout"}
+
+	Context("Set", func() {
+		It("should parse grouped and core kinds", func() {
+			templates := TemplatePaths{}
+			Expect(templates.Set("argoproj.io/v1alpha1/Rollout=spec.template")).To(Succeed())
+			Expect(templates.Set("v1/PodTemplate=template")).To(Succeed())
+
+			Expect(templates).To(HaveKeyWithValue(rollout, []string{"spec", "template"}))
+			Expect(templates).To(HaveKeyWithValue(schema.GroupVersionKind{Version: "v1", Kind: "PodTemplate"}, []string{"template"}))
+		})
+
+		It("should reject malformed entries", func() {
+			templates := TemplatePaths{}
+			Expect(templates.Set("argoproj.io/v1alpha1/Rollout")).To(MatchError(ErrInvalidTemplatePath))
+			Expect(templates.Set("Rollout=spec.template")).To(MatchError(ErrInvalidTemplatePath))
+			Expect(templates.Set("argoproj.io/v1alpha1/Rollout=spec..template")).To(MatchError(ErrInvalidTemplatePath))
+		})
+	})
+
+	Context("Load", func() {
+		It("should load the paths from a yaml file", func() {
+			file := filepath.Join(GinkgoT().TempDir(), "templates.yaml")
+			Expect(os.WriteFile(file, []byte(`
+- apiVersion: argoproj.io/v1alpha1
+  kind: Rollout
+  path: spec.template
+- apiVersion: serving.knative.dev/v1
+  kind: Service
+  path: spec.template
+`), 0o600)).To(Succeed())
+
+			templates := TemplatePaths{}
+			Expect(templates.Load(file)).To(Succeed())
+			Expect(templates).To(HaveLen(2))
+			Expect(templates).To(HaveKeyWithValue(rollout, []string{"spec", "template"}))
+		})
+	})
+
+	Context("Mutate", func() {
+		It("should manage the pod template of a registered kind", func() {
+			raw := []byte(`{
+				"apiVersion": "argoproj.io/v1alpha1",
+				"kind": "Rollout",
+				"metadata": {
+					"name": "test",
+					"namespace": "default",
+					"annotations": {
+						"image.stvz.io/inject": "pull-policy,selectors"
+					}
+				},
+				"spec": {
+					"strategy": {"canary": {}},
+					"template": {
+						"spec": {
+							"containers": [{
+								"name": "test",
+								"image": "docker.io/library/debian:bookworm-slim"
+							}],
+							"unknownField": true
+						}
+					}
+				}
+			}`)
+			req := admission.Request{
+				AdmissionRequest: admissionv1.AdmissionRequest{
+					Kind: metav1.GroupVersionKind{
+						Group:   rollout.Group,
+						Version: rollout.Version,
+						Kind:    rollout.Kind,
+					},
+					Object: runtime.RawExtension{Raw: raw},
+				},
+			}
+
+			templates := TemplatePaths{}
+			Expect(templates.Set("argoproj.io/v1alpha1/Rollout=spec.template")).To(Succeed())
+
+			mutator := NewMutator(logger).WithTemplates(templates)
+			Expect(mutator.FromReq(req, admission.NewDecoder(scheme.Scheme))).To(Succeed())
+			Expect(mutator.Managed()).To(BeTrue())
+
+			resp := mutator.Mutate(req)
+			Expect(resp.Allowed).To(BeTrue())
+			Expect(resp.Patches).NotTo(BeEmpty())
+
+			o, err := json.Marshal(mutator.obj)
+			Expect(err).NotTo(HaveOccurred())
+
+			var got map[string]any
+			Expect(json.Unmarshal(o, &got)).To(Succeed())
+			spec := got["spec"].(map[string]any)
+			Expect(spec).To(HaveKey("strategy"))
+
+			podSpec := spec["template"].(map[string]any)["spec"].(map[string]any)
+			Expect(podSpec).To(HaveKeyWithValue("unknownField", true))
+			Expect(podSpec["nodeSelector"]).To(HaveKeyWithValue("image.stvz.io/e28d47094db7c64507211886dcba74c9", "available"))
+
+			containers := podSpec["containers"].([]any)
+			Expect(containers[0]).To(HaveKeyWithValue("imagePullPolicy", "Never"))
+		})
+
+		It("should fail when the template is missing", func() {
+			req := admission.Request{
+				AdmissionRequest: admissionv1.AdmissionRequest{
+					Kind: metav1.GroupVersionKind{
+						Group:   rollout.Group,
+						Version: rollout.Version,
+						Kind:    rollout.Kind,
+					},
+					Object: runtime.RawExtension{Raw: []byte(`{
+						"apiVersion": "argoproj.io/v1alpha1",
+						"kind": "Rollout",
+						"metadata": {
+							"name": "test",
+							"annotations": {"image.stvz.io/inject": "pull-policy"}
+						},
+						"spec": {}
+					}`)},
+				},
+			}
+
+			templates := TemplatePaths{}
+			Expect(templates.Set("argoproj.io/v1alpha1/Rollout=spec.template")).To(Succeed())
+
+			mutator := NewMutator(logger).WithTemplates(templates)
+			Expect(mutator.FromReq(req, admission.NewDecoder(scheme.Scheme))).To(Succeed())
+
+			resp := mutator.Mutate(req)
+			Expect(resp.Allowed).To(BeFalse())
+		})
+	})
+})
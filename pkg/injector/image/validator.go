@@ -0,0 +1,133 @@
+// Copyright 2024 Coral Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package image
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+	stvziov1 "stvz.io/coral/pkg/apis/stvz.io/v1"
+)
+
+// +kubebuilder:webhook:verbs=create;update,path=/validate-stvz-io-v1-image-injector,mutating=false,failurePolicy=fail,groups="";apps;batch,resources=cronjobs;daemonsets;deployments;jobs;pods;pods/ephemeralcontainers;replicasets;replicationcontrollers;statefulsets,versions=v1,name=vinjector.image.stvz.io,admissionReviewVersions=v1,sideEffects=none
+
+// EnforceLabel is the namespace label that enables validation of the workloads in
+// the namespace.  Workloads are denied when it is set to deny and allowed with
+// warnings when it is set to audit.  Any other value is logged and ignored.
+const EnforceLabel = "image.stvz.io/enforce"
+
+const (
+	EnforceModeDeny  = "deny"
+	EnforceModeAudit = "audit"
+)
+
+// Validator rejects workloads using images that aren't covered by an Image,
+// ClusterImage or Mirror, or that would be pulled from an external registry.
+type Validator struct {
+	client.Client
+	decoder *admission.Decoder
+	log     logr.Logger
+
+	// templates are the pod template paths of the kinds that aren't natively
+	// supported.
+	templates TemplatePaths
+}
+
+func (v *Validator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	if req.Namespace == "" {
+		return admission.Allowed("")
+	}
+
+	ns := &corev1.Namespace{}
+	if err := v.Get(ctx, types.NamespacedName{Name: req.Namespace}, ns); err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+
+	mode, ok := ns.GetLabels()[EnforceLabel]
+	if !ok {
+		return admission.Allowed("")
+	}
+
+	if mode != EnforceModeDeny && mode != EnforceModeAudit {
+		v.log.Info("ignoring unknown enforce mode", "namespace", req.Namespace, "mode", mode)
+		return admission.Allowed("")
+	}
+
+	obj, path, err := decodeObject(req, v.decoder, v.templates)
+	if err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+
+	var spec corev1.PodSpec
+	if u, ok := obj.(*unstructured.Unstructured); ok {
+		spec, _, err = templateSpec(u, path)
+		if err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+	} else if spec, ok = podSpec(obj); !ok {
+		return admission.Allowed("")
+	}
+
+	coverage, err := v.coverage(ctx, req.Namespace)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+
+	reasons := coverage.Violations(spec, req.SubResource == EphemeralContainersSubResource)
+	if len(reasons) == 0 {
+		return admission.Allowed("")
+	}
+
+	if mode == EnforceModeAudit {
+		v.log.V(2).Info("workload uses unmanaged images", "namespace", req.Namespace, "name", req.Name, "kind", req.Kind.Kind, "reasons", reasons)
+		return admission.Allowed("").WithWarnings(reasons...)
+	}
+
+	return admission.Denied("workload uses unmanaged images: " + strings.Join(reasons, "; "))
+}
+
+// coverage returns the objects that can cover the images in the namespace.
+func (v *Validator) coverage(ctx context.Context, namespace string) (*Coverage, error) {
+	images := &stvziov1.ImageList{}
+	if err := v.List(ctx, images, client.InNamespace(namespace)); err != nil {
+		return nil, err
+	}
+
+	clusterImages := &stvziov1.ClusterImageList{}
+	if err := v.List(ctx, clusterImages); err != nil {
+		return nil, err
+	}
+
+	mirrors := &stvziov1.MirrorList{}
+	if err := v.List(ctx, mirrors); err != nil {
+		return nil, err
+	}
+
+	return &Coverage{
+		Namespace:     namespace,
+		Images:        images.Items,
+		ClusterImages: clusterImages.Items,
+		Mirrors:       mirrors.Items,
+	}, nil
+}
+
+var _ admission.Handler = &Validator{}
@@ -0,0 +1,90 @@
+// Copyright 2024 Coral Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package image
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.uber.org/zap/zapcore"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset/scheme"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+	"stvz.io/coral/pkg/mock"
+)
+
+var _ = Describe("Validator:", func() {
+	logger := zap.New(
+		zap.Level(zapcore.Level(8) * -1),
+	)
+
+	request := admission.Request{
+		AdmissionRequest: admissionv1.AdmissionRequest{
+			Namespace: "default",
+			Kind: metav1.GroupVersionKind{
+				Version: "v1",
+				Kind:    "Pod",
+			},
+			Object: runtime.RawExtension{
+				Raw: []byte(`{
+					"apiVersion": "v1",
+					"kind": "Pod",
+					"metadata": {"name": "test", "namespace": "default"},
+					"spec": {"containers": [{"name": "test", "image": "alpine:3.19"}]}
+				}`),
+			},
+		},
+	}
+
+	validate := func(mode string) admission.Response {
+		c := mock.NewClient().WithLogger(logger)
+		Expect(c.Create(context.Background(), &corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   "default",
+				Labels: map[string]string{EnforceLabel: mode},
+			},
+		})).To(Succeed())
+
+		v := &Validator{
+			Client:  c,
+			decoder: admission.NewDecoder(scheme.Scheme),
+			log:     logger,
+		}
+		return v.Handle(context.Background(), request)
+	}
+
+	It("should deny unmanaged images when enforcing", func() {
+		resp := validate(EnforceModeDeny)
+		Expect(resp.Allowed).To(BeFalse())
+		Expect(resp.Result.Message).To(ContainSubstring("alpine:3.19"))
+	})
+
+	It("should allow unmanaged images with warnings when auditing", func() {
+		resp := validate(EnforceModeAudit)
+		Expect(resp.Allowed).To(BeTrue())
+		Expect(resp.Warnings).ToNot(BeEmpty())
+	})
+
+	It("should allow unmanaged images for unknown modes", func() {
+		resp := validate("strict")
+		Expect(resp.Allowed).To(BeTrue())
+		Expect(resp.Warnings).To(BeEmpty())
+	})
+})
@@ -21,8 +21,8 @@ import (
 
 type Injector struct{}
 
-func SetupWebhookWithManager(mgr ctrl.Manager) (err error) {
-	if err = image.SetupWebhookWithManager(mgr); err != nil {
+func SetupWebhookWithManager(mgr ctrl.Manager, templates image.TemplatePaths) (err error) {
+	if err = image.SetupWebhookWithManager(mgr, templates); err != nil {
 		return
 	}
 
@@ -1,6 +1,7 @@
 package mirror
 
 import (
+	"bytes"
 	"context"
 	"io"
 	"strings"
@@ -8,23 +9,25 @@ import (
 
 	"github.com/containers/image/v5/copy"
 	"github.com/containers/image/v5/docker"
+	"github.com/containers/image/v5/docker/reference"
+	"github.com/containers/image/v5/image"
+	"github.com/containers/image/v5/manifest"
 	"github.com/containers/image/v5/signature"
 	"github.com/containers/image/v5/transports/alltransports"
 	"github.com/containers/image/v5/types"
 	runtime "k8s.io/cri-api/pkg/apis/runtime/v1"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	stvziov1 "stvz.io/coral/pkg/apis/stvz.io/v1"
 )
 
-func GetRepositoryTags(ctx context.Context, auth *runtime.AuthConfig, registry string, name string) ([]string, error) {
-	name = registry + "/" + name
-
-	ref, err := alltransports.ParseImageName(name)
+// GetRepositoryTags lists the tags for the repository in the local registry.
+func GetRepositoryTags(ctx context.Context, dest *Destination, name string) ([]string, error) {
+	ref, err := alltransports.ParseImageName(dest.Reference(name))
 	if err != nil {
 		return nil, err
 	}
 
-	// TODO: make tls verify configurable
-	sys := SystemContext(auth, false)
+	sys := dest.SystemContext()
 
 	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
 	defer cancel()
@@ -40,18 +43,316 @@ func GetRepositoryTags(ctx context.Context, auth *runtime.AuthConfig, registry s
 	return l, nil
 }
 
-func Copy(ctx context.Context, auth *runtime.AuthConfig, src string, dest string) error {
+// ListTags lists the tags for the repository in the upstream registry.
+func ListTags(ctx context.Context, auth *runtime.AuthConfig, name string) ([]string, error) {
+	ref, err := alltransports.ParseImageName("docker://" + name)
+	if err != nil {
+		return nil, err
+	}
+
+	sys := SystemContext(auth, true)
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	return docker.GetRepositoryTags(ctx, sys, ref)
+}
+
+// GetDigest resolves the image reference to the digest of it's manifest in the
+// registry.  For multi-arch images this is the digest of the manifest list.
+func GetDigest(ctx context.Context, auth *runtime.AuthConfig, name string) (string, error) {
+	ref, err := alltransports.ParseImageName("docker://" + name)
+	if err != nil {
+		return "", err
+	}
+
+	sys := SystemContext(auth, true)
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	d, err := docker.GetDigest(ctx, sys, ref)
+	if err != nil {
+		return "", err
+	}
+
+	return d.String(), nil
+}
+
+// CheckRegistry verifies the registry is reachable and that the credentials, if
+// any, are accepted.
+func CheckRegistry(ctx context.Context, dest *Destination) error {
+	sys := dest.SystemContext()
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	return docker.CheckAuth(ctx, sys, sys.DockerAuthConfig.Username, sys.DockerAuthConfig.Password, dest.Registry.Address())
+}
+
+// Manifest describes an image manifest in a registry.
+type Manifest struct {
+	// Digest is the digest of the manifest or manifest list.
+	Digest string
+	// Platforms are the platforms of the images referenced by the manifest.
+	Platforms []string
+}
+
+// GetPlatformDigest resolves the image reference to the digest the mirrored image
+// will have once the selected platforms have been copied.  When every platform is
+// selected, this is the digest of the upstream manifest.
+func GetPlatformDigest(ctx context.Context, auth *runtime.AuthConfig, name string, platforms stvziov1.PlatformSelection) (string, error) {
+	if platforms.Mode == "" || platforms.Mode == stvziov1.PlatformModeAll {
+		return GetDigest(ctx, auth, name)
+	}
+
+	ref, err := alltransports.ParseImageName("docker://" + name)
+	if err != nil {
+		return "", err
+	}
+
+	sys := SystemContext(auth, true)
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	raw, mime, err := getManifest(ctx, sys, ref)
+	if err != nil {
+		return "", err
+	}
+
+	// Single images are copied as they are regardless of the selection.
+	if !manifest.MIMETypeIsMultiImage(mime) {
+		return digestOf(raw)
+	}
+
+	if platforms.Mode == stvziov1.PlatformModeSystem {
+		list, err := manifest.ListFromBlob(raw, mime)
+		if err != nil {
+			return "", err
+		}
+
+		d, err := list.ChooseInstance(sys)
+		if err != nil {
+			return "", err
+		}
+
+		return d.String(), nil
+	}
+
+	filtered, _, err := FilterList(raw, platforms.List)
+	if err != nil {
+		return "", err
+	}
+
+	return digestOf(filtered)
+}
+
+// InspectDestination returns the digest and platforms of the mirrored image in the
+// local registry.
+func InspectDestination(ctx context.Context, dest *Destination, name string) (Manifest, error) {
+	ref, err := alltransports.ParseImageName(dest.Reference(name))
+	if err != nil {
+		return Manifest{}, err
+	}
+
+	sys := dest.SystemContext()
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	src, err := ref.NewImageSource(ctx, sys)
+	if err != nil {
+		return Manifest{}, err
+	}
+	defer src.Close()
+
+	raw, mime, err := src.GetManifest(ctx, nil)
+	if err != nil {
+		return Manifest{}, err
+	}
+
+	d, err := digestOf(raw)
+	if err != nil {
+		return Manifest{}, err
+	}
+
+	if manifest.MIMETypeIsMultiImage(mime) {
+		platforms, err := ListPlatforms(raw)
+		if err != nil {
+			return Manifest{}, err
+		}
+		return Manifest{Digest: d, Platforms: platforms}, nil
+	}
+
+	img, err := image.FromUnparsedImage(ctx, sys, image.UnparsedInstance(src, nil))
+	if err != nil {
+		return Manifest{}, err
+	}
+
+	info, err := img.Inspect(ctx)
+	if err != nil {
+		return Manifest{}, err
+	}
+
+	platform := stvziov1.Platform{
+		OS:           info.Os,
+		Architecture: info.Architecture,
+		Variant:      info.Variant,
+	}
+
+	return Manifest{Digest: d, Platforms: []string{platform.String()}}, nil
+}
+
+func getManifest(ctx context.Context, sys *types.SystemContext, ref types.ImageReference) ([]byte, string, error) {
+	src, err := ref.NewImageSource(ctx, sys)
+	if err != nil {
+		return nil, "", err
+	}
+	defer src.Close()
+
+	return src.GetManifest(ctx, nil)
+}
+
+func digestOf(blob []byte) (string, error) {
+	d, err := manifest.Digest(blob)
+	if err != nil {
+		return "", err
+	}
+
+	return d.String(), nil
+}
+
+// GetCreated returns the time the image was created from the image configuration.
+func GetCreated(ctx context.Context, auth *runtime.AuthConfig, name string) (time.Time, error) {
+	ref, err := alltransports.ParseImageName("docker://" + name)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	sys := SystemContext(auth, true)
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	img, err := ref.NewImage(ctx, sys)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer img.Close()
+
+	info, err := img.Inspect(ctx)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if info.Created == nil {
+		return time.Time{}, nil
+	}
+
+	return *info.Created, nil
+}
+
+// GetSize returns the compressed size of the image layers and configuration.  For
+// multi-arch images only the image for the current platform is counted.
+func GetSize(ctx context.Context, auth *runtime.AuthConfig, name string) (int64, error) {
+	ref, err := alltransports.ParseImageName("docker://" + name)
+	if err != nil {
+		return 0, err
+	}
+
+	sys := SystemContext(auth, true)
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	img, err := ref.NewImage(ctx, sys)
+	if err != nil {
+		return 0, err
+	}
+	defer img.Close()
+
+	size := img.ConfigInfo().Size
+	for _, layer := range img.LayerInfos() {
+		size += layer.Size
+	}
+
+	return size, nil
+}
+
+// SelectTags returns the explicit tags for the repository along with any tags that
+// are matched by the tag selection in the upstream registry.  When all tags are
+// selected, the upstream tags are returned within the repository limits.
+func SelectTags(ctx context.Context, auth *runtime.AuthConfig, repo stvziov1.RepositorySpec) ([]string, error) {
+	if repo.Selection == nil && repo.ListSelection != stvziov1.ListSelectorAll {
+		return repo.Tags, nil
+	}
+
+	name, err := stvziov1.NormalizeRepo(*repo.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	upstream, err := ListTags(ctx, auth, name)
+	if err != nil {
+		return nil, err
+	}
+
+	// When all tags are selected, any explicit tags and selections are ignored.
+	if repo.ListSelection == stvziov1.ListSelectorAll {
+		var maxSize int64
+		if repo.MaxSize != nil {
+			maxSize = repo.MaxSize.Value()
+		}
+
+		return LimitTags(upstream, repo.MaxTags, maxSize, func(tag string) (int64, error) {
+			return GetSize(ctx, auth, name+":"+tag)
+		}), nil
+	}
+
+	selected, err := repo.Selection.Filter(upstream)
+	if err != nil {
+		return nil, err
+	}
+
+	selected, err = repo.Selection.Newest(selected, func(tag string) (time.Time, error) {
+		return GetCreated(ctx, auth, name+":"+tag)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	tags := make([]string, 0, len(repo.Tags)+len(selected))
+	seen := make(map[string]bool)
+	for _, list := range [][]string{repo.Tags, selected} {
+		for _, tag := range list {
+			if !seen[tag] {
+				seen[tag] = true
+				tags = append(tags, tag)
+			}
+		}
+	}
+
+	return tags, nil
+}
+
+// Copy copies the image from the upstream registry using the source credentials to
+// the destination registry.  Only the instances of multi-arch images matching the
+// platform selection are copied.
+func Copy(ctx context.Context, auth *runtime.AuthConfig, dest *Destination, name string, platforms stvziov1.PlatformSelection) error {
 	log := log.FromContext(ctx)
 
+	src := "docker://" + name
 	sref, err := alltransports.ParseImageName(src)
 	if err != nil {
 		log.Error(err, "failed to parse source image name", "name", src)
 		return err
 	}
 
-	dref, err := alltransports.ParseImageName(dest)
+	dst := dest.Reference(name)
+	dref, err := alltransports.ParseImageName(dst)
 	if err != nil {
-		log.Error(err, "failed to parse dest image name", "name", dest)
+		log.Error(err, "failed to parse dest image name", "name", dst)
 		return err
 	}
 
@@ -65,21 +366,87 @@ func Copy(ctx context.Context, auth *runtime.AuthConfig, src string, dest string
 		return err
 	}
 
-	sctx := SystemContext(auth, true)
-	dctx := SystemContext(auth, false)
-
-	_, err = copy.Image(ctx, pctx, dref, sref, &copy.Options{
-		RemoveSignatures:   true,
-		ReportWriter:       io.Discard,
-		ImageListSelection: copy.CopySystemImage,
-		SourceCtx:          sctx,
-		DestinationCtx:     dctx,
+	opts := &copy.Options{
+		RemoveSignatures: true,
+		ReportWriter:     io.Discard,
+		// Copy every image in a manifest list so the mirrored digest matches the
+		// upstream digest.
+		ImageListSelection: copy.CopyAllImages,
+		SourceCtx:          SystemContext(auth, true),
+		DestinationCtx:     dest.SystemContext(),
 		PreserveDigests:    true,
-	})
+	}
 
+	switch platforms.Mode { //nolint:exhaustive
+	case stvziov1.PlatformModeSystem:
+		opts.ImageListSelection = copy.CopySystemImage
+	case stvziov1.PlatformModeList:
+		return copyPlatforms(ctx, pctx, dest, name, sref, dref, opts, platforms.List)
+	}
+
+	_, err = copy.Image(ctx, pctx, dref, sref, opts)
 	return err
 }
 
+// copyPlatforms copies the instances matching the platforms by digest and then pushes
+// a manifest list containing only those instances.  The registry will reject a list
+// that references instances it doesn't have, so the list can't be copied as is.
+func copyPlatforms(ctx context.Context, pctx *signature.PolicyContext, dest *Destination, name string, sref, dref types.ImageReference, opts *copy.Options, platforms []stvziov1.Platform) error { //nolint:lll
+	raw, mime, err := getManifest(ctx, opts.SourceCtx, sref)
+	if err != nil {
+		return err
+	}
+
+	if !manifest.MIMETypeIsMultiImage(mime) {
+		_, err = copy.Image(ctx, pctx, dref, sref, opts)
+		return err
+	}
+
+	filtered, digests, err := FilterList(raw, platforms)
+	if err != nil {
+		return err
+	}
+
+	if bytes.Equal(filtered, raw) {
+		_, err = copy.Image(ctx, pctx, dref, sref, opts)
+		return err
+	}
+
+	named, err := reference.ParseNormalizedNamed(name)
+	if err != nil {
+		return err
+	}
+	repo := reference.TrimNamed(named).String()
+
+	for _, d := range digests {
+		isrc, err := alltransports.ParseImageName("docker://" + repo + "@" + d)
+		if err != nil {
+			return err
+		}
+
+		idst, err := alltransports.ParseImageName(dest.Reference(repo + "@" + d))
+		if err != nil {
+			return err
+		}
+
+		if _, err := copy.Image(ctx, pctx, idst, isrc, opts); err != nil {
+			return err
+		}
+	}
+
+	ld, err := dref.NewImageDestination(ctx, opts.DestinationCtx)
+	if err != nil {
+		return err
+	}
+	defer ld.Close()
+
+	if err := ld.PutManifest(ctx, filtered, nil); err != nil {
+		return err
+	}
+
+	return ld.Commit(ctx, nil)
+}
+
 func SystemContext(auth *runtime.AuthConfig, tlsVerify bool) *types.SystemContext {
 	if auth == nil {
 		auth = &runtime.AuthConfig{}
@@ -0,0 +1,217 @@
+// Copyright 2024 Coral Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mirror
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/containers/image/v5/types"
+	corev1 "k8s.io/api/core/v1"
+	runtime "k8s.io/cri-api/pkg/apis/runtime/v1"
+	"k8s.io/kubernetes/pkg/credentialprovider"
+	"k8s.io/kubernetes/pkg/credentialprovider/secrets"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	stvziov1 "stvz.io/coral/pkg/apis/stvz.io/v1"
+)
+
+// CertDir is the directory where the registry certificates are written so they can be
+// used by the containers image library.
+var CertDir = filepath.Join(os.TempDir(), "coral", "certs")
+
+// Destination is the local registry along with the credentials and certificates used
+// to connect to it.
+type Destination struct {
+	Registry stvziov1.RegistrySpec
+	// Auth is the credentials for the registry.  Requests are anonymous when nil.
+	Auth *runtime.AuthConfig
+	// CertPath is a directory containing the CA bundle and client certificates in the
+	// layout expected by the containers image library.
+	CertPath string
+}
+
+// NewDestination returns a destination for the registry without credentials or
+// certificates.
+func NewDestination(registry stvziov1.RegistrySpec) *Destination {
+	return &Destination{
+		Registry: registry,
+	}
+}
+
+// SystemContext returns the system context used for requests to the registry.
+func (d *Destination) SystemContext() *types.SystemContext {
+	sys := SystemContext(d.Auth, d.Registry.VerifyTLS())
+	sys.DockerCertPath = d.CertPath
+	return sys
+}
+
+// Reference returns the transport reference for the image in the registry.
+func (d *Destination) Reference(name string) string {
+	return d.Registry.URL() + "/" + name
+}
+
+// LoadDestination loads the credentials and certificates referenced by the registry
+// from the namespace.
+func LoadDestination(ctx context.Context, c client.Client, namespace string, registry stvziov1.RegistrySpec) (*Destination, error) {
+	dest := NewDestination(registry)
+
+	if ref := registry.CredentialsSecret; ref != nil {
+		auth, err := loadCredentials(ctx, c, client.ObjectKey{Namespace: namespace, Name: ref.Name}, registry.Address())
+		if err != nil {
+			return nil, err
+		}
+		dest.Auth = auth
+	}
+
+	files := make(map[string][]byte)
+	if registry.CA != nil {
+		ca, err := loadCABundle(ctx, c, namespace, registry.CA)
+		if err != nil {
+			return nil, err
+		}
+		files["ca.crt"] = ca
+	}
+
+	if ref := registry.ClientCertSecret; ref != nil {
+		secret := &corev1.Secret{}
+		if err := c.Get(ctx, client.ObjectKey{Namespace: namespace, Name: ref.Name}, secret); err != nil {
+			return nil, err
+		}
+
+		cert, key := secret.Data[corev1.TLSCertKey], secret.Data[corev1.TLSPrivateKeyKey]
+		if len(cert) == 0 || len(key) == 0 {
+			return nil, fmt.Errorf("secret %s/%s is missing the %s or %s key", namespace, ref.Name, corev1.TLSCertKey, corev1.TLSPrivateKeyKey)
+		}
+		files["client.cert"] = cert
+		files["client.key"] = key
+	}
+
+	if len(files) > 0 {
+		path, err := writeCerts(files)
+		if err != nil {
+			return nil, err
+		}
+		dest.CertPath = path
+	}
+
+	return dest, nil
+}
+
+// loadCredentials supports both basic auth secrets and docker config secrets.
+func loadCredentials(ctx context.Context, c client.Client, key client.ObjectKey, address string) (*runtime.AuthConfig, error) {
+	secret := &corev1.Secret{}
+	if err := c.Get(ctx, key, secret); err != nil {
+		return nil, err
+	}
+
+	if username, ok := secret.Data[corev1.BasicAuthUsernameKey]; ok {
+		return &runtime.AuthConfig{
+			Username: string(username),
+			Password: string(secret.Data[corev1.BasicAuthPasswordKey]),
+		}, nil
+	}
+
+	keyring, err := secrets.MakeDockerKeyring([]corev1.Secret{*secret}, credentialprovider.NewDockerKeyring())
+	if err != nil {
+		return nil, err
+	}
+
+	auths, found := keyring.Lookup(address)
+	if !found || len(auths) == 0 {
+		return nil, fmt.Errorf("secret %s does not contain credentials for %s", key, address)
+	}
+
+	return &runtime.AuthConfig{
+		Username:      auths[0].Username,
+		Password:      auths[0].Password,
+		IdentityToken: auths[0].IdentityToken,
+		RegistryToken: auths[0].RegistryToken,
+	}, nil
+}
+
+func loadCABundle(ctx context.Context, c client.Client, namespace string, ca *stvziov1.CABundleSource) ([]byte, error) {
+	switch {
+	case ca.ConfigMapKeyRef != nil:
+		ref := ca.ConfigMapKeyRef
+		cm := &corev1.ConfigMap{}
+		if err := c.Get(ctx, client.ObjectKey{Namespace: namespace, Name: ref.Name}, cm); err != nil {
+			return nil, err
+		}
+		if data, ok := cm.Data[ref.Key]; ok {
+			return []byte(data), nil
+		}
+		if data, ok := cm.BinaryData[ref.Key]; ok {
+			return data, nil
+		}
+		return nil, fmt.Errorf("config map %s/%s is missing the %s key", namespace, ref.Name, ref.Key)
+	case ca.SecretKeyRef != nil:
+		ref := ca.SecretKeyRef
+		secret := &corev1.Secret{}
+		if err := c.Get(ctx, client.ObjectKey{Namespace: namespace, Name: ref.Name}, secret); err != nil {
+			return nil, err
+		}
+		if data, ok := secret.Data[ref.Key]; ok {
+			return data, nil
+		}
+		return nil, fmt.Errorf("secret %s/%s is missing the %s key", namespace, ref.Name, ref.Key)
+	}
+
+	return nil, fmt.Errorf("no CA bundle source specified")
+}
+
+// writeCerts writes the files to a directory named after their content so concurrent
+// copies never see a partially written directory and unchanged certificates are only
+// written once.
+func writeCerts(files map[string][]byte) (string, error) {
+	hasher := sha256.New()
+	for _, name := range []string{"ca.crt", "client.cert", "client.key"} {
+		fmt.Fprintf(hasher, "%s:%x;", name, files[name])
+	}
+
+	path := filepath.Join(CertDir, fmt.Sprintf("%x", hasher.Sum(nil))[:16])
+	if _, err := os.Stat(path); err == nil {
+		return path, nil
+	}
+
+	if err := os.MkdirAll(CertDir, 0o700); err != nil {
+		return "", err
+	}
+
+	tmp, err := os.MkdirTemp(CertDir, ".tmp-")
+	if err != nil {
+		return "", err
+	}
+
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(tmp, name), data, 0o600); err != nil {
+			_ = os.RemoveAll(tmp)
+			return "", err
+		}
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		_ = os.RemoveAll(tmp)
+		// Another writer may have won the race.
+		if _, serr := os.Stat(path); serr == nil {
+			return path, nil
+		}
+		return "", err
+	}
+
+	return path, nil
+}
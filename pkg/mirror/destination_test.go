@@ -0,0 +1,115 @@
+// Copyright 2024 Coral Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mirror
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	"github.com/containers/image/v5/types"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	stvziov1 "stvz.io/coral/pkg/apis/stvz.io/v1"
+	"stvz.io/coral/pkg/mock"
+)
+
+var _ = Describe("LoadDestination", func() {
+	ctx := context.Background()
+
+	BeforeEach(func() {
+		CertDir = GinkgoT().TempDir()
+	})
+
+	It("should load the credentials and certificates for the registry", func() {
+		c := mock.NewClient()
+		Expect(c.Create(ctx, &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "registry-creds", Namespace: "coral"},
+			Type:       corev1.SecretTypeBasicAuth,
+			Data: map[string][]byte{
+				corev1.BasicAuthUsernameKey: []byte("mirror"),
+				corev1.BasicAuthPasswordKey: []byte("secret"),
+			},
+		})).To(Succeed())
+		Expect(c.Create(ctx, &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "registry-ca", Namespace: "coral"},
+			Data:       map[string]string{"ca.crt": "ca"},
+		})).To(Succeed())
+		Expect(c.Create(ctx, &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "registry-client", Namespace: "coral"},
+			Type:       corev1.SecretTypeTLS,
+			Data: map[string][]byte{
+				corev1.TLSCertKey:       []byte("cert"),
+				corev1.TLSPrivateKeyKey: []byte("key"),
+			},
+		})).To(Succeed())
+
+		registry := stvziov1.RegistrySpec{
+			Host:              "registry.local",
+			Port:              443,
+			TLSVerify:         ptr.To(true),
+			CredentialsSecret: &corev1.LocalObjectReference{Name: "registry-creds"},
+			CA: &stvziov1.CABundleSource{
+				ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{Name: "registry-ca"},
+					Key:                  "ca.crt",
+				},
+			},
+			ClientCertSecret: &corev1.LocalObjectReference{Name: "registry-client"},
+		}
+
+		dest, err := LoadDestination(ctx, c, "coral", registry)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(dest.Auth.Username).To(Equal("mirror"))
+		Expect(dest.Auth.Password).To(Equal("secret"))
+
+		for name, data := range map[string]string{"ca.crt": "ca", "client.cert": "cert", "client.key": "key"} {
+			content, err := os.ReadFile(filepath.Join(dest.CertPath, name))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(content)).To(Equal(data))
+		}
+
+		sys := dest.SystemContext()
+		Expect(sys.DockerCertPath).To(Equal(dest.CertPath))
+		Expect(sys.DockerInsecureSkipTLSVerify).To(Equal(types.OptionalBoolFalse))
+		Expect(sys.DockerAuthConfig.Username).To(Equal("mirror"))
+
+		By("reusing the directory when the certificates have not changed")
+		again, err := LoadDestination(ctx, c, "coral", registry)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(again.CertPath).To(Equal(dest.CertPath))
+	})
+
+	It("should honor a disabled tls verification", func() {
+		dest := NewDestination(stvziov1.RegistrySpec{
+			Host:      "localhost",
+			Port:      5000,
+			TLSVerify: ptr.To(false),
+		})
+		Expect(dest.SystemContext().DockerInsecureSkipTLSVerify).To(Equal(types.OptionalBoolTrue))
+	})
+
+	It("should return an error when the credentials secret is missing", func() {
+		_, err := LoadDestination(ctx, mock.NewClient(), "coral", stvziov1.RegistrySpec{
+			Host:              "registry.local",
+			Port:              443,
+			CredentialsSecret: &corev1.LocalObjectReference{Name: "missing"},
+		})
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,85 @@
+// Copyright 2024 Coral Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mirror
+
+import (
+	"context"
+	"sync"
+
+	"github.com/containers/image/v5/docker/reference"
+)
+
+// RegistryLimiter limits the number of concurrent copies from each upstream registry
+// so a mirror with many workers doesn't trip the registry rate limits.
+type RegistryLimiter struct {
+	max   int
+	slots map[string]chan struct{}
+	sync.Mutex
+}
+
+// NewRegistryLimiter returns a limiter allowing max concurrent copies per registry.
+// When max is less than one, copies are not limited.
+func NewRegistryLimiter(max int) *RegistryLimiter {
+	return &RegistryLimiter{
+		max:   max,
+		slots: make(map[string]chan struct{}),
+	}
+}
+
+func (l *RegistryLimiter) slot(registry string) chan struct{} {
+	l.Lock()
+	defer l.Unlock()
+
+	s, ok := l.slots[registry]
+	if !ok {
+		s = make(chan struct{}, l.max)
+		l.slots[registry] = s
+	}
+
+	return s
+}
+
+// Acquire blocks until a copy from the registry is allowed or the context is done.
+func (l *RegistryLimiter) Acquire(ctx context.Context, registry string) error {
+	if l.max < 1 {
+		return nil
+	}
+
+	select {
+	case l.slot(registry) <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Release frees a copy slot for the registry.
+func (l *RegistryLimiter) Release(registry string) {
+	if l.max < 1 {
+		return
+	}
+
+	<-l.slot(registry)
+}
+
+// RegistryOf returns the registry domain of the image reference.
+func RegistryOf(image string) string {
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return ""
+	}
+
+	return reference.Domain(named)
+}
@@ -0,0 +1,52 @@
+// Copyright 2024 Coral Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mirror
+
+import (
+	stvziov1 "stvz.io/coral/pkg/apis/stvz.io/v1"
+)
+
+// LimitTags returns the newest tags that fit within the tag count and total size
+// limits.  A zero limit is unlimited.  The size function is only called when a size
+// limit is set, and tags where the size can't be determined are skipped.
+func LimitTags(tags []string, maxTags int, maxSize int64, size func(string) (int64, error)) []string {
+	sorted := make([]string, len(tags))
+	copy(sorted, tags)
+	stvziov1.SortNewest(sorted)
+
+	limited := make([]string, 0, len(sorted))
+	var total int64
+	for _, tag := range sorted {
+		if maxTags > 0 && len(limited) >= maxTags {
+			break
+		}
+
+		if maxSize > 0 {
+			n, err := size(tag)
+			if err != nil {
+				continue
+			}
+
+			if total+n > maxSize {
+				break
+			}
+			total += n
+		}
+
+		limited = append(limited, tag)
+	}
+
+	return limited
+}
@@ -0,0 +1,54 @@
+// Copyright 2024 Coral Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mirror
+
+import (
+	"fmt"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("LimitTags", func() {
+	tags := []string{"1.0.0", "latest", "1.2.0", "1.1.0"}
+	sizes := map[string]int64{
+		"1.0.0":  10,
+		"1.1.0":  20,
+		"1.2.0":  30,
+		"latest": 30,
+	}
+	size := func(tag string) (int64, error) {
+		if n, ok := sizes[tag]; ok {
+			return n, nil
+		}
+		return 0, fmt.Errorf("unknown tag: %s", tag)
+	}
+
+	It("should return all of the tags newest first without limits", func() {
+		Expect(LimitTags(tags, 0, 0, nil)).To(Equal([]string{"1.2.0", "1.1.0", "1.0.0", "latest"}))
+	})
+
+	It("should limit the number of tags", func() {
+		Expect(LimitTags(tags, 2, 0, nil)).To(Equal([]string{"1.2.0", "1.1.0"}))
+	})
+
+	It("should stop adding tags once the size limit is reached", func() {
+		Expect(LimitTags(tags, 0, 55, size)).To(Equal([]string{"1.2.0", "1.1.0"}))
+	})
+
+	It("should skip tags when the size can't be determined", func() {
+		Expect(LimitTags([]string{"2.0.0", "1.0.0"}, 0, 100, size)).To(Equal([]string{"1.0.0"}))
+	})
+})
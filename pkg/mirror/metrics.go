@@ -0,0 +1,77 @@
+// Copyright 2024 Coral Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mirror
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var (
+	mirrorError = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "coral_mirror_error",
+			Help: "Errors that occurred while the mirror is running.",
+		},
+		[]string{"error"},
+	)
+
+	mirrorImageError = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "coral_mirror_image_error",
+			Help: "Errors that occurred while the mirror is copying an image.",
+		},
+		[]string{"image", "error"},
+	)
+
+	mirrorCopyDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "coral_mirror_copy_duration_ms",
+			Help:    "The duration of the image copies.",
+			Buckets: prometheus.ExponentialBuckets(100, 2, 12),
+		},
+		[]string{"registry"},
+	)
+
+	mirrorImageCopies = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "coral_mirror_image_copies",
+			Help: "The number of image copies.",
+		},
+	)
+
+	mirrorQueueDepth = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "coral_mirror_queue_depth",
+			Help: "The number of images waiting to be copied.",
+		},
+	)
+
+	mirrorRetries = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "coral_mirror_retries",
+			Help: "The number of failed image copies that have been queued for a retry.",
+		},
+	)
+)
+
+func init() {
+	metrics.Registry.MustRegister(mirrorError)
+	metrics.Registry.MustRegister(mirrorImageError)
+	metrics.Registry.MustRegister(mirrorCopyDuration)
+	metrics.Registry.MustRegister(mirrorImageCopies)
+	metrics.Registry.MustRegister(mirrorQueueDepth)
+	metrics.Registry.MustRegister(mirrorRetries)
+}
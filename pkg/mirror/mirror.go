@@ -2,11 +2,15 @@ package mirror
 
 import (
 	"context"
+	"net"
 	"sync"
 	"time"
 
 	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/labels"
+	runtime "k8s.io/cri-api/pkg/apis/runtime/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 	stvziov1 "stvz.io/coral/pkg/apis/stvz.io/v1"
 	informer "stvz.io/coral/pkg/informer/mirror"
@@ -23,81 +27,176 @@ type Options struct {
 	Scope     string
 	Labels    labels.Selector
 	Informer  *informer.Informer
+	// Workers is the number of images copied in parallel.
+	Workers int
+	// RegistryParallel is the number of images copied in parallel from a single
+	// upstream registry.  Copies are not limited per registry when it's zero.
+	RegistryParallel int
+	// MaxBackoff is the maximum delay between retries of a failed copy.
+	MaxBackoff time.Duration
+	// NotificationsAddr is the address of the registry notification endpoint.  The
+	// endpoint is disabled when it's empty.
+	NotificationsAddr string
+	// NotificationsSecret is the shared secret used to sign the notifications.
+	NotificationsSecret []byte
 }
 
 type Mirror struct {
-	namespace string
-	scope     string
-	labels    labels.Selector
-	name      string
-	informer  *informer.Informer
-	log       logr.Logger
+	namespace        string
+	scope            string
+	labels           labels.Selector
+	name             string
+	informer         *informer.Informer
+	workers          int
+	registryParallel int
+	maxBackoff       time.Duration
+	notifications    *NotificationServer
+	log              logr.Logger
+	// sizes caches the image sizes used to enforce the size limits when all tags
+	// are selected, keyed by the repository and tag.  Sizes are only looked up once
+	// per image and are dropped once the tag or repository is no longer listed.
+	sizes map[string]map[string]int64
 }
 
 func New(opts *Options) *Mirror {
-	return &Mirror{
-		name:      opts.Name,
-		labels:    opts.Labels,
-		scope:     opts.Scope,
-		namespace: opts.Namespace,
-		informer:  opts.Informer,
+	workers := opts.Workers
+	if workers < 1 {
+		workers = 1
 	}
+
+	maxBackoff := opts.MaxBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = DefaultMaxBackoff
+	}
+
+	m := &Mirror{
+		name:             opts.Name,
+		labels:           opts.Labels,
+		scope:            opts.Scope,
+		namespace:        opts.Namespace,
+		informer:         opts.Informer,
+		workers:          workers,
+		registryParallel: opts.RegistryParallel,
+		maxBackoff:       maxBackoff,
+		sizes:            make(map[string]map[string]int64),
+	}
+
+	if opts.NotificationsAddr != "" {
+		m.notifications = &NotificationServer{
+			Addr:   opts.NotificationsAddr,
+			Secret: opts.NotificationsSecret,
+			Peers:  m.peers,
+		}
+	}
+
+	return m
 }
 
 func (m *Mirror) Start(ctx context.Context) error {
 	m.log = log.FromContext(ctx)
 	var wg sync.WaitGroup
-	sem := NewSemaphore()
-	wq := NewWorkQueue()
+	limiter := NewRegistryLimiter(m.registryParallel)
+	wq := NewWorkQueue(DefaultBaseBackoff, m.maxBackoff)
 
-	// TODO: I don't think I actually want workers because we want to be able to use
-	// deployments to scale the mirror.
-	for i := 0; i < 1; i++ {
+	for i := 0; i < m.workers; i++ {
 		wg.Add(1)
-		worker := NewWorker(i, m.informer.Keyring)
+		worker := NewWorker(i, m.informer.Keyring, m.informer.Client)
 		go func(worker *Worker) {
 			defer wg.Done()
-			worker.Start(ctx, wq, sem)
+			worker.Start(ctx, wq, limiter)
 		}(worker)
 	}
 
+	if m.notifications != nil {
+		m.notifications.Notify = func(ctx context.Context, events []PushEvent) {
+			m.notify(ctx, wq, events)
+		}
+		go func() {
+			if err := m.notifications.Start(ctx); err != nil {
+				m.log.Error(err, "notification server failed")
+			}
+		}()
+	}
+
 	ticker := time.NewTicker(30 * time.Second)
 	defer ticker.Stop()
 
 	for {
 		select {
 		case <-ctx.Done():
-			m.log.Info("stopping agent")
-			close(wq)
+			m.log.Info("stopping mirror")
+			wq.Close()
 			wg.Wait()
 			return nil
 		case <-ticker.C:
-			m.process(ctx, wq, sem)
+			m.process(ctx, wq)
 		}
 	}
 }
 
 // TODO: Refactor for simplicity.
-func (m *Mirror) process(ctx context.Context, wq WorkQueue, sem *Semaphore) { //nolint:gocognit
-	for _, mirror := range m.informer.Mirrors {
+func (m *Mirror) process(ctx context.Context, wq *WorkQueue) { //nolint:gocognit
+	// Images that are still missing and belong to this mirror.  Anything else in the
+	// queue is pruned, but only when every repository could be checked so images
+	// waiting on a retry aren't dropped because of a transient error.
+	keep := make(map[string]bool)
+	complete := true
+
+	// Repositories that had all of their tags listed during this pass.  The cached
+	// sizes of any other repository are no longer needed.
+	listed := make(map[string]bool)
+
+	for _, mirror := range m.informer.Mirrors.Items() {
 		log := m.log.WithValues("mirror", mirror.Name)
 
 		registry := mirror.Spec.Registry
+		if registry == nil {
+			log.V(4).Info("skipping mirror without a registry")
+			continue
+		}
+
+		dest, err := LoadDestination(ctx, m.informer.Client, mirror.Namespace, *registry)
+		if err != nil {
+			log.Error(err, "failed to load the registry credentials and certificates")
+			mirrorError.WithLabelValues("load_destination").Inc()
+			complete = false
+			continue
+		}
+
+		// Prefer the repositories resolved by the controller so any tag selections
+		// have been expanded into concrete tags.
+		resolved := make(map[string][]string)
+		for _, r := range mirror.Status.Repositories {
+			resolved[r.Name] = r.Tags
+		}
+
+		repos := mirror.Spec.Repositories.Explicit()
+		for i, spec := range mirror.Spec.Repositories {
+			if tags, ok := resolved[repos[i].Name]; ok {
+				repos[i].Tags = tags
+			} else if spec.ListSelection == stvziov1.ListSelectorAll {
+				// The controller hasn't listed the tags yet.
+				repos[i].Tags = m.listAll(ctx, spec, listed)
+			}
+		}
 
-		for _, repo := range mirror.Spec.Repositories {
-			log := log.WithValues("repo", *repo.Name, "registry", registry) //nolint:govet
+		for i, repo := range repos {
+			log := log.WithValues("repo", repo.Name, "registry", registry.Address()) //nolint:govet
+			platforms := mirror.Spec.PlatformsFor(mirror.Spec.Repositories[i])
 			log.V(8).Info("processing repo")
 
 			// Normalize repo name without tags.
-			nm, err := stvziov1.NormalizeRepoTag(*repo.Name, "")
+			nm, err := stvziov1.NormalizeRepo(repo.Name)
 			if err != nil {
 				log.Error(err, "failed to create explicit repo name")
 				continue
 			}
 
-			tags, err := GetRepositoryTags(ctx, nil, registry.URL(), nm)
+			tags, err := GetRepositoryTags(ctx, dest, nm)
 			if err != nil {
 				log.Error(err, "failed to list tags")
+				mirrorError.WithLabelValues("list_tags").Inc()
+				complete = false
 				continue
 			}
 
@@ -105,23 +204,184 @@ func (m *Mirror) process(ctx context.Context, wq WorkQueue, sem *Semaphore) { //
 			log.V(8).Info("processing tags", "missing", missing, "found", tags)
 
 			for _, tag := range missing {
-				// TODO: We can use the normalized repo name here.
-				normalized, err := stvziov1.NormalizeRepoTag(*repo.Name, tag)
-				if err != nil {
-					log.Error(err, "failed to create explicit tag", "tag", tag)
+				// The repository name has already been normalized without a tag, so the
+				// tag can be appended to it directly.
+				normalized := nm + ":" + tag
+				// TODO: checksum normalized to prevent hotspots in the ring.
+				if !m.informer.ServerRing.Mine(m.name, normalized) {
+					log.V(8).Info("skipping image", "image", normalized)
 					continue
 				}
-				// TODO: checksum normalized to prevent hotspots in the ring.
-				if m.informer.ServerRing.Mine(m.name, normalized) && !sem.Acquired(normalized) {
+
+				keep[normalized] = true
+				queued := wq.Add(&Item{
+					Mirror:      client.ObjectKeyFromObject(mirror),
+					Destination: dest,
+					Image:       normalized,
+					Platforms:   platforms,
+				})
+				if queued {
 					log.V(4).Info("queueing image", "image", normalized)
-					wq <- &Item{
-						Registry: registry.URL(),
-						Image:    normalized,
-					}
 				} else {
-					log.V(8).Info("skipping image", "image", normalized)
+					log.V(8).Info("image is already queued", "image", normalized, "retries", wq.Retries(normalized))
 				}
 			}
 		}
 	}
+
+	if complete {
+		wq.Prune(keep)
+	}
+
+	for repo := range m.sizes {
+		if !listed[repo] {
+			delete(m.sizes, repo)
+		}
+	}
+}
+
+// notify queues the pushed images that are tracked by a mirror and owned by this pod
+// in the hash ring, without waiting for the next sync.
+func (m *Mirror) notify(ctx context.Context, wq *WorkQueue, events []PushEvent) {
+mirrors:
+	for _, mirror := range m.informer.Mirrors.Items() {
+		log := m.log.WithValues("mirror", mirror.Name)
+
+		registry := mirror.Spec.Registry
+		if registry == nil {
+			continue
+		}
+
+		resolved := make(map[string][]string)
+		for _, r := range mirror.Status.Repositories {
+			resolved[r.Name] = r.Tags
+		}
+
+		var dest *Destination
+		repos := mirror.Spec.Repositories.Explicit()
+		for i, spec := range mirror.Spec.Repositories {
+			nm, err := stvziov1.NormalizeRepo(repos[i].Name)
+			if err != nil {
+				continue
+			}
+
+			for _, event := range events {
+				if event.Repository != nm || !TracksTag(spec, resolved[repos[i].Name], event.Tag) {
+					continue
+				}
+
+				image := event.Image()
+				if !m.informer.ServerRing.Mine(m.name, image) {
+					continue
+				}
+
+				if dest == nil {
+					dest, err = LoadDestination(ctx, m.informer.Client, mirror.Namespace, *registry)
+					if err != nil {
+						log.Error(err, "failed to load the registry credentials and certificates")
+						mirrorError.WithLabelValues("load_destination").Inc()
+						// Skip this mirror, the events may still be tracked by the others.
+						continue mirrors
+					}
+				}
+
+				if wq.Add(&Item{
+					Mirror:      client.ObjectKeyFromObject(mirror),
+					Destination: dest,
+					Image:       image,
+					Platforms:   mirror.Spec.PlatformsFor(spec),
+				}) {
+					log.V(4).Info("queueing pushed image", "image", image)
+				}
+			}
+		}
+	}
+}
+
+// peers returns the notification urls of the other mirror pods.
+func (m *Mirror) peers(ctx context.Context) []string {
+	_, port, err := net.SplitHostPort(m.notifications.Addr)
+	if err != nil {
+		m.log.Error(err, "invalid notification address", "addr", m.notifications.Addr)
+		return nil
+	}
+
+	pods := &corev1.PodList{}
+	err = m.informer.Client.List(ctx, pods,
+		client.InNamespace(m.namespace),
+		client.MatchingLabelsSelector{Selector: m.labels},
+	)
+	if err != nil {
+		m.log.Error(err, "failed to list mirror pods")
+		return nil
+	}
+
+	peers := make([]string, 0, len(pods.Items))
+	for _, pod := range pods.Items {
+		if pod.Name == m.name || pod.Status.PodIP == "" {
+			continue
+		}
+		peers = append(peers, "http://"+net.JoinHostPort(pod.Status.PodIP, port)+NotificationsPath)
+	}
+
+	return peers
+}
+
+// listAll lists all of the tags in the source repository limited by the repository
+// tag count and size limits.  Every mirror lists the same tags so the hash ring can
+// split the copies between them.  The normalized repository name is added to listed.
+func (m *Mirror) listAll(ctx context.Context, repo stvziov1.RepositorySpec, listed map[string]bool) []string {
+	log := m.log.WithValues("repo", *repo.Name)
+
+	nm, err := stvziov1.NormalizeRepo(*repo.Name)
+	if err != nil {
+		log.Error(err, "failed to create explicit repo name")
+		return nil
+	}
+	listed[nm] = true
+
+	var auth *runtime.AuthConfig
+	auths, found, err := m.informer.Keyring.Lookup(ctx, nm)
+	if err != nil {
+		log.Error(err, "failed to lookup credentials")
+		return nil
+	}
+	if found && len(auths) > 0 {
+		auth = auths[0]
+	}
+
+	tags, err := ListTags(ctx, auth, nm)
+	if err != nil {
+		log.Error(err, "failed to list source tags")
+		return nil
+	}
+
+	var maxSize int64
+	if repo.MaxSize != nil {
+		maxSize = repo.MaxSize.Value()
+	}
+
+	// Only keep the sizes of the tags that are still in the source repository.
+	sizes := make(map[string]int64)
+	for _, tag := range tags {
+		if size, ok := m.sizes[nm][tag]; ok {
+			sizes[tag] = size
+		}
+	}
+	m.sizes[nm] = sizes
+
+	return LimitTags(tags, repo.MaxTags, maxSize, func(tag string) (int64, error) {
+		if size, ok := sizes[tag]; ok {
+			return size, nil
+		}
+
+		size, err := GetSize(ctx, auth, nm+":"+tag)
+		if err != nil {
+			log.Error(err, "failed to get image size", "tag", tag)
+			return 0, err
+		}
+
+		sizes[tag] = size
+		return size, nil
+	})
 }
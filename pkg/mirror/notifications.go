@@ -0,0 +1,377 @@
+// Copyright 2024 Coral Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mirror
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	stvziov1 "stvz.io/coral/pkg/apis/stvz.io/v1"
+)
+
+const (
+	// NotificationsPath is the path the notifications are accepted on.
+	NotificationsPath = "/notifications"
+	// SignatureHeader holds the hex encoded HMAC-SHA256 of the body, prefixed with
+	// "sha256=".
+	SignatureHeader = "X-Coral-Signature-256"
+	// TokenHeader holds the shared secret for registries that can only be configured
+	// with static headers.
+	TokenHeader = "X-Coral-Token"
+	// ForwardedHeader is set on notifications forwarded to the other mirror pods so
+	// they are not forwarded again.
+	ForwardedHeader = "X-Coral-Forwarded"
+
+	maxNotificationSize = 1024 * 1024
+)
+
+var (
+	ErrUnauthorized        = errors.New("notification is not signed and has no valid token")
+	ErrInvalidNotification = errors.New("unrecognized notification payload")
+)
+
+// PushEvent is a push of a tag to an upstream repository.
+type PushEvent struct {
+	// Repository is the normalized repository name including the registry.
+	Repository string
+	Tag        string
+}
+
+// Image returns the normalized image reference that was pushed.
+func (e PushEvent) Image() string {
+	return e.Repository + ":" + e.Tag
+}
+
+// distributionEnvelope is the notification sent by the Docker Distribution registry.
+type distributionEnvelope struct {
+	Events []struct {
+		Action string `json:"action"`
+		Target struct {
+			Repository string `json:"repository"`
+			Tag        string `json:"tag"`
+			URL        string `json:"url"`
+		} `json:"target"`
+		Request struct {
+			Host string `json:"host"`
+		} `json:"request"`
+	} `json:"events"`
+}
+
+// cloudEvent is a structured CloudEvent as sent by OCI registries such as zot.
+type cloudEvent struct {
+	SpecVersion string `json:"specversion"`
+	Type        string `json:"type"`
+	Source      string `json:"source"`
+	Data        struct {
+		Name       string `json:"name"`
+		Repository string `json:"repository"`
+		Reference  string `json:"reference"`
+		Tag        string `json:"tag"`
+	} `json:"data"`
+}
+
+// ParseNotification returns the tag pushes in a Docker Distribution notification or
+// in one or more OCI registry CloudEvents.  The registry is used as the host of the
+// repositories when it's set, otherwise the host is taken from the event.  Pushes by
+// digest and any other actions are ignored.
+func ParseNotification(body []byte, registry string) ([]PushEvent, error) {
+	body = bytes.TrimSpace(body)
+	if len(body) == 0 {
+		return nil, ErrInvalidNotification
+	}
+
+	var events []PushEvent
+	add := func(host, repo, tag string) {
+		if registry != "" {
+			host = registry
+		}
+		if repo == "" || tag == "" || strings.HasPrefix(tag, "sha256:") {
+			return
+		}
+		if host != "" {
+			repo = host + "/" + repo
+		}
+
+		name, err := stvziov1.NormalizeRepo(repo)
+		if err != nil {
+			return
+		}
+		events = append(events, PushEvent{Repository: name, Tag: tag})
+	}
+
+	if body[0] == '[' {
+		var batch []cloudEvent
+		if err := json.Unmarshal(body, &batch); err != nil {
+			return nil, err
+		}
+		for _, ce := range batch {
+			addCloudEvent(ce, add)
+		}
+		return events, nil
+	}
+
+	var probe map[string]json.RawMessage
+	if err := json.Unmarshal(body, &probe); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case probe["events"] != nil:
+		var envelope distributionEnvelope
+		if err := json.Unmarshal(body, &envelope); err != nil {
+			return nil, err
+		}
+		for _, e := range envelope.Events {
+			if e.Action != "push" {
+				continue
+			}
+			host := e.Request.Host
+			if host == "" {
+				host = hostOf(e.Target.URL)
+			}
+			add(host, e.Target.Repository, e.Target.Tag)
+		}
+	case probe["specversion"] != nil:
+		var ce cloudEvent
+		if err := json.Unmarshal(body, &ce); err != nil {
+			return nil, err
+		}
+		addCloudEvent(ce, add)
+	default:
+		return nil, ErrInvalidNotification
+	}
+
+	return events, nil
+}
+
+func addCloudEvent(ce cloudEvent, add func(host, repo, tag string)) {
+	if strings.Contains(strings.ToLower(ce.Type), "delete") {
+		return
+	}
+
+	repo := ce.Data.Repository
+	if repo == "" {
+		repo = ce.Data.Name
+	}
+	tag := ce.Data.Tag
+	if tag == "" {
+		tag = ce.Data.Reference
+	}
+
+	add(hostOf(ce.Source), repo, tag)
+}
+
+func hostOf(s string) string {
+	u, err := url.Parse(s)
+	if err != nil {
+		return ""
+	}
+	return u.Host
+}
+
+// TracksTag returns true if the tag is mirrored for the repository, either because it
+// has been resolved by the controller, it's listed explicitly or it's matched by the
+// tag selection.
+func TracksTag(repo stvziov1.RepositorySpec, resolved []string, tag string) bool {
+	if tag == "latest" {
+		return false
+	}
+
+	for _, list := range [][]string{resolved, repo.Tags} {
+		for _, t := range list {
+			if t == tag {
+				return true
+			}
+		}
+	}
+
+	if repo.ListSelection == stvziov1.ListSelectorAll {
+		return true
+	}
+
+	if repo.Selection != nil {
+		matched, err := repo.Selection.Filter([]string{tag})
+		return err == nil && len(matched) > 0
+	}
+
+	return false
+}
+
+// Sign returns the signature of the body for the signature header.
+func Sign(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifySignature returns true if the signature matches the body.
+func VerifySignature(secret, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, body)), []byte(signature))
+}
+
+// Authorized returns true if the notification is signed with the secret or carries
+// the secret as a bearer token or in the token header.  Registries such as Docker
+// Distribution and zot can't sign the body, but can send static headers.
+func Authorized(secret, body []byte, header http.Header) bool {
+	if len(secret) == 0 {
+		return false
+	}
+
+	if VerifySignature(secret, body, header.Get(SignatureHeader)) {
+		return true
+	}
+
+	token := header.Get(TokenHeader)
+	if bearer, ok := strings.CutPrefix(header.Get("Authorization"), "Bearer "); ok {
+		token = bearer
+	}
+
+	return token != "" && subtle.ConstantTimeCompare([]byte(token), secret) == 1
+}
+
+// NotificationServer accepts registry notifications and queues a sync of the pushed
+// images.  Since the notifications arrive at a single mirror pod, they are forwarded
+// to the other mirror pods so the pod that owns the image in the hash ring can copy
+// it right away.
+type NotificationServer struct {
+	// Addr is the address the server listens on.
+	Addr string
+	// Secret is the shared secret used to sign or authorize the notifications.
+	Secret []byte
+	// Notify queues the pushed images on this pod.
+	Notify func(ctx context.Context, events []PushEvent)
+	// Peers returns the notification urls of the other mirror pods.
+	Peers func(ctx context.Context) []string
+
+	client *http.Client
+	log    logr.Logger
+}
+
+// Start runs the server until the context is done.
+func (s *NotificationServer) Start(ctx context.Context) error {
+	s.log = log.FromContext(ctx).WithName("notifications")
+	s.client = &http.Client{Timeout: 10 * time.Second}
+
+	mux := http.NewServeMux()
+	mux.Handle(NotificationsPath, s)
+
+	srv := &http.Server{
+		Addr:              s.Addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdown)
+	}()
+
+	s.log.Info("starting notification server", "addr", s.Addr)
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	return nil
+}
+
+func (s *NotificationServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxNotificationSize))
+	if err != nil {
+		http.Error(w, "unable to read body", http.StatusBadRequest)
+		return
+	}
+
+	if !Authorized(s.Secret, body, r.Header) {
+		mirrorError.WithLabelValues("notification_unauthorized").Inc()
+		http.Error(w, ErrUnauthorized.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	events, err := ParseNotification(body, r.URL.Query().Get("registry"))
+	if err != nil {
+		mirrorError.WithLabelValues("notification_payload").Inc()
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if len(events) > 0 {
+		s.log.V(4).Info("received push notification", "events", len(events))
+		if s.Notify != nil {
+			s.Notify(r.Context(), events)
+		}
+		if r.Header.Get(ForwardedHeader) == "" {
+			s.forward(r.Context(), r.URL.RawQuery, body)
+		}
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// forward sends the notification to the other mirror pods.  Failures are logged, the
+// images will still be picked up by the periodic sync.
+func (s *NotificationServer) forward(ctx context.Context, query string, body []byte) {
+	if s.Peers == nil {
+		return
+	}
+
+	client := s.client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	for _, peer := range s.Peers(ctx) {
+		u := peer
+		if query != "" {
+			u += "?" + query
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(body))
+		if err != nil {
+			s.log.Error(err, "unable to create forward request", "peer", peer)
+			continue
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(SignatureHeader, Sign(s.Secret, body))
+		req.Header.Set(ForwardedHeader, "true")
+
+		resp, err := client.Do(req)
+		if err != nil {
+			mirrorError.WithLabelValues("notification_forward").Inc()
+			s.log.Error(err, "unable to forward notification", "peer", peer)
+			continue
+		}
+		resp.Body.Close()
+	}
+}
@@ -0,0 +1,239 @@
+// Copyright 2024 Coral Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mirror
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/distribution/reference"
+	dist "github.com/docker/distribution"
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/docker/distribution/notifications"
+	v2 "github.com/docker/distribution/registry/api/v2"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	stvziov1 "stvz.io/coral/pkg/apis/stvz.io/v1"
+)
+
+var _ = Describe("Notifications", func() {
+	distribution := []byte(`{
+  "events": [
+    {
+      "action": "push",
+      "target": {
+        "mediaType": "application/vnd.docker.distribution.manifest.v2+json",
+        "repository": "library/alpine",
+        "url": "http://registry.local:5000/v2/library/alpine/manifests/sha256:abc",
+        "tag": "3.20"
+      },
+      "request": {"host": "registry.local:5000"}
+    },
+    {
+      "action": "push",
+      "target": {"repository": "library/alpine", "digest": "sha256:def"},
+      "request": {"host": "registry.local:5000"}
+    },
+    {
+      "action": "pull",
+      "target": {"repository": "library/busybox", "tag": "1.36"},
+      "request": {"host": "registry.local:5000"}
+    }
+  ]
+}`)
+
+	cloudEvent := []byte(`{
+  "specversion": "1.0",
+  "type": "zotregistry.image.updated",
+  "source": "https://ghcr.io",
+  "data": {"name": "stvz/coral", "reference": "1.2.0", "digest": "sha256:abc"}
+}`)
+
+	It("should parse the pushed tags from a distribution notification", func() {
+		events, err := ParseNotification(distribution, "")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(events).To(Equal([]PushEvent{
+			{Repository: "registry.local:5000/library/alpine", Tag: "3.20"},
+		}))
+	})
+
+	It("should use the registry from the endpoint when it's set", func() {
+		events, err := ParseNotification(distribution, "docker.io")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(events).To(HaveLen(1))
+		Expect(events[0].Image()).To(Equal("docker.io/library/alpine:3.20"))
+	})
+
+	It("should parse the pushed tags from an oci registry cloud event", func() {
+		events, err := ParseNotification(cloudEvent, "")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(events).To(Equal([]PushEvent{
+			{Repository: "ghcr.io/stvz/coral", Tag: "1.2.0"},
+		}))
+	})
+
+	It("should reject unrecognized payloads", func() {
+		_, err := ParseNotification([]byte(`{"hello": "world"}`), "")
+		Expect(err).To(MatchError(ErrInvalidNotification))
+	})
+
+	It("should verify the signature", func() {
+		secret := []byte("secret")
+		Expect(VerifySignature(secret, distribution, Sign(secret, distribution))).To(BeTrue())
+		Expect(VerifySignature(secret, distribution, Sign([]byte("other"), distribution))).To(BeFalse())
+		Expect(VerifySignature(secret, distribution, "")).To(BeFalse())
+	})
+
+	It("should accept the secret as a bearer token or in the token header", func() {
+		secret := []byte("secret")
+		Expect(Authorized(secret, distribution, http.Header{"Authorization": {"Bearer secret"}})).To(BeTrue())
+		Expect(Authorized(secret, distribution, http.Header{TokenHeader: {"secret"}})).To(BeTrue())
+		Expect(Authorized(secret, distribution, http.Header{"Authorization": {"Bearer other"}})).To(BeFalse())
+		Expect(Authorized(secret, distribution, http.Header{"Authorization": {"Basic secret"}})).To(BeFalse())
+		Expect(Authorized(secret, distribution, http.Header{TokenHeader: {"other"}})).To(BeFalse())
+		Expect(Authorized(nil, distribution, http.Header{TokenHeader: {""}})).To(BeFalse())
+	})
+
+	It("should match the tracked tags", func() {
+		name := "alpine"
+		repo := stvziov1.RepositorySpec{Name: &name, Tags: []string{"3.19"}}
+		Expect(TracksTag(repo, nil, "3.19")).To(BeTrue())
+		Expect(TracksTag(repo, []string{"3.20"}, "3.20")).To(BeTrue())
+		Expect(TracksTag(repo, nil, "3.20")).To(BeFalse())
+
+		repo.ListSelection = stvziov1.ListSelectorAll
+		Expect(TracksTag(repo, nil, "3.20")).To(BeTrue())
+		Expect(TracksTag(repo, nil, "latest")).To(BeFalse())
+	})
+
+	Context("NotificationServer", func() {
+		secret := []byte("secret")
+
+		post := func(handler http.Handler, body []byte, signature string, forwarded bool) int {
+			req := httptest.NewRequest(http.MethodPost, NotificationsPath+"?registry=docker.io", bytes.NewReader(body))
+			req.Header.Set(SignatureHeader, signature)
+			if forwarded {
+				req.Header.Set(ForwardedHeader, "true")
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			return rec.Code
+		}
+
+		It("should reject notifications without a valid signature", func() {
+			notified := false
+			server := &NotificationServer{
+				Secret: secret,
+				Notify: func(_ context.Context, _ []PushEvent) { notified = true },
+			}
+
+			Expect(post(server, distribution, Sign([]byte("other"), distribution), false)).To(Equal(http.StatusUnauthorized))
+			Expect(notified).To(BeFalse())
+		})
+
+		It("should queue the pushed images and forward them to the peers", func() {
+			forwarded := make(chan *http.Request, 1)
+			peer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				forwarded <- r
+				w.WriteHeader(http.StatusAccepted)
+			}))
+			DeferCleanup(peer.Close)
+
+			var events []PushEvent
+			server := &NotificationServer{
+				Secret: secret,
+				Notify: func(_ context.Context, e []PushEvent) { events = e },
+				Peers: func(_ context.Context) []string {
+					return []string{peer.URL + NotificationsPath}
+				},
+			}
+
+			Expect(post(server, distribution, Sign(secret, distribution), false)).To(Equal(http.StatusAccepted))
+			Expect(events).To(HaveLen(1))
+			Expect(events[0].Image()).To(Equal("docker.io/library/alpine:3.20"))
+
+			var r *http.Request
+			Eventually(forwarded).Should(Receive(&r))
+			Expect(r.Header.Get(ForwardedHeader)).To(Equal("true"))
+			Expect(r.URL.Query().Get("registry")).To(Equal("docker.io"))
+		})
+
+		It("should accept notifications sent by a distribution registry", func() {
+			events := make(chan []PushEvent, 1)
+			server := httptest.NewServer(&NotificationServer{
+				Secret: secret,
+				Notify: func(_ context.Context, e []PushEvent) { events <- e },
+			})
+			DeferCleanup(server.Close)
+
+			By("configuring the endpoint the same way as the registry notifications")
+			endpoint := notifications.NewEndpoint("coral", server.URL+NotificationsPath+"?registry=docker.io", notifications.EndpointConfig{
+				Headers:   http.Header{"Authorization": {"Bearer " + string(secret)}},
+				Timeout:   5 * time.Second,
+				Threshold: 1,
+				Backoff:   time.Second,
+			})
+			DeferCleanup(endpoint.Close)
+
+			ub, err := v2.NewURLBuilderFromString("http://registry.local:5000", false)
+			Expect(err).ToNot(HaveOccurred())
+			bridge := notifications.NewBridge(ub,
+				notifications.SourceRecord{Addr: "registry.local:5000"},
+				notifications.ActorRecord{},
+				notifications.RequestRecord{Host: "registry.local:5000", Method: http.MethodPut},
+				endpoint, false)
+
+			By("pushing a manifest")
+			manifest, err := schema2.FromStruct(schema2.Manifest{
+				Versioned: schema2.SchemaVersion,
+				Config: dist.Descriptor{
+					MediaType: schema2.MediaTypeImageConfig,
+					Digest:    "sha256:6e1f4b2e8f9f5fbd0fe0c8ea9cc1e1b1cf6b73b3b8fd1ebd0f6f2ce6b0b7f3a1",
+					Size:      1472,
+				},
+			})
+			Expect(err).ToNot(HaveOccurred())
+			repo, err := reference.WithName("library/alpine")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(bridge.ManifestPushed(repo, manifest, dist.WithTag("3.20"))).To(Succeed())
+
+			var received []PushEvent
+			Eventually(events).Should(Receive(&received))
+			Expect(received).To(HaveLen(1))
+			Expect(received[0].Image()).To(Equal("docker.io/library/alpine:3.20"))
+
+			Eventually(func() map[string]int {
+				var metrics notifications.EndpointMetrics
+				endpoint.ReadMetrics(&metrics)
+				return metrics.Statuses
+			}).Should(HaveKeyWithValue("202 Accepted", 1))
+		})
+
+		It("should not forward notifications that were already forwarded", func() {
+			server := &NotificationServer{
+				Secret: secret,
+				Peers: func(_ context.Context) []string {
+					Fail("notification should not be forwarded")
+					return nil
+				},
+			}
+
+			Expect(post(server, distribution, Sign(secret, distribution), true)).To(Equal(http.StatusAccepted))
+		})
+	})
+})
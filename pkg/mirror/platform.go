@@ -0,0 +1,140 @@
+// Copyright 2024 Coral Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mirror
+
+import (
+	"encoding/json"
+	"errors"
+
+	stvziov1 "stvz.io/coral/pkg/apis/stvz.io/v1"
+)
+
+// ErrNoMatchingPlatforms is returned when none of the instances in a manifest list
+// match the selected platforms.
+var ErrNoMatchingPlatforms = errors.New("no instances match the selected platforms")
+
+// listInstance is the part of a docker manifest list or oci index entry used to
+// select instances.  Both formats share the same layout for these fields.
+type listInstance struct {
+	Digest   string `json:"digest"`
+	Platform *struct {
+		OS           string `json:"os"`
+		Architecture string `json:"architecture"`
+		Variant      string `json:"variant,omitempty"`
+	} `json:"platform,omitempty"`
+}
+
+func (i listInstance) String() string {
+	if i.Platform == nil {
+		return ""
+	}
+
+	return stvziov1.Platform{
+		OS:           i.Platform.OS,
+		Architecture: i.Platform.Architecture,
+		Variant:      i.Platform.Variant,
+	}.String()
+}
+
+func (i listInstance) matches(platforms []stvziov1.Platform) bool {
+	if i.Platform == nil {
+		return false
+	}
+
+	for _, p := range platforms {
+		if p.Matches(i.Platform.OS, i.Platform.Architecture, i.Platform.Variant) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func parseList(blob []byte) (map[string]json.RawMessage, []json.RawMessage, []listInstance, error) {
+	var list map[string]json.RawMessage
+	if err := json.Unmarshal(blob, &list); err != nil {
+		return nil, nil, nil, err
+	}
+
+	var raw []json.RawMessage
+	if err := json.Unmarshal(list["manifests"], &raw); err != nil {
+		return nil, nil, nil, err
+	}
+
+	instances := make([]listInstance, len(raw))
+	for i, r := range raw {
+		if err := json.Unmarshal(r, &instances[i]); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	return list, raw, instances, nil
+}
+
+// ListPlatforms returns the platforms of the instances in a manifest list.  Instances
+// without a platform, such as attestations, are skipped.
+func ListPlatforms(blob []byte) ([]string, error) {
+	_, _, instances, err := parseList(blob)
+	if err != nil {
+		return nil, err
+	}
+
+	platforms := make([]string, 0, len(instances))
+	for _, i := range instances {
+		if p := i.String(); p != "" && p != "unknown/unknown" {
+			platforms = append(platforms, p)
+		}
+	}
+
+	return platforms, nil
+}
+
+// FilterList returns the manifest list with only the instances matching the platforms
+// along with the digests of the matched instances.  When every instance matches, the
+// original list is returned so the digest is preserved.
+func FilterList(blob []byte, platforms []stvziov1.Platform) ([]byte, []string, error) {
+	list, raw, instances, err := parseList(blob)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	filtered := make([]json.RawMessage, 0, len(raw))
+	digests := make([]string, 0, len(raw))
+	for i, instance := range instances {
+		if instance.matches(platforms) {
+			filtered = append(filtered, raw[i])
+			digests = append(digests, instance.Digest)
+		}
+	}
+
+	switch len(filtered) {
+	case 0:
+		return nil, nil, ErrNoMatchingPlatforms
+	case len(raw):
+		return blob, digests, nil
+	}
+
+	list["manifests"], err = json.Marshal(filtered)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	out, err := json.Marshal(list)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return out, digests, nil
+}
@@ -0,0 +1,75 @@
+// Copyright 2024 Coral Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mirror
+
+import (
+	"encoding/json"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	stvziov1 "stvz.io/coral/pkg/apis/stvz.io/v1"
+)
+
+var _ = Describe("Platforms", func() {
+	index := []byte(`{
+  "schemaVersion": 2,
+  "mediaType": "application/vnd.oci.image.index.v1+json",
+  "manifests": [
+    {"mediaType": "application/vnd.oci.image.manifest.v1+json", "digest": "sha256:amd64", "size": 1, "platform": {"os": "linux", "architecture": "amd64"}},
+    {"mediaType": "application/vnd.oci.image.manifest.v1+json", "digest": "sha256:arm64", "size": 1, "platform": {"os": "linux", "architecture": "arm64", "variant": "v8"}},
+    {"mediaType": "application/vnd.oci.image.manifest.v1+json", "digest": "sha256:attestation", "size": 1, "platform": {"os": "unknown", "architecture": "unknown"}}
+  ]
+}`)
+
+	It("should list the platforms in the index", func() {
+		platforms, err := ListPlatforms(index)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(platforms).To(Equal([]string{"linux/amd64", "linux/arm64/v8"}))
+	})
+
+	It("should filter the index to the selected platforms", func() {
+		filtered, digests, err := FilterList(index, []stvziov1.Platform{
+			{OS: "linux", Architecture: "arm64"},
+		})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(digests).To(Equal([]string{"sha256:arm64"}))
+
+		var list struct {
+			MediaType string            `json:"mediaType"`
+			Manifests []json.RawMessage `json:"manifests"`
+		}
+		Expect(json.Unmarshal(filtered, &list)).To(Succeed())
+		Expect(list.MediaType).To(Equal("application/vnd.oci.image.index.v1+json"))
+		Expect(list.Manifests).To(HaveLen(1))
+	})
+
+	It("should match the variant only when it's set", func() {
+		_, digests, err := FilterList(index, []stvziov1.Platform{
+			{OS: "linux", Architecture: "arm64", Variant: "v7"},
+		})
+		Expect(err).To(MatchError(ErrNoMatchingPlatforms))
+		Expect(digests).To(BeNil())
+	})
+
+	It("should return the original index when every instance matches", func() {
+		filtered, _, err := FilterList(index, []stvziov1.Platform{
+			{OS: "linux", Architecture: "amd64"},
+			{OS: "linux", Architecture: "arm64"},
+			{OS: "unknown", Architecture: "unknown"},
+		})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(filtered).To(Equal(index))
+	})
+})
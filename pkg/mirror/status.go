@@ -0,0 +1,69 @@
+// Copyright 2024 Coral Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mirror
+
+import (
+	"context"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	stvziov1 "stvz.io/coral/pkg/apis/stvz.io/v1"
+)
+
+// report records the result of a sync in the mirror status.  The controller owns the
+// rest of the status and fills in the digests the next time it reconciles.
+func (w *Worker) report(ctx context.Context, item *Item, syncErr error) error {
+	if w.client == nil || item.Mirror.Name == "" {
+		return nil
+	}
+
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		obj := &stvziov1.Mirror{}
+		if err := w.client.Get(ctx, item.Mirror, obj); err != nil {
+			return client.IgnoreNotFound(err)
+		}
+
+		SetImageResult(&obj.Status, item.Image, syncErr, metav1.Now())
+		return w.client.Status().Update(ctx, obj)
+	})
+}
+
+// SetImageResult updates the status of the image with the result of a sync.
+func SetImageResult(status *stvziov1.MirrorStatus, name string, syncErr error, now metav1.Time) {
+	idx := -1
+	for i := range status.Images {
+		if status.Images[i].Name == name {
+			idx = i
+			break
+		}
+	}
+
+	if idx < 0 {
+		status.Images = append(status.Images, stvziov1.MirrorImageStatus{Name: name})
+		idx = len(status.Images) - 1
+	}
+
+	image := &status.Images[idx]
+	if syncErr != nil {
+		image.State = stvziov1.MirrorImageStateFailed
+		image.LastError = syncErr.Error()
+		return
+	}
+
+	image.State = stvziov1.MirrorImageStateSynced
+	image.LastError = ""
+	image.LastSyncTime = &now
+}
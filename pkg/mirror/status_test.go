@@ -0,0 +1,53 @@
+// Copyright 2024 Coral Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mirror
+
+import (
+	"errors"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	stvziov1 "stvz.io/coral/pkg/apis/stvz.io/v1"
+)
+
+var _ = Describe("SetImageResult", func() {
+	now := metav1.Now()
+
+	It("should add a failed image with the error", func() {
+		status := &stvziov1.MirrorStatus{}
+		SetImageResult(status, "docker.io/library/alpine:3.19", errors.New("unauthorized"), now)
+		Expect(status.Images).To(HaveLen(1))
+		Expect(status.Images[0].State).To(Equal(stvziov1.MirrorImageStateFailed))
+		Expect(status.Images[0].LastError).To(Equal("unauthorized"))
+	})
+
+	It("should mark an existing image as synced and clear the error", func() {
+		status := &stvziov1.MirrorStatus{
+			Images: []stvziov1.MirrorImageStatus{
+				{
+					Name:      "docker.io/library/alpine:3.19",
+					State:     stvziov1.MirrorImageStateFailed,
+					LastError: "unauthorized",
+				},
+			},
+		}
+		SetImageResult(status, "docker.io/library/alpine:3.19", nil, now)
+		Expect(status.Images).To(HaveLen(1))
+		Expect(status.Images[0].State).To(Equal(stvziov1.MirrorImageStateSynced))
+		Expect(status.Images[0].LastError).To(BeEmpty())
+		Expect(status.Images[0].LastSyncTime).To(Equal(&now))
+	})
+})
@@ -15,21 +15,140 @@
 package mirror
 
 import (
+	"sync"
+	"time"
+
+	"k8s.io/client-go/util/workqueue"
 	runtime "k8s.io/cri-api/pkg/apis/runtime/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	stvziov1 "stvz.io/coral/pkg/apis/stvz.io/v1"
+)
+
+const (
+	// DefaultBaseBackoff is the delay before the first retry of a failed copy.
+	DefaultBaseBackoff time.Duration = 5 * time.Second
+	// DefaultMaxBackoff is the maximum delay between retries of a failed copy.
+	DefaultMaxBackoff time.Duration = 10 * time.Minute
 )
 
 type Item struct {
-	Image    string
-	Registry string
-	Auth     []*runtime.AuthConfig
+	// Mirror is the mirror resource the image belongs to.
+	Mirror client.ObjectKey
+	Image  string
+	// Destination is the local registry the image is copied to.
+	Destination *Destination
+	// Platforms selects the instances copied from multi-arch images.
+	Platforms stvziov1.PlatformSelection
+	Auth      []*runtime.AuthConfig
+}
+
+// WorkQueue is a rate limited queue of images to copy.  Images are keyed by name so
+// an image is only queued once and is never processed by more than one worker at a
+// time.  Failed copies are retried with a per image exponential backoff until they
+// succeed or the image is pruned.
+type WorkQueue struct {
+	queue workqueue.RateLimitingInterface
+	items map[string]*Item
+	sync.Mutex
+}
+
+func NewWorkQueue(base, max time.Duration) *WorkQueue {
+	return &WorkQueue{
+		queue: workqueue.NewRateLimitingQueueWithConfig(
+			workqueue.NewItemExponentialFailureRateLimiter(base, max),
+			workqueue.RateLimitingQueueConfig{Name: "mirror_copy"},
+		),
+		items: make(map[string]*Item),
+	}
+}
+
+// Add queues the item.  If the image is already queued or is waiting to be retried,
+// the item is updated in place and false is returned so the retry isn't cut short.
+func (wq *WorkQueue) Add(item *Item) bool {
+	wq.Lock()
+	defer wq.Unlock()
+
+	_, exists := wq.items[item.Image]
+	wq.items[item.Image] = item
+	if exists || wq.queue.NumRequeues(item.Image) > 0 {
+		return false
+	}
+
+	wq.queue.Add(item.Image)
+	mirrorQueueDepth.Set(float64(wq.queue.Len()))
+	return true
+}
+
+// Get blocks until an item is ready to be processed.  It returns false when the
+// queue has been shut down.  Done must be called for every item returned.
+func (wq *WorkQueue) Get() (*Item, bool) {
+	for {
+		key, shutdown := wq.queue.Get()
+		if shutdown {
+			return nil, false
+		}
+
+		wq.Lock()
+		item, ok := wq.items[key.(string)]
+		mirrorQueueDepth.Set(float64(wq.queue.Len()))
+		wq.Unlock()
+
+		if ok {
+			return item, true
+		}
+
+		// The image was pruned while it was waiting.
+		wq.queue.Forget(key)
+		wq.queue.Done(key)
+	}
+}
+
+// Done marks the item as processed.  On success the image is removed from the queue
+// and it's backoff is reset.  On failure the image is requeued after the backoff.
+func (wq *WorkQueue) Done(item *Item, err error) {
+	wq.Lock()
+	defer wq.Unlock()
+
+	defer wq.queue.Done(item.Image)
+
+	if _, ok := wq.items[item.Image]; ok && err != nil {
+		mirrorRetries.Inc()
+		wq.queue.AddRateLimited(item.Image)
+		return
+	}
+
+	delete(wq.items, item.Image)
+	wq.queue.Forget(item.Image)
+}
+
+// Retries returns the number of times the image has been retried.
+func (wq *WorkQueue) Retries(image string) int {
+	return wq.queue.NumRequeues(image)
+}
+
+// Prune removes any image that isn't in the keep map.  Images that have been
+// removed from the mirrors, or that have been copied by another mirror, stop being
+// retried.
+func (wq *WorkQueue) Prune(keep map[string]bool) {
+	wq.Lock()
+	defer wq.Unlock()
+
+	for image := range wq.items {
+		if !keep[image] {
+			delete(wq.items, image)
+			wq.queue.Forget(image)
+		}
+	}
 }
 
-type WorkQueue chan *Item
+// Len returns the number of images waiting to be processed or retried.
+func (wq *WorkQueue) Len() int {
+	wq.Lock()
+	defer wq.Unlock()
 
-func NewWorkQueue() WorkQueue {
-	return make(chan *Item)
+	return len(wq.items)
 }
 
-func (wq WorkQueue) Close() {
-	close(wq)
+func (wq *WorkQueue) Close() {
+	wq.queue.ShutDown()
 }
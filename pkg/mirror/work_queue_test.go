@@ -0,0 +1,114 @@
+// Copyright 2024 Coral Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mirror
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("WorkQueue", func() {
+	var wq *WorkQueue
+
+	BeforeEach(func() {
+		wq = NewWorkQueue(10*time.Millisecond, 100*time.Millisecond)
+		DeferCleanup(wq.Close)
+	})
+
+	It("should only queue an image once", func() {
+		Expect(wq.Add(&Item{Image: "docker.io/library/alpine:3.19"})).To(BeTrue())
+		Expect(wq.Add(&Item{Image: "docker.io/library/alpine:3.19"})).To(BeFalse())
+		Expect(wq.Len()).To(Equal(1))
+
+		item, ok := wq.Get()
+		Expect(ok).To(BeTrue())
+		Expect(item.Image).To(Equal("docker.io/library/alpine:3.19"))
+
+		wq.Done(item, nil)
+		Expect(wq.Len()).To(Equal(0))
+	})
+
+	It("should retry failed images with a backoff", func() {
+		wq.Add(&Item{Image: "docker.io/library/alpine:3.19"})
+
+		item, _ := wq.Get()
+		wq.Done(item, errors.New("unauthorized"))
+		Expect(wq.Retries(item.Image)).To(Equal(1))
+
+		By("not queueing the image again while it's waiting to be retried")
+		Expect(wq.Add(&Item{Image: "docker.io/library/alpine:3.19"})).To(BeFalse())
+
+		item, ok := wq.Get()
+		Expect(ok).To(BeTrue())
+		Expect(item.Image).To(Equal("docker.io/library/alpine:3.19"))
+
+		By("resetting the backoff once the copy succeeds")
+		wq.Done(item, nil)
+		Expect(wq.Retries(item.Image)).To(Equal(0))
+		Expect(wq.Len()).To(Equal(0))
+	})
+
+	It("should drop images that have been pruned", func() {
+		wq.Add(&Item{Image: "docker.io/library/alpine:3.19"})
+		item, _ := wq.Get()
+		wq.Done(item, errors.New("unauthorized"))
+
+		wq.Prune(map[string]bool{})
+		Expect(wq.Len()).To(Equal(0))
+		Expect(wq.Retries(item.Image)).To(Equal(0))
+
+		wq.Add(&Item{Image: "docker.io/library/busybox:1.36"})
+		item, ok := wq.Get()
+		Expect(ok).To(BeTrue())
+		Expect(item.Image).To(Equal("docker.io/library/busybox:1.36"))
+	})
+
+	It("should stop returning items once closed", func() {
+		wq.Close()
+		_, ok := wq.Get()
+		Expect(ok).To(BeFalse())
+	})
+})
+
+var _ = Describe("RegistryLimiter", func() {
+	It("should limit the concurrent copies per registry", func(ctx SpecContext) {
+		limiter := NewRegistryLimiter(1)
+		Expect(limiter.Acquire(ctx, "docker.io")).To(Succeed())
+		Expect(limiter.Acquire(ctx, "ghcr.io")).To(Succeed())
+
+		By("blocking until the slot is released")
+		short, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+		defer cancel()
+		Expect(limiter.Acquire(short, "docker.io")).To(MatchError(context.DeadlineExceeded))
+
+		limiter.Release("docker.io")
+		Expect(limiter.Acquire(ctx, "docker.io")).To(Succeed())
+	})
+
+	It("should not limit copies when the limit is zero", func(ctx SpecContext) {
+		limiter := NewRegistryLimiter(0)
+		Expect(limiter.Acquire(ctx, "docker.io")).To(Succeed())
+		Expect(limiter.Acquire(ctx, "docker.io")).To(Succeed())
+	})
+
+	It("should return the registry of the image", func() {
+		Expect(RegistryOf("alpine:3.19")).To(Equal("docker.io"))
+		Expect(RegistryOf("ghcr.io/stvz/coral:1.0")).To(Equal("ghcr.io"))
+	})
+})
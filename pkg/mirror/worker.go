@@ -16,8 +16,10 @@ package mirror
 
 import (
 	"context"
+	"time"
 
 	"github.com/go-logr/logr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 	"stvz.io/coral/pkg/credentials"
 )
@@ -26,61 +28,82 @@ type Worker struct {
 	id      int
 	log     logr.Logger
 	keyring *credentials.Keyring
+	client  client.Client
 }
 
-func NewWorker(id int, keyring *credentials.Keyring) *Worker {
+func NewWorker(id int, keyring *credentials.Keyring, c client.Client) *Worker {
 	return &Worker{
 		id:      id,
 		keyring: keyring,
+		client:  c,
 	}
 }
 
-func (w *Worker) Start(ctx context.Context, wq WorkQueue, sem *Semaphore) {
+func (w *Worker) Start(ctx context.Context, wq *WorkQueue, limiter *RegistryLimiter) {
 	w.log = log.FromContext(ctx)
 
 	w.log.V(8).Info("starting worker", "id", w.id)
-	for item := range wq {
-		w.process(ctx, item, sem)
+	for {
+		item, ok := wq.Get()
+		if !ok {
+			return
+		}
+
+		err := w.process(ctx, item, limiter)
+		wq.Done(item, err)
 	}
 }
 
-func (w *Worker) process(ctx context.Context, item *Item, sem *Semaphore) {
-	// Make sure we only have one worker operating on an image at a time.
-	do := sem.Acquire(item.Image)
-	defer sem.Release(item.Image)
-
-	if !do {
-		w.log.V(10).Info("failed to acquire semaphore, skipping", "image", item.Image)
-		return
+func (w *Worker) process(ctx context.Context, item *Item, limiter *RegistryLimiter) error {
+	// Limit the concurrent copies from the upstream registry.
+	registry := RegistryOf(item.Image)
+	if err := limiter.Acquire(ctx, registry); err != nil {
+		return err
 	}
+	defer limiter.Release(registry)
 
 	// Sync the image.
 	w.log.V(4).Info("syncing image", "image", item.Image)
+	start := time.Now()
 	err := w.sync(ctx, item)
+	mirrorCopyDuration.WithLabelValues(registry).Observe(float64(time.Since(start).Milliseconds()))
 	if err != nil {
 		w.log.Error(err, "failed to sync image", "image", item.Image)
+		mirrorImageError.WithLabelValues(item.Image, "copy").Inc()
+	} else {
+		mirrorImageCopies.Inc()
 	}
+
+	if rerr := w.report(ctx, item, err); rerr != nil {
+		w.log.Error(rerr, "failed to report sync status", "image", item.Image)
+		mirrorError.WithLabelValues("report").Inc()
+	}
+
+	return err
 }
 
+// sync copies the image using each of the credentials for the image in turn.  The
+// error from the last attempt is returned if none of them succeed.
 func (w *Worker) sync(ctx context.Context, item *Item) error {
 	auth, found, err := w.keyring.Lookup(ctx, item.Image)
 	if err != nil {
+		mirrorError.WithLabelValues("auth_lookup").Inc()
 		return err
 	}
 
-	if !found {
-		w.log.V(6).Info("attempting to sync image without credentials", "image", item.Image, "registry", item.Registry)
-		return Copy(ctx, nil, item.Registry, item.Image)
+	if !found || len(auth) == 0 {
+		w.log.V(6).Info("attempting to sync image without credentials", "image", item.Image, "registry", item.Destination.Registry.Address())
+		return Copy(ctx, nil, item.Destination, item.Image, item.Platforms)
 	}
 
 	for _, a := range auth {
 		w.log.V(4).Info("attempting to pull image with provided credentials", "image", item.Image, "username", a.Username)
 		// TODO: convert auth.
-		err := Copy(ctx, a, item.Registry, item.Image)
-		if err != nil {
-			continue
+		err = Copy(ctx, a, item.Destination, item.Image, item.Platforms)
+		if err == nil {
+			return nil
 		}
 	}
 
-	return nil
+	return err
 }
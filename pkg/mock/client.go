@@ -48,7 +48,7 @@ func NewClient() *Client {
 	client := fake.NewClientBuilder().
 		WithObjectTracker(tracker).
 		WithScheme(s).
-		WithStatusSubresource(&stvziov1.Image{}).
+		WithStatusSubresource(&stvziov1.Image{}, &stvziov1.ClusterImage{}, &stvziov1.Mirror{}).
 		Build()
 
 	return &Client{
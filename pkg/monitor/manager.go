@@ -99,8 +99,9 @@ func (m *Monitor) Stop() {
 }
 
 // send gets all the images that it knows about and sends them to the work queue.  It
-// supports both namespaced and cluster-scoped images depending on the controller
-// configuration.  The conversion  of the image to a namespaced name is done
+// supports both namespaced and cluster-scoped images.  Namespaced images are limited
+// to the configured namespace while cluster images are always included and are sent
+// without a namespace.  The conversion  of the image to a namespaced name is done
 // intentionally to force the worker to get the image prior to monitoring and
 // updating the status in case we end up blocking for an extended period of time on
 // the channel.
@@ -119,5 +120,17 @@ func (m *Monitor) send(ctx context.Context, ch chan<- types.NamespacedName) erro
 			Name:      image.Name,
 		}
 	}
+
+	clusterImages := &stvziov1.ClusterImageList{}
+	err = m.client.List(ctx, clusterImages)
+	if err != nil {
+		return err
+	}
+
+	for _, image := range clusterImages.Items {
+		ch <- types.NamespacedName{
+			Name: image.Name,
+		}
+	}
 	return nil
 }
@@ -77,6 +77,22 @@ var (
 		[]string{"name", "namespace"},
 	)
 
+	monitorImagesError = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "coral_monitor_images_error",
+			Help: "The number of nodes that have failed to pull the image",
+		},
+		[]string{"name", "namespace"},
+	)
+
+	monitorImagesStale = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "coral_monitor_images_stale",
+			Help: "The number of nodes that have an image that no longer matches the upstream digest",
+		},
+		[]string{"name", "namespace"},
+	)
+
 	monitorImagesUnknown = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
 			Name: "coral_monitor_images_unknown",
@@ -92,6 +108,8 @@ func init() {
 	metrics.Registry.MustRegister(monitorImagesPending)
 	metrics.Registry.MustRegister(monitorImagesAvailable)
 	metrics.Registry.MustRegister(monitorImagesDeleting)
+	metrics.Registry.MustRegister(monitorImagesError)
+	metrics.Registry.MustRegister(monitorImagesStale)
 	metrics.Registry.MustRegister(monitorImagesUnknown)
 	metrics.Registry.MustRegister(monitorImagesTotal)
 	metrics.Registry.MustRegister(monitorNodesTotal)
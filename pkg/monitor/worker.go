@@ -53,7 +53,7 @@ func (m *Worker) Start(ctx context.Context, ch <-chan types.NamespacedName) {
 }
 
 func (m *Worker) run(ctx context.Context, nns types.NamespacedName) {
-	image := new(stvziov1.Image)
+	image := newImageObject(nns)
 	err := m.client.Get(ctx, nns, image)
 	if err != nil {
 		// Ignore if the image is not found.  It's been deleted and we should stop monitoring
@@ -67,7 +67,7 @@ func (m *Worker) run(ctx context.Context, nns types.NamespacedName) {
 
 	// If we don't have any of the image data yet, just return.  The object
 	// hasn't been fully reconciled yet.
-	if len(image.Status.Data) == 0 {
+	if len(image.GetImageStatus().Data) == 0 {
 		return
 	}
 
@@ -87,9 +87,9 @@ func (m *Worker) run(ctx context.Context, nns types.NamespacedName) {
 // getPendingNodes returns the number of nodes that have at least one tag pending.
 // TODO: the and logic doesn't get the correct number of nodes unless they are all
 // pending.  can we use or logic for all the image labels?
-func (m *Worker) updateStates(ctx context.Context, image *stvziov1.Image) (*stvziov1.Image, error) {
+func (m *Worker) updateStates(ctx context.Context, image stvziov1.ImageObject) (stvziov1.ImageObject, error) {
 	s := labels.NewSelector()
-	for _, selector := range image.Spec.Selector {
+	for _, selector := range image.GetSelector() {
 		req, err := labels.NewRequirement(selector.Key, selector.Operator, selector.Values)
 		if err != nil {
 			return nil, err
@@ -115,14 +115,27 @@ func (m *Worker) updateStates(ctx context.Context, image *stvziov1.Image) (*stvz
 		return nil, err
 	}
 
+	// The per-node image state is kept in the node image state resources rather than
+	// on the node labels.
+	states := new(stvziov1.NodeImageStateList)
+	err = m.client.List(ctx, states)
+	if err != nil {
+		return nil, err
+	}
+
+	nodeStates := make(map[string]map[string]string)
+	for _, nis := range states.Items {
+		nodeStates[nis.Name] = nis.StateByLabel()
+	}
+
 	numNodes := len(nodes.Items)
-	monitorNodesTotal.WithLabelValues(image.Name, image.Namespace).Set(float64(numNodes))
+	monitorNodesTotal.WithLabelValues(image.GetName(), image.GetNamespace()).Set(float64(numNodes))
 
 	// Calculate the hashes for the images.
 	keys := make([][]string, 0)
 	total := 0
 
-	for _, data := range image.Status.Data {
+	for _, data := range image.GetImageStatus().Data {
 		keys = append(keys, []string{data.Name, data.Label})
 		total++
 	}
@@ -131,11 +144,14 @@ func (m *Worker) updateStates(ctx context.Context, image *stvziov1.Image) (*stvz
 	state := map[string]int{
 		"pending":   0,
 		"available": 0,
+		"deleting":  0,
+		"error":     0,
+		"stale":     0,
 		"unknown":   0,
 	}
 
 	for _, node := range nodes.Items {
-		labels := node.GetLabels()
+		labels := nodeStates[node.GetName()]
 		for _, key := range keys {
 			if s, ok := labels[key[1]]; ok {
 				state[s]++
@@ -145,25 +161,41 @@ func (m *Worker) updateStates(ctx context.Context, image *stvziov1.Image) (*stvz
 		}
 	}
 
-	img := image.DeepCopy()
+	img := image.DeepCopyObject().(stvziov1.ImageObject)
 
 	condition := stvziov1.ImageCondition{
 		Available: floor(state["available"], numNodes),
 		Pending:   floor(state["pending"], numNodes),
 		Unknown:   floor(state["unknown"], numNodes),
+		Error:     floor(state["error"], numNodes),
+		Stale:     floor(state["stale"], numNodes),
 	}
 
-	img.Status.Condition = condition
-	img.Status.TotalImages = total
-	img.Status.TotalNodes = numNodes
+	status := img.GetImageStatus()
+	status.Condition = condition
+	status.TotalImages = total
+	status.TotalNodes = numNodes
 
-	monitorImagesAvailable.WithLabelValues(image.Name, image.Namespace).Set(float64(state["available"]))
-	monitorImagesPending.WithLabelValues(image.Name, image.Namespace).Set(float64(state["pending"]))
-	monitorImagesUnknown.WithLabelValues(image.Name, image.Namespace).Set(float64(state["unknown"]))
+	monitorImagesAvailable.WithLabelValues(image.GetName(), image.GetNamespace()).Set(float64(state["available"]))
+	monitorImagesPending.WithLabelValues(image.GetName(), image.GetNamespace()).Set(float64(state["pending"]))
+	monitorImagesDeleting.WithLabelValues(image.GetName(), image.GetNamespace()).Set(float64(state["deleting"]))
+	monitorImagesUnknown.WithLabelValues(image.GetName(), image.GetNamespace()).Set(float64(state["unknown"]))
+	monitorImagesError.WithLabelValues(image.GetName(), image.GetNamespace()).Set(float64(state["error"]))
+	monitorImagesStale.WithLabelValues(image.GetName(), image.GetNamespace()).Set(float64(state["stale"]))
 
 	return img, nil
 }
 
+// newImageObject returns an empty image object for the key.  Cluster images are sent
+// to the workers without a namespace.
+func newImageObject(nns types.NamespacedName) stvziov1.ImageObject {
+	if nns.Namespace == "" {
+		return new(stvziov1.ClusterImage)
+	}
+
+	return new(stvziov1.Image)
+}
+
 func floor(a, b int) int {
 	return int(math.Floor(float64(a) / float64(b)))
 }
@@ -0,0 +1,214 @@
+// Copyright 2024 Coral Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// FilterPath is the path of the filter verb.
+	FilterPath = "/filter"
+	// PrioritizePath is the path of the prioritize verb.
+	PrioritizePath = "/prioritize"
+
+	maxRequestSize = 16 * 1024 * 1024
+)
+
+var (
+	ErrMissingPod    = errors.New("extender arguments are missing the pod")
+	ErrMissingClient = errors.New("node names were sent without a client to get the nodes")
+)
+
+// Extender is a kube-scheduler extender that filters out the nodes that will never
+// have the images of a pod prefetched and scores the remaining nodes by the share of
+// the image bytes that are already available.
+type Extender struct {
+	// Addr is the address the server listens on.
+	Addr string
+	// Client is used to get the nodes when the scheduler only sends the node names.
+	Client client.Reader
+
+	log logr.Logger
+}
+
+// Start runs the server until the context is done.
+func (e *Extender) Start(ctx context.Context) error {
+	e.log = log.FromContext(ctx).WithName("scheduler-extender")
+
+	mux := http.NewServeMux()
+	mux.Handle(FilterPath, e)
+	mux.Handle(PrioritizePath, e)
+
+	srv := &http.Server{
+		Addr:              e.Addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdown)
+	}()
+
+	e.log.Info("starting scheduler extender", "addr", e.Addr)
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	return nil
+}
+
+func (e *Extender) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxRequestSize))
+	if err != nil {
+		http.Error(w, "unable to read body", http.StatusBadRequest)
+		return
+	}
+
+	var args ExtenderArgs
+	if err := json.Unmarshal(body, &args); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if args.Pod == nil {
+		http.Error(w, ErrMissingPod.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var result interface{}
+	switch r.URL.Path {
+	case FilterPath:
+		result = e.Filter(r.Context(), args)
+	case PrioritizePath:
+		result, err = e.Prioritize(r.Context(), args)
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	if err != nil {
+		extenderRequests.WithLabelValues(r.URL.Path[1:], "error").Inc()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	extenderRequests.WithLabelValues(r.URL.Path[1:], "success").Inc()
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(result)
+}
+
+// Filter removes the nodes that are missing the label for one of the pod's images
+// that is managed on at least one of the other nodes.  Errors are returned in the
+// result so the scheduler can report them.
+func (e *Extender) Filter(ctx context.Context, args ExtenderArgs) *ExtenderFilterResult {
+	nodes, err := e.nodes(ctx, args)
+	if err != nil {
+		return &ExtenderFilterResult{Error: err.Error()}
+	}
+
+	required := Required(Images(args.Pod), nodes)
+	passed, failed := Filter(required, nodes)
+	extenderFilteredNodes.Add(float64(len(failed)))
+
+	if len(failed) > 0 {
+		e.log.V(4).Info("filtered nodes", "pod", client.ObjectKeyFromObject(args.Pod), "failed", len(failed))
+	}
+
+	result := &ExtenderFilterResult{FailedNodes: failed}
+	if args.Nodes != nil {
+		result.Nodes = &corev1.NodeList{Items: passed}
+		return result
+	}
+
+	names := make([]string, len(passed))
+	for i, node := range passed {
+		names[i] = node.Name
+	}
+	result.NodeNames = &names
+
+	return result
+}
+
+// Prioritize scores each of the nodes by the share of the pod's image bytes that
+// are available on the node.
+func (e *Extender) Prioritize(ctx context.Context, args ExtenderArgs) (HostPriorityList, error) {
+	nodes, err := e.nodes(ctx, args)
+	if err != nil {
+		return nil, err
+	}
+
+	images := Images(args.Pod)
+	sizes := Sizes(images, nodes)
+
+	priorities := make(HostPriorityList, len(nodes))
+	for i, node := range nodes {
+		priorities[i] = HostPriority{
+			Host:  node.Name,
+			Score: Score(images, sizes, node),
+		}
+	}
+
+	return priorities, nil
+}
+
+// nodes returns the nodes in the arguments, getting them by name when the scheduler
+// is caching the nodes.  Nodes that no longer exist are skipped.
+func (e *Extender) nodes(ctx context.Context, args ExtenderArgs) ([]corev1.Node, error) {
+	if args.Nodes != nil {
+		return args.Nodes.Items, nil
+	}
+
+	if args.NodeNames == nil {
+		return nil, nil
+	}
+
+	if e.Client == nil {
+		return nil, ErrMissingClient
+	}
+
+	nodes := make([]corev1.Node, 0, len(*args.NodeNames))
+	for _, name := range *args.NodeNames {
+		node := corev1.Node{}
+		if err := e.Client.Get(ctx, types.NamespacedName{Name: name}, &node); err != nil {
+			if apierrors.IsNotFound(err) {
+				continue
+			}
+			return nil, err
+		}
+		nodes = append(nodes, node)
+	}
+
+	return nodes, nil
+}
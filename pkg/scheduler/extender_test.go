@@ -0,0 +1,140 @@
+// Copyright 2024 Coral Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	stvziov1 "stvz.io/coral/pkg/apis/stvz.io/v1"
+	"stvz.io/coral/pkg/mock"
+)
+
+const (
+	nginx    = "docker.io/library/nginx:1.26"
+	postgres = "docker.io/library/postgres:17"
+)
+
+func node(name string, states map[string]stvziov1.ImageState, sizes map[string]int64) corev1.Node {
+	n := corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{}},
+	}
+	for image, state := range states {
+		n.Labels[stvziov1.HashedImageLabelKey(image)] = string(state)
+	}
+	for image, size := range sizes {
+		n.Status.Images = append(n.Status.Images, corev1.ContainerImage{
+			Names:     []string{image, image + "@sha256:abc"},
+			SizeBytes: size,
+		})
+	}
+	return n
+}
+
+var _ = Describe("Extender", func() {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"},
+		Spec: corev1.PodSpec{
+			InitContainers: []corev1.Container{{Name: "init", Image: "nginx:1.26"}},
+			Containers: []corev1.Container{
+				{Name: "web", Image: "nginx:1.26"},
+				{Name: "db", Image: "postgres:17"},
+				{Name: "unmanaged", Image: "busybox:1.36"},
+			},
+		},
+	}
+
+	nodes := &corev1.NodeList{
+		Items: []corev1.Node{
+			node("node-1", map[string]stvziov1.ImageState{
+				nginx:    stvziov1.ImageStateAvailable,
+				postgres: stvziov1.ImageStateAvailable,
+			}, map[string]int64{nginx: 100, postgres: 300}),
+			node("node-2", map[string]stvziov1.ImageState{
+				nginx:    stvziov1.ImageStatePending,
+				postgres: stvziov1.ImageStateAvailable,
+			}, nil),
+			node("node-3", map[string]stvziov1.ImageState{
+				nginx: stvziov1.ImageStateAvailable,
+			}, nil),
+		},
+	}
+
+	post := func(path string, args ExtenderArgs) *httptest.ResponseRecorder {
+		body, err := json.Marshal(args)
+		Expect(err).ToNot(HaveOccurred())
+
+		req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(body))
+		rec := httptest.NewRecorder()
+		(&Extender{}).ServeHTTP(rec, req)
+		return rec
+	}
+
+	It("should return the normalized pod images", func() {
+		Expect(Images(pod)).To(Equal([]string{nginx, postgres, "docker.io/library/busybox:1.36"}))
+	})
+
+	It("should filter out nodes without the label of a managed image", func() {
+		rec := post(FilterPath, ExtenderArgs{Pod: pod, Nodes: nodes})
+		Expect(rec.Code).To(Equal(http.StatusOK))
+
+		result := ExtenderFilterResult{}
+		Expect(json.Unmarshal(rec.Body.Bytes(), &result)).To(Succeed())
+		Expect(result.Nodes.Items).To(HaveLen(2))
+		Expect(result.Nodes.Items[0].Name).To(Equal("node-1"))
+		Expect(result.Nodes.Items[1].Name).To(Equal("node-2"))
+		Expect(result.FailedNodes).To(HaveKeyWithValue("node-3", "image "+postgres+" is not managed on the node"))
+	})
+
+	It("should score the nodes by the share of the image bytes that are available", func() {
+		rec := post(PrioritizePath, ExtenderArgs{Pod: pod, Nodes: nodes})
+		Expect(rec.Code).To(Equal(http.StatusOK))
+
+		// The size of the unmanaged busybox image isn't known, so it's given the average
+		// size of 200 bytes: node-1 has 400 of 600, node-2 300 and node-3 100.
+		result := HostPriorityList{}
+		Expect(json.Unmarshal(rec.Body.Bytes(), &result)).To(Succeed())
+		Expect(result).To(Equal(HostPriorityList{
+			{Host: "node-1", Score: 6},
+			{Host: "node-2", Score: 5},
+			{Host: "node-3", Score: 1},
+		}))
+	})
+
+	It("should get the nodes by name when the scheduler caches the nodes", func() {
+		c := mock.NewClient()
+		for i := range nodes.Items {
+			Expect(c.Create(context.Background(), nodes.Items[i].DeepCopy())).To(Succeed())
+		}
+
+		names := []string{"node-1", "node-3", "missing"}
+		result := (&Extender{Client: c}).Filter(context.Background(), ExtenderArgs{Pod: pod, NodeNames: &names})
+		Expect(result.Error).To(BeEmpty())
+		Expect(*result.NodeNames).To(Equal([]string{"node-1"}))
+		Expect(result.FailedNodes).To(HaveKey("node-3"))
+	})
+
+	It("should reject requests without a pod", func() {
+		rec := post(FilterPath, ExtenderArgs{Nodes: nodes})
+		Expect(rec.Code).To(Equal(http.StatusBadRequest))
+	})
+})
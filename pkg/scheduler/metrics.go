@@ -0,0 +1,40 @@
+// Copyright 2024 Coral Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var (
+	extenderRequests = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "coral_scheduler_extender_requests",
+			Help: "The number of requests handled by the scheduler extender for each verb.",
+		},
+		[]string{"verb", "result"},
+	)
+	extenderFilteredNodes = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "coral_scheduler_extender_filtered_nodes",
+			Help: "The number of nodes filtered out for missing a managed image.",
+		},
+	)
+)
+
+func init() {
+	metrics.Registry.MustRegister(extenderRequests, extenderFilteredNodes)
+}
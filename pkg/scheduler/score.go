@@ -0,0 +1,147 @@
+// Copyright 2024 Coral Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/containers/image/v5/docker/reference"
+	corev1 "k8s.io/api/core/v1"
+	stvziov1 "stvz.io/coral/pkg/apis/stvz.io/v1"
+)
+
+// Images returns the normalized NAME:TAG of the images used by the containers and
+// init containers of the pod.  Images referenced only by a digest are skipped since
+// the agent tracks images by tag.
+func Images(pod *corev1.Pod) []string {
+	var images []string
+	for _, c := range append(slices.Clone(pod.Spec.InitContainers), pod.Spec.Containers...) {
+		named, err := reference.ParseNormalizedNamed(c.Image)
+		if err != nil {
+			continue
+		}
+
+		tag := "latest"
+		if tagged, ok := named.(reference.Tagged); ok {
+			tag = tagged.Tag()
+		} else if _, ok := named.(reference.Digested); ok {
+			continue
+		}
+
+		image := reference.TrimNamed(named).String() + ":" + tag
+		if !slices.Contains(images, image) {
+			images = append(images, image)
+		}
+	}
+
+	return images
+}
+
+// Required returns the images that are managed on at least one of the nodes.  The
+// agent labels every node selected by an Image with the state of each of its images,
+// so a node without the label for a required image will never have it prefetched.
+func Required(images []string, nodes []corev1.Node) []string {
+	var required []string
+	for _, image := range images {
+		key := stvziov1.HashedImageLabelKey(image)
+		for _, node := range nodes {
+			if _, ok := node.GetLabels()[key]; ok {
+				required = append(required, image)
+				break
+			}
+		}
+	}
+
+	return required
+}
+
+// Filter splits the nodes into the nodes that have a label for each of the required
+// images and the nodes that are missing at least one, along with the reason.
+func Filter(required []string, nodes []corev1.Node) ([]corev1.Node, FailedNodesMap) {
+	passed := make([]corev1.Node, 0, len(nodes))
+	failed := make(FailedNodesMap)
+
+	for _, node := range nodes {
+		missing := ""
+		for _, image := range required {
+			if _, ok := node.GetLabels()[stvziov1.HashedImageLabelKey(image)]; !ok {
+				missing = image
+				break
+			}
+		}
+
+		if missing != "" {
+			failed[node.Name] = fmt.Sprintf("image %s is not managed on the node", missing)
+			continue
+		}
+		passed = append(passed, node)
+	}
+
+	return passed, failed
+}
+
+// Sizes returns the size in bytes of each image as reported by the kubelets in the
+// node status.  The largest size reported is used.  Images that haven't been pulled
+// on any of the nodes are given the average size of the known images, or a size of
+// one when no sizes are known so that each image has the same weight.
+func Sizes(images []string, nodes []corev1.Node) map[string]int64 {
+	sizes := make(map[string]int64)
+	for _, node := range nodes {
+		for _, nodeImage := range node.Status.Images {
+			for _, name := range nodeImage.Names {
+				if slices.Contains(images, name) && nodeImage.SizeBytes > sizes[name] {
+					sizes[name] = nodeImage.SizeBytes
+				}
+			}
+		}
+	}
+
+	var total int64
+	for _, size := range sizes {
+		total += size
+	}
+
+	fallback := int64(1)
+	if len(sizes) > 0 {
+		fallback = max(total/int64(len(sizes)), 1)
+	}
+
+	for _, image := range images {
+		if _, ok := sizes[image]; !ok {
+			sizes[image] = fallback
+		}
+	}
+
+	return sizes
+}
+
+// Score returns the share of the image bytes that are available on the node, scaled
+// to MaxExtenderPriority.
+func Score(images []string, sizes map[string]int64, node corev1.Node) int64 {
+	var available, total int64
+	for _, image := range images {
+		total += sizes[image]
+		if node.GetLabels()[stvziov1.HashedImageLabelKey(image)] == string(stvziov1.ImageStateAvailable) {
+			available += sizes[image]
+		}
+	}
+
+	if total == 0 {
+		return 0
+	}
+
+	return available * MaxExtenderPriority / total
+}
@@ -0,0 +1,55 @@
+// Copyright 2024 Coral Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler
+
+import (
+	corev1 "k8s.io/api/core/v1"
+)
+
+// The extender types are wire compatible with k8s.io/kube-scheduler/extender/v1,
+// which is kept out of the module to avoid pulling in the scheduler dependencies.
+
+// MaxExtenderPriority is the highest score that can be given to a node.
+const MaxExtenderPriority int64 = 10
+
+// ExtenderArgs are the arguments sent by the scheduler to the filter and prioritize
+// verbs.  Nodes is set unless the extender is configured with nodeCacheCapable, in
+// which case only the NodeNames are sent.
+type ExtenderArgs struct {
+	Pod       *corev1.Pod      `json:"pod"`
+	Nodes     *corev1.NodeList `json:"nodes,omitempty"`
+	NodeNames *[]string        `json:"nodenames,omitempty"`
+}
+
+// FailedNodesMap maps the names of the filtered nodes to the reason they failed.
+type FailedNodesMap map[string]string
+
+// ExtenderFilterResult is the result of the filter verb.
+type ExtenderFilterResult struct {
+	Nodes                      *corev1.NodeList `json:"nodes,omitempty"`
+	NodeNames                  *[]string        `json:"nodenames,omitempty"`
+	FailedNodes                FailedNodesMap   `json:"failedNodes,omitempty"`
+	FailedAndUnresolvableNodes FailedNodesMap   `json:"failedAndUnresolvableNodes,omitempty"`
+	Error                      string           `json:"error,omitempty"`
+}
+
+// HostPriority is the score of a single node.
+type HostPriority struct {
+	Host  string `json:"host"`
+	Score int64  `json:"score"`
+}
+
+// HostPriorityList is the result of the prioritize verb.
+type HostPriorityList []HostPriority